@@ -17,6 +17,8 @@ package spannerdriver
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"io"
 	"reflect"
 	"testing"
 
@@ -343,6 +345,87 @@ func TestQueryWithNewColumn_CommitAborted(t *testing.T) {
 		}, ErrAbortedDueToConcurrentModification)
 }
 
+func TestRead_CommitAborted(t *testing.T) {
+	testRetryReadWriteTransactionWithRead(t, func(server testutil.InMemSpannerServer) {
+		server.PutExecutionTime(testutil.MethodCommitTransaction, testutil.SimulatedExecutionTime{
+			Errors: []error{status.Error(codes.Aborted, "Aborted")},
+		})
+	}, nil, 2, 2)
+}
+
+func TestReadWithDifferentResults_CommitAborted(t *testing.T) {
+	testRetryReadWriteTransactionWithRead(t, func(server testutil.InMemSpannerServer) {
+		server.PutExecutionTime(testutil.MethodCommitTransaction, testutil.SimulatedExecutionTime{
+			Errors: []error{status.Error(codes.Aborted, "Aborted")},
+		})
+		server.PutStatementResult(testutil.SelectFooFromBar, &testutil.StatementResult{
+			Type:      testutil.StatementResultResultSet,
+			ResultSet: testutil.CreateSingleColumnResultSet([]int64{1, 3}, "FOO"),
+		})
+	}, ErrAbortedDueToConcurrentModification, 2, 1)
+}
+
+// testRetryReadWriteTransactionWithRead tests a scenario where a transaction
+// with a read is retried. The in-memory server returns the results of the
+// query `SELECT FOO FROM BAR` for a read of the column FOO from the table BAR.
+func testRetryReadWriteTransactionWithRead(t *testing.T, beforeCommit func(server testutil.InMemSpannerServer),
+	wantCommitErr error, wantReadCount int, wantCommitCount int) {
+
+	t.Parallel()
+
+	db, server, teardown := setupTestDBConnection(t)
+	defer teardown()
+
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("failed to get connection: %v", err)
+	}
+	defer conn.Close()
+	tx, err := conn.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		t.Fatalf("begin failed: %v", err)
+	}
+	values := make([]int64, 0)
+	if err := conn.Raw(func(driverConn interface{}) error {
+		rows, err := driverConn.(SpannerConn).Read(ctx, "BAR", spanner.AllKeys(), []string{"FOO"}, nil)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		dest := make([]driver.Value, 1)
+		for {
+			if err := rows.Next(dest); err == io.EOF {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			values = append(values, dest[0].(int64))
+		}
+	}); err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if g, w := values, []int64{1, 2}; !cmp.Equal(g, w) {
+		t.Fatalf("values mismatch\nGot: %v\nWant: %v", g, w)
+	}
+	if beforeCommit != nil {
+		beforeCommit(server.TestSpanner)
+	}
+	err = tx.Commit()
+	if err != wantCommitErr {
+		t.Fatalf("commit error mismatch\nGot: %v\nWant: %v", err, wantCommitErr)
+	}
+	reqs := drainRequestsFromServer(server.TestSpanner)
+	readReqs := requestsOfType(reqs, reflect.TypeOf(&sppb.ReadRequest{}))
+	if g, w := len(readReqs), wantReadCount; g != w {
+		t.Fatalf("read request count mismatch\nGot: %v\nWant: %v", g, w)
+	}
+	commitReqs := requestsOfType(reqs, reflect.TypeOf(&sppb.CommitRequest{}))
+	if g, w := len(commitReqs), wantCommitCount; g != w {
+		t.Fatalf("commit request count mismatch\nGot: %v\nWant: %v", g, w)
+	}
+}
+
 // testRetryReadWriteTransactionWithQueryWithRetrySuccess tests a scenario where a
 // transaction with a query is retried and the retry should succeed.
 func testRetryReadWriteTransactionWithQueryWithRetrySuccess(t *testing.T, setupServer func(server testutil.InMemSpannerServer),
@@ -388,6 +388,29 @@ func BenchmarkSelect100SingersReadWriteTxClient(b *testing.B) {
 	}
 }
 
+func BenchmarkSelectAllSingersConnection(b *testing.B) {
+	benchmarkSelectAllSingers(b, "")
+}
+
+func BenchmarkSelectAllSingersPrefetchConnection(b *testing.B) {
+	benchmarkSelectAllSingers(b, ";prefetch_rows=1000;prefetch_bytes=4194304")
+}
+
+func benchmarkSelectAllSingers(b *testing.B, params string) {
+	db, err := sql.Open("spanner", fmt.Sprintf("projects/%s/instances/%s/databases/%s%s", benchmarkProjectId, benchmarkInstanceId, benchmarkDatabaseId, params))
+	if err != nil {
+		b.Fatalf("failed to open database connection: %v\n", err)
+	}
+	defer db.Close()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if err := selectAllSingers(db); err != nil {
+			b.Fatalf("failed to select all singers: %v", err)
+		}
+	}
+}
+
 type singer struct {
 	SingerId  int64
 	FirstName string
@@ -428,6 +451,21 @@ func selectRandomSingers(db queryerSql, count int) error {
 	return rows.Err()
 }
 
+func selectAllSingers(db queryerSql) error {
+	rows, err := db.QueryContext(context.Background(), "SELECT * FROM Singers")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var s singer
+		if err := rows.Scan(&s.SingerId, &s.FirstName, &s.LastName, &s.FullName, &s.BirthDate, &s.Picture); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
 func updateSingerUsingMutation(conn *sql.Conn, s *singer) error {
 	m, err := s.toMutation()
 	if err != nil {
@@ -49,9 +49,11 @@ type checksumRowIterator struct {
 	*spanner.RowIterator
 	metadata *sppb.ResultSetMetadata
 
-	ctx  context.Context
-	tx   *readWriteTransaction
-	stmt spanner.Statement
+	ctx context.Context
+	tx  *readWriteTransaction
+	// exec executes the query or read that produced the results of this
+	// iterator. It is called again with the new transaction during a retry.
+	exec func(ctx context.Context, tx *spanner.ReadWriteStmtBasedTransaction) *spanner.RowIterator
 	// nc (nextCount) indicates the number of times that next has been called
 	// on the iterator. Next() will be called the same number of times during
 	// a retry.
@@ -151,16 +153,16 @@ func createMetadataChecksum(enc *gob.Encoder, buffer *bytes.Buffer, metadata *sp
 	return &res, nil
 }
 
-// retry implements retriableStatement.retry for queries. It will execute the
-// query on a new Spanner transaction and iterate over the same number of rows
-// as the initial attempt, and then compare the checksum of the initial and the
-// retried iterator. It will also check if any error that was returned by the
+// retry implements retriableStatement.retry for queries and reads. It will
+// execute the query or read on a new Spanner transaction and iterate over the
+// same number of rows as the initial attempt, and then compare the checksum of
+// the initial and the retried iterator. It will also check if any error that was returned by the
 // initial iterator was also returned by the new iterator, and that the errors
 // were returned by the same row index.
 func (it *checksumRowIterator) retry(ctx context.Context, tx *spanner.ReadWriteStmtBasedTransaction) error {
 	buffer := &bytes.Buffer{}
 	enc := gob.NewEncoder(buffer)
-	retryIt := tx.Query(ctx, it.stmt)
+	retryIt := it.exec(ctx, tx)
 	// If the original iterator had been stopped, we should also always stop the
 	// new iterator.
 	if it.stopped {
@@ -244,3 +246,7 @@ func (it *checksumRowIterator) Stop() {
 func (it *checksumRowIterator) Metadata() *sppb.ResultSetMetadata {
 	return it.metadata
 }
+
+func (it *checksumRowIterator) ResultSetStats() *sppb.ResultSetStats {
+	return resultSetStats(it.RowIterator)
+}
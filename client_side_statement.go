@@ -25,9 +25,11 @@ import (
 	"time"
 
 	"cloud.google.com/go/spanner"
+	"google.golang.org/api/iterator"
 	sppb "google.golang.org/genproto/googleapis/spanner/v1"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
 )
 
 // statementExecutor is an empty struct that is used to hold the execution methods
@@ -85,6 +87,171 @@ func (s *statementExecutor) ShowReadOnlyStaleness(_ context.Context, c *conn, _
 	return &rows{it: it}, nil
 }
 
+func (s *statementExecutor) ShowStatementTimeout(_ context.Context, c *conn, _ string, _ []driver.NamedValue) (driver.Rows, error) {
+	it, err := createDurationIterator("StatementTimeout", c.StatementTimeout())
+	if err != nil {
+		return nil, err
+	}
+	return &rows{it: it}, nil
+}
+
+func (s *statementExecutor) ShowMaxCommitDelay(_ context.Context, c *conn, _ string, _ []driver.NamedValue) (driver.Rows, error) {
+	it, err := createDurationIterator("MaxCommitDelay", c.MaxCommitDelay())
+	if err != nil {
+		return nil, err
+	}
+	return &rows{it: it}, nil
+}
+
+func (s *statementExecutor) ShowDirectedRead(_ context.Context, c *conn, _ string, _ []driver.NamedValue) (driver.Rows, error) {
+	var v spanner.NullString
+	if c.DirectedReadOptions() != nil {
+		b, err := protojson.Marshal(c.DirectedReadOptions())
+		if err != nil {
+			return nil, err
+		}
+		v = spanner.NullString{StringVal: string(b), Valid: true}
+	}
+	it, err := createSingleValueIterator("DirectedRead", v, sppb.TypeCode_STRING)
+	if err != nil {
+		return nil, err
+	}
+	return &rows{it: it}, nil
+}
+
+func (s *statementExecutor) ShowDmlAsMutations(_ context.Context, c *conn, _ string, _ []driver.NamedValue) (driver.Rows, error) {
+	it, err := createBooleanIterator("DmlAsMutations", c.DmlAsMutations())
+	if err != nil {
+		return nil, err
+	}
+	return &rows{it: it}, nil
+}
+
+func (s *statementExecutor) ShowDecodeMode(_ context.Context, c *conn, _ string, _ []driver.NamedValue) (driver.Rows, error) {
+	it, err := createStringIterator("DecodeMode", c.DecodeMode().String())
+	if err != nil {
+		return nil, err
+	}
+	return &rows{it: it}, nil
+}
+
+func (s *statementExecutor) ShowQueryStats(_ context.Context, c *conn, _ string, _ []driver.NamedValue) (driver.Rows, error) {
+	var v spanner.NullJSON
+	if c.queryStats != nil && c.queryStats.QueryStats != nil {
+		v = spanner.NullJSON{Value: c.queryStats.QueryStats.AsMap(), Valid: true}
+	}
+	it, err := createSingleValueIterator("QueryStats", v, sppb.TypeCode_JSON)
+	if err != nil {
+		return nil, err
+	}
+	return &rows{it: it}, nil
+}
+
+func (s *statementExecutor) ShowOptimizerVersion(_ context.Context, c *conn, _ string, _ []driver.NamedValue) (driver.Rows, error) {
+	it, err := createStringIterator("OptimizerVersion", c.OptimizerVersion())
+	if err != nil {
+		return nil, err
+	}
+	return &rows{it: it}, nil
+}
+
+func (s *statementExecutor) ShowOptimizerStatisticsPackage(_ context.Context, c *conn, _ string, _ []driver.NamedValue) (driver.Rows, error) {
+	it, err := createStringIterator("OptimizerStatisticsPackage", c.OptimizerStatisticsPackage())
+	if err != nil {
+		return nil, err
+	}
+	return &rows{it: it}, nil
+}
+
+func (s *statementExecutor) Explain(ctx context.Context, c *conn, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return explain(ctx, c, query, args, sppb.ExecuteSqlRequest_PLAN)
+}
+
+func (s *statementExecutor) ExplainAnalyze(ctx context.Context, c *conn, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return explain(ctx, c, query, args, sppb.ExecuteSqlRequest_PROFILE)
+}
+
+// explain executes the given query in PLAN or PROFILE mode and returns the
+// query plan as a result set with one row for each relational operator in the
+// plan. The operators are indented according to their depth in the plan.
+// Queries that are executed in PROFILE mode also return the execution
+// statistics of each operator. The statistics of the query are registered on
+// the connection and can be retrieved with SHOW VARIABLE QUERY_STATS.
+func explain(ctx context.Context, c *conn, query string, args []driver.NamedValue, mode sppb.ExecuteSqlRequest_QueryMode) (driver.Rows, error) {
+	options := c.queryOptions()
+	options.Mode = &mode
+	params, err := parseNamedParameters(query)
+	if err != nil {
+		return nil, err
+	}
+	it, err := c.query(ctx, &parsedStatement{query: query, statementType: statementTypeQuery, params: params}, args, options)
+	if err != nil {
+		return nil, err
+	}
+	defer it.Stop()
+	for {
+		_, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	stats := it.ResultSetStats()
+	c.queryStats = stats
+	if stats == nil || len(stats.GetQueryPlan().GetPlanNodes()) == 0 {
+		return nil, spanner.ToSpannerError(status.Errorf(codes.FailedPrecondition, "no query plan returned for %q", query))
+	}
+
+	columns := []string{"ID", "Operator"}
+	fields := []*sppb.StructType_Field{
+		{Name: "ID", Type: &sppb.Type{Code: sppb.TypeCode_INT64}},
+		{Name: "Operator", Type: &sppb.Type{Code: sppb.TypeCode_STRING}},
+	}
+	if mode == sppb.ExecuteSqlRequest_PROFILE {
+		columns = append(columns, "ExecutionStats")
+		fields = append(fields, &sppb.StructType_Field{Name: "ExecutionStats", Type: &sppb.Type{Code: sppb.TypeCode_JSON}})
+	}
+	nodes := stats.QueryPlan.PlanNodes
+	var planRows []*spanner.Row
+	var appendNode func(index int32, depth int) error
+	appendNode = func(index int32, depth int) error {
+		if index < 0 || int(index) >= len(nodes) {
+			return nil
+		}
+		node := nodes[index]
+		values := []interface{}{int64(node.Index), strings.Repeat("  ", depth) + node.DisplayName}
+		if mode == sppb.ExecuteSqlRequest_PROFILE {
+			var executionStats spanner.NullJSON
+			if node.ExecutionStats != nil {
+				executionStats = spanner.NullJSON{Value: node.ExecutionStats.AsMap(), Valid: true}
+			}
+			values = append(values, executionStats)
+		}
+		row, err := spanner.NewRow(columns, values)
+		if err != nil {
+			return err
+		}
+		planRows = append(planRows, row)
+		for _, link := range node.ChildLinks {
+			if link.ChildIndex >= 0 && int(link.ChildIndex) < len(nodes) && nodes[link.ChildIndex].Kind == sppb.PlanNode_RELATIONAL {
+				if err := appendNode(link.ChildIndex, depth+1); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err := appendNode(0, 0); err != nil {
+		return nil, err
+	}
+	return &rows{it: &clientSideIterator{
+		metadata: &sppb.ResultSetMetadata{RowType: &sppb.StructType{Fields: fields}},
+		rows:     planRows,
+	}}, nil
+}
+
 func (s *statementExecutor) StartBatchDdl(_ context.Context, c *conn, _ string, _ []driver.NamedValue) (driver.Result, error) {
 	return c.startBatchDDL()
 }
@@ -174,6 +341,113 @@ func (s *statementExecutor) SetReadOnlyStaleness(_ context.Context, c *conn, par
 	return c.setReadOnlyStaleness(staleness)
 }
 
+var nullRegexp = regexp.MustCompile("(?i)^NULL$")
+var durationRegexp = regexp.MustCompile("(?i)^'(?P<duration>(\\d{1,19})(s|ms|us|ns))'$")
+
+func (s *statementExecutor) SetStatementTimeout(_ context.Context, c *conn, params string, _ []driver.NamedValue) (driver.Result, error) {
+	d, err := parseDurationOrNull("StatementTimeout", params)
+	if err != nil {
+		return nil, err
+	}
+	return c.setStatementTimeout(d)
+}
+
+func (s *statementExecutor) SetMaxCommitDelay(_ context.Context, c *conn, params string, _ []driver.NamedValue) (driver.Result, error) {
+	d, err := parseDurationOrNull("MaxCommitDelay", params)
+	if err != nil {
+		return nil, err
+	}
+	return c.setMaxCommitDelay(d)
+}
+
+var directedReadRegexp = regexp.MustCompile("(?s)^'(?P<options>.*)'$")
+
+func (s *statementExecutor) SetDirectedRead(_ context.Context, c *conn, params string, _ []driver.NamedValue) (driver.Result, error) {
+	if params == "" {
+		return nil, spanner.ToSpannerError(status.Error(codes.InvalidArgument, "no value given for DirectedRead"))
+	}
+	if nullRegexp.MatchString(params) {
+		return c.setDirectedReadOptions(nil)
+	}
+	if !directedReadRegexp.MatchString(params) {
+		return nil, spanner.ToSpannerError(status.Errorf(codes.InvalidArgument, "invalid DirectedRead value: %s", params))
+	}
+	value := matchesToMap(directedReadRegexp, params)["options"]
+	if value == "" {
+		return c.setDirectedReadOptions(nil)
+	}
+	options, err := parseDirectedReadOptions(value)
+	if err != nil {
+		return nil, err
+	}
+	return c.setDirectedReadOptions(options)
+}
+
+func (s *statementExecutor) SetDmlAsMutations(_ context.Context, c *conn, params string, _ []driver.NamedValue) (driver.Result, error) {
+	if params == "" {
+		return nil, spanner.ToSpannerError(status.Error(codes.InvalidArgument, "no value given for DmlAsMutations"))
+	}
+	dmlAsMutations, err := strconv.ParseBool(params)
+	if err != nil {
+		return nil, spanner.ToSpannerError(status.Errorf(codes.InvalidArgument, "invalid boolean value: %s", params))
+	}
+	return c.setDmlAsMutations(dmlAsMutations)
+}
+
+func (s *statementExecutor) SetDecodeMode(_ context.Context, c *conn, params string, _ []driver.NamedValue) (driver.Result, error) {
+	if params == "" {
+		return nil, spanner.ToSpannerError(status.Error(codes.InvalidArgument, "no value given for DecodeMode"))
+	}
+	if len(params) < 2 || params[0] != '\'' || params[len(params)-1] != '\'' {
+		return nil, spanner.ToSpannerError(status.Errorf(codes.InvalidArgument, "invalid DecodeMode value: %s", params))
+	}
+	mode, err := parseDecodeMode(params[1 : len(params)-1])
+	if err != nil {
+		return nil, err
+	}
+	return c.setDecodeMode(mode)
+}
+
+var optimizerVersionRegexp = regexp.MustCompile(`(?i)^'(?P<version>\d{1,20}|latest|)'$`)
+
+func (s *statementExecutor) SetOptimizerVersion(_ context.Context, c *conn, params string, _ []driver.NamedValue) (driver.Result, error) {
+	if params == "" {
+		return nil, spanner.ToSpannerError(status.Error(codes.InvalidArgument, "no value given for OptimizerVersion"))
+	}
+	if !optimizerVersionRegexp.MatchString(params) {
+		return nil, spanner.ToSpannerError(status.Errorf(codes.InvalidArgument, "invalid OptimizerVersion value: %s", params))
+	}
+	return c.setOptimizerVersion(matchesToMap(optimizerVersionRegexp, params)["version"])
+}
+
+var optimizerStatisticsPackageRegexp = regexp.MustCompile(`^'(?P<package>\S*)'$`)
+
+func (s *statementExecutor) SetOptimizerStatisticsPackage(_ context.Context, c *conn, params string, _ []driver.NamedValue) (driver.Result, error) {
+	if params == "" {
+		return nil, spanner.ToSpannerError(status.Error(codes.InvalidArgument, "no value given for OptimizerStatisticsPackage"))
+	}
+	if !optimizerStatisticsPackageRegexp.MatchString(params) {
+		return nil, spanner.ToSpannerError(status.Errorf(codes.InvalidArgument, "invalid OptimizerStatisticsPackage value: %s", params))
+	}
+	return c.setOptimizerStatisticsPackage(matchesToMap(optimizerStatisticsPackageRegexp, params)["package"])
+}
+
+// parseDurationOrNull parses the value of a SET statement for a variable that
+// accepts either a quoted duration like '10s' or NULL. NULL is returned as a
+// zero duration.
+func parseDurationOrNull(name, params string) (time.Duration, error) {
+	if params == "" {
+		return 0, spanner.ToSpannerError(status.Errorf(codes.InvalidArgument, "no value given for %s", name))
+	}
+	if nullRegexp.MatchString(params) {
+		return 0, nil
+	}
+	if !durationRegexp.MatchString(params) {
+		return 0, spanner.ToSpannerError(status.Errorf(codes.InvalidArgument, "invalid %s value: %s", name, params))
+	}
+	return parseDuration(durationRegexp, strings.ToLower(params))
+}
+
 func parseDuration(re *regexp.Regexp, params string) (time.Duration, error) {
 	matches := matchesToMap(re, params)
 	if matches["duration"] == "" {
@@ -230,6 +504,17 @@ func createTimestampIterator(column string, value *time.Time) (*clientSideIterat
 	return createSingleValueIterator(column, value, sppb.TypeCode_TIMESTAMP)
 }
 
+// createDurationIterator creates a row iterator with a single STRING column
+// with one row that contains the given duration. A zero duration is returned
+// as NULL.
+func createDurationIterator(column string, value time.Duration) (*clientSideIterator, error) {
+	var v spanner.NullString
+	if value > 0 {
+		v = spanner.NullString{StringVal: value.String(), Valid: true}
+	}
+	return createSingleValueIterator(column, v, sppb.TypeCode_STRING)
+}
+
 func createSingleValueIterator(column string, value interface{}, code sppb.TypeCode) (*clientSideIterator, error) {
 	row, err := spanner.NewRow([]string{column}, []interface{}{value})
 	if err != nil {
@@ -252,6 +537,7 @@ func createSingleValueIterator(column string, value interface{}, code sppb.TypeC
 // should only be used for small result sets.
 type clientSideIterator struct {
 	metadata *sppb.ResultSetMetadata
+	stats    *sppb.ResultSetStats
 	rows     []*spanner.Row
 	index    int
 	stopped  bool
@@ -275,3 +561,7 @@ func (t *clientSideIterator) Stop() {
 func (t *clientSideIterator) Metadata() *sppb.ResultSetMetadata {
 	return t.metadata
 }
+
+func (t *clientSideIterator) ResultSetStats() *sppb.ResultSetStats {
+	return t.stats
+}
@@ -22,8 +22,11 @@ import (
 	"time"
 
 	"cloud.google.com/go/spanner"
+	sppb "cloud.google.com/go/spanner/apiv1/spannerpb"
 	"github.com/google/go-cmp/cmp"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
 )
 
 func TestStatementExecutor_StartBatchDdl(t *testing.T) {
@@ -275,6 +278,280 @@ func TestStatementExecutor_ReadOnlyStaleness(t *testing.T) {
 	}
 }
 
+func TestStatementExecutor_StatementTimeout(t *testing.T) {
+	c := &conn{}
+	s := &statementExecutor{}
+	ctx := context.Background()
+	for i, test := range []struct {
+		wantValue  interface{}
+		setValue   string
+		wantSetErr bool
+	}{
+		{"1s", "'1s'", false},
+		{"100ms", "'100ms'", false},
+		{"10ms", "'10000us'", false},
+		{"1µs", "'1000ns'", false},
+		{nil, "null", false},
+		{"10s", "'10S'", false},
+		{nil, "NULL", false},
+		{nil, "'1m'", true},
+		{nil, "'1'", true},
+		{nil, "1s", true},
+		{nil, "'-1s'", true},
+	} {
+		res, err := s.SetStatementTimeout(ctx, c, test.setValue, nil)
+		if test.wantSetErr {
+			if err == nil {
+				t.Fatalf("%d: missing expected error for value %q", i, test.setValue)
+			}
+		} else {
+			if err != nil {
+				t.Fatalf("%d: could not set new value %q for statement timeout: %v", i, test.setValue, err)
+			}
+			if res != driver.ResultNoRows {
+				t.Fatalf("%d: result mismatch\nGot: %v\nWant: %v", i, res, driver.ResultNoRows)
+			}
+		}
+
+		it, err := s.ShowStatementTimeout(ctx, c, "", nil)
+		if err != nil {
+			t.Fatalf("%d: could not get current statement timeout value from connection: %v", i, err)
+		}
+		cols := it.Columns()
+		wantCols := []string{"StatementTimeout"}
+		if !cmp.Equal(cols, wantCols) {
+			t.Fatalf("%d: column names mismatch\nGot: %v\nWant: %v", i, cols, wantCols)
+		}
+		values := make([]driver.Value, len(cols))
+		if err := it.Next(values); err != nil {
+			t.Fatalf("%d: failed to get first row for statement timeout: %v", i, err)
+		}
+		wantValues := []driver.Value{test.wantValue}
+		if !cmp.Equal(values, wantValues) {
+			t.Fatalf("%d: statement timeout values mismatch\nGot: %v\nWant: %v", i, values, wantValues)
+		}
+		if err := it.Next(values); err != io.EOF {
+			t.Fatalf("%d: error mismatch\nGot: %v\nWant: %v", i, err, io.EOF)
+		}
+	}
+}
+
+func TestStatementExecutor_MaxCommitDelay(t *testing.T) {
+	c := &conn{}
+	s := &statementExecutor{}
+	ctx := context.Background()
+	for i, test := range []struct {
+		wantValue  interface{}
+		setValue   string
+		wantSetErr bool
+	}{
+		{"100ms", "'100ms'", false},
+		{"50ms", "'50000us'", false},
+		{nil, "null", false},
+		{"1s", "'1S'", false},
+		{nil, "NULL", false},
+		{nil, "'1m'", true},
+		{nil, "100ms", true},
+	} {
+		res, err := s.SetMaxCommitDelay(ctx, c, test.setValue, nil)
+		if test.wantSetErr {
+			if err == nil {
+				t.Fatalf("%d: missing expected error for value %q", i, test.setValue)
+			}
+		} else {
+			if err != nil {
+				t.Fatalf("%d: could not set new value %q for max commit delay: %v", i, test.setValue, err)
+			}
+			if res != driver.ResultNoRows {
+				t.Fatalf("%d: result mismatch\nGot: %v\nWant: %v", i, res, driver.ResultNoRows)
+			}
+		}
+
+		it, err := s.ShowMaxCommitDelay(ctx, c, "", nil)
+		if err != nil {
+			t.Fatalf("%d: could not get current max commit delay value from connection: %v", i, err)
+		}
+		values := make([]driver.Value, len(it.Columns()))
+		if err := it.Next(values); err != nil {
+			t.Fatalf("%d: failed to get first row for max commit delay: %v", i, err)
+		}
+		wantValues := []driver.Value{test.wantValue}
+		if !cmp.Equal(values, wantValues) {
+			t.Fatalf("%d: max commit delay values mismatch\nGot: %v\nWant: %v", i, values, wantValues)
+		}
+	}
+}
+
+func TestStatementExecutor_DecodeMode(t *testing.T) {
+	c := &conn{}
+	s := &statementExecutor{}
+	ctx := context.Background()
+	for i, test := range []struct {
+		wantValue  string
+		setValue   string
+		wantSetErr bool
+	}{
+		{"Native", "'NATIVE'", false},
+		{"Generic", "'generic'", false},
+		{"Spanner", "'Spanner'", false},
+		{"Spanner", "'Foo'", true},
+		{"Spanner", "NATIVE", true},
+		{"Spanner", "", true},
+	} {
+		res, err := s.SetDecodeMode(ctx, c, test.setValue, nil)
+		if test.wantSetErr {
+			if err == nil {
+				t.Fatalf("%d: missing expected error for value %q", i, test.setValue)
+			}
+		} else {
+			if err != nil {
+				t.Fatalf("%d: could not set new value %q for decode mode: %v", i, test.setValue, err)
+			}
+			if res != driver.ResultNoRows {
+				t.Fatalf("%d: result mismatch\nGot: %v\nWant: %v", i, res, driver.ResultNoRows)
+			}
+		}
+
+		it, err := s.ShowDecodeMode(ctx, c, "", nil)
+		if err != nil {
+			t.Fatalf("%d: could not get current decode mode value from connection: %v", i, err)
+		}
+		cols := it.Columns()
+		wantCols := []string{"DecodeMode"}
+		if !cmp.Equal(cols, wantCols) {
+			t.Fatalf("%d: column names mismatch\nGot: %v\nWant: %v", i, cols, wantCols)
+		}
+		values := make([]driver.Value, len(cols))
+		if err := it.Next(values); err != nil {
+			t.Fatalf("%d: failed to get first row for decode mode: %v", i, err)
+		}
+		wantValues := []driver.Value{test.wantValue}
+		if !cmp.Equal(values, wantValues) {
+			t.Fatalf("%d: decode mode values mismatch\nGot: %v\nWant: %v", i, values, wantValues)
+		}
+		if err := it.Next(values); err != io.EOF {
+			t.Fatalf("%d: error mismatch\nGot: %v\nWant: %v", i, err, io.EOF)
+		}
+	}
+}
+
+func TestStatementExecutor_OptimizerOptions(t *testing.T) {
+	c := &conn{}
+	s := &statementExecutor{}
+	ctx := context.Background()
+	for i, test := range []struct {
+		set        func(ctx context.Context, c *conn, params string, args []driver.NamedValue) (driver.Result, error)
+		show       func(ctx context.Context, c *conn, params string, args []driver.NamedValue) (driver.Rows, error)
+		wantValue  string
+		setValue   string
+		wantSetErr bool
+	}{
+		{s.SetOptimizerVersion, s.ShowOptimizerVersion, "5", "'5'", false},
+		{s.SetOptimizerVersion, s.ShowOptimizerVersion, "LATEST", "'LATEST'", false},
+		{s.SetOptimizerVersion, s.ShowOptimizerVersion, "", "''", false},
+		{s.SetOptimizerVersion, s.ShowOptimizerVersion, "", "'foo'", true},
+		{s.SetOptimizerVersion, s.ShowOptimizerVersion, "", "5", true},
+		{s.SetOptimizerStatisticsPackage, s.ShowOptimizerStatisticsPackage, "auto_20191128_14_47_22UTC", "'auto_20191128_14_47_22UTC'", false},
+		{s.SetOptimizerStatisticsPackage, s.ShowOptimizerStatisticsPackage, "", "''", false},
+		{s.SetOptimizerStatisticsPackage, s.ShowOptimizerStatisticsPackage, "", "'foo bar'", true},
+	} {
+		res, err := test.set(ctx, c, test.setValue, nil)
+		if test.wantSetErr {
+			if err == nil {
+				t.Fatalf("%d: missing expected error for value %q", i, test.setValue)
+			}
+		} else {
+			if err != nil {
+				t.Fatalf("%d: could not set new value %q: %v", i, test.setValue, err)
+			}
+			if res != driver.ResultNoRows {
+				t.Fatalf("%d: result mismatch\nGot: %v\nWant: %v", i, res, driver.ResultNoRows)
+			}
+		}
+
+		it, err := test.show(ctx, c, "", nil)
+		if err != nil {
+			t.Fatalf("%d: could not get current value from connection: %v", i, err)
+		}
+		values := make([]driver.Value, len(it.Columns()))
+		if err := it.Next(values); err != nil {
+			t.Fatalf("%d: failed to get first row: %v", i, err)
+		}
+		wantValues := []driver.Value{test.wantValue}
+		if !cmp.Equal(values, wantValues) {
+			t.Fatalf("%d: values mismatch\nGot: %v\nWant: %v", i, values, wantValues)
+		}
+	}
+}
+
+func TestStatementExecutor_DirectedRead(t *testing.T) {
+	c := &conn{}
+	s := &statementExecutor{}
+	ctx := context.Background()
+	usEast := &sppb.DirectedReadOptions{
+		Replicas: &sppb.DirectedReadOptions_IncludeReplicas_{
+			IncludeReplicas: &sppb.DirectedReadOptions_IncludeReplicas{
+				ReplicaSelections: []*sppb.DirectedReadOptions_ReplicaSelection{{Location: "us-east1"}},
+			},
+		},
+	}
+	readOnlyReplicas := &sppb.DirectedReadOptions{
+		Replicas: &sppb.DirectedReadOptions_ExcludeReplicas_{
+			ExcludeReplicas: &sppb.DirectedReadOptions_ExcludeReplicas{
+				ReplicaSelections: []*sppb.DirectedReadOptions_ReplicaSelection{{Type: sppb.DirectedReadOptions_ReplicaSelection_READ_WRITE}},
+			},
+		},
+	}
+	for i, test := range []struct {
+		wantValue  *sppb.DirectedReadOptions
+		setValue   string
+		wantSetErr bool
+	}{
+		{usEast, `'{"includeReplicas":{"replicaSelections":[{"location":"us-east1"}]}}'`, false},
+		{nil, "null", false},
+		{readOnlyReplicas, `'{"excludeReplicas":{"replicaSelections":[{"type":"READ_WRITE"}]}}'`, false},
+		{nil, "''", false},
+		{nil, `'{"includeReplicas":'`, true},
+		{nil, `{"includeReplicas":{}}`, true},
+	} {
+		res, err := s.SetDirectedRead(ctx, c, test.setValue, nil)
+		if test.wantSetErr {
+			if err == nil {
+				t.Fatalf("%d: missing expected error for value %q", i, test.setValue)
+			}
+		} else {
+			if err != nil {
+				t.Fatalf("%d: could not set new value %q for directed read: %v", i, test.setValue, err)
+			}
+			if res != driver.ResultNoRows {
+				t.Fatalf("%d: result mismatch\nGot: %v\nWant: %v", i, res, driver.ResultNoRows)
+			}
+		}
+
+		it, err := s.ShowDirectedRead(ctx, c, "", nil)
+		if err != nil {
+			t.Fatalf("%d: could not get current directed read value from connection: %v", i, err)
+		}
+		values := make([]driver.Value, len(it.Columns()))
+		if err := it.Next(values); err != nil {
+			t.Fatalf("%d: failed to get first row for directed read: %v", i, err)
+		}
+		if test.wantValue == nil {
+			if values[0] != nil {
+				t.Fatalf("%d: directed read value mismatch\nGot: %v\nWant: nil", i, values[0])
+			}
+			continue
+		}
+		got := &sppb.DirectedReadOptions{}
+		if err := protojson.Unmarshal([]byte(values[0].(string)), got); err != nil {
+			t.Fatalf("%d: failed to parse directed read value %v: %v", i, values[0], err)
+		}
+		if !proto.Equal(got, test.wantValue) {
+			t.Fatalf("%d: directed read value mismatch\nGot: %v\nWant: %v", i, got, test.wantValue)
+		}
+	}
+}
+
 func TestShowCommitTimestamp(t *testing.T) {
 	t.Parallel()
 
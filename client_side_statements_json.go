@@ -51,6 +51,86 @@ var jsonFile = `{
       "method": "statementShowReadOnlyStaleness",
       "exampleStatements": ["show variable read_only_staleness"]
     },
+    {
+      "name": "SHOW VARIABLE STATEMENT_TIMEOUT",
+      "executorName": "ClientSideStatementNoParamExecutor",
+      "resultType": "RESULT_SET",
+      "regex": "(?is)\\A\\s*show\\s+variable\\s+statement_timeout\\s*\\z",
+      "method": "statementShowStatementTimeout",
+      "exampleStatements": ["show variable statement_timeout"]
+    },
+    {
+      "name": "SHOW VARIABLE MAX_COMMIT_DELAY",
+      "executorName": "ClientSideStatementNoParamExecutor",
+      "resultType": "RESULT_SET",
+      "regex": "(?is)\\A\\s*show\\s+variable\\s+max_commit_delay\\s*\\z",
+      "method": "statementShowMaxCommitDelay",
+      "exampleStatements": ["show variable max_commit_delay"]
+    },
+    {
+      "name": "SHOW VARIABLE DIRECTED_READ",
+      "executorName": "ClientSideStatementNoParamExecutor",
+      "resultType": "RESULT_SET",
+      "regex": "(?is)\\A\\s*show\\s+variable\\s+directed_read\\s*\\z",
+      "method": "statementShowDirectedRead",
+      "exampleStatements": ["show variable directed_read"]
+    },
+    {
+      "name": "SHOW VARIABLE DML_AS_MUTATIONS",
+      "executorName": "ClientSideStatementNoParamExecutor",
+      "resultType": "RESULT_SET",
+      "regex": "(?is)\\A\\s*show\\s+variable\\s+dml_as_mutations\\s*\\z",
+      "method": "statementShowDmlAsMutations",
+      "exampleStatements": ["show variable dml_as_mutations"]
+    },
+    {
+      "name": "SHOW VARIABLE DECODE_MODE",
+      "executorName": "ClientSideStatementNoParamExecutor",
+      "resultType": "RESULT_SET",
+      "regex": "(?is)\\A\\s*show\\s+variable\\s+decode_mode\\s*\\z",
+      "method": "statementShowDecodeMode",
+      "exampleStatements": ["show variable decode_mode"]
+    },
+    {
+      "name": "SHOW VARIABLE QUERY_STATS",
+      "executorName": "ClientSideStatementNoParamExecutor",
+      "resultType": "RESULT_SET",
+      "regex": "(?is)\\A\\s*show\\s+variable\\s+query_stats\\s*\\z",
+      "method": "statementShowQueryStats",
+      "exampleStatements": ["show variable query_stats"]
+    },
+    {
+      "name": "SHOW VARIABLE OPTIMIZER_VERSION",
+      "executorName": "ClientSideStatementNoParamExecutor",
+      "resultType": "RESULT_SET",
+      "regex": "(?is)\\A\\s*show\\s+variable\\s+optimizer_version\\s*\\z",
+      "method": "statementShowOptimizerVersion",
+      "exampleStatements": ["show variable optimizer_version"]
+    },
+    {
+      "name": "SHOW VARIABLE OPTIMIZER_STATISTICS_PACKAGE",
+      "executorName": "ClientSideStatementNoParamExecutor",
+      "resultType": "RESULT_SET",
+      "regex": "(?is)\\A\\s*show\\s+variable\\s+optimizer_statistics_package\\s*\\z",
+      "method": "statementShowOptimizerStatisticsPackage",
+      "exampleStatements": ["show variable optimizer_statistics_package"]
+    },
+    {
+      "name": "EXPLAIN ANALYZE <sql>",
+      "executorName": "ClientSideStatementExplainExecutor",
+      "resultType": "RESULT_SET",
+      "regex": "(?is)\\A\\s*explain\\s+analyze\\s+(.+)\\z",
+      "method": "statementExplainAnalyze",
+      "exampleStatements": ["explain analyze select * from foo"]
+    },
+    {
+      "name": "EXPLAIN <sql>",
+      "executorName": "ClientSideStatementExplainExecutor",
+      "resultType": "RESULT_SET",
+      "regex": "(?is)\\A\\s*explain\\s+(.+)\\z",
+      "method": "statementExplain",
+      "exampleStatements": ["explain select * from foo"]
+    },
     {
       "name": "START BATCH DDL",
       "executorName": "ClientSideStatementNoParamExecutor",
@@ -141,6 +221,104 @@ var jsonFile = `{
         "allowedValues": "'((STRONG)|(MIN_READ_TIMESTAMP)[\\t ]+((\\d{4})-(\\d{2})-(\\d{2})([Tt](\\d{2}):(\\d{2}):(\\d{2})(\\.\\d{1,9})?)([Zz]|([+-])(\\d{2}):(\\d{2})))|(READ_TIMESTAMP)[\\t ]+((\\d{4})-(\\d{2})-(\\d{2})([Tt](\\d{2}):(\\d{2}):(\\d{2})(\\.\\d{1,9})?)([Zz]|([+-])(\\d{2}):(\\d{2})))|(MAX_STALENESS)[\\t ]+((\\d{1,19})(s|ms|us|ns))|(EXACT_STALENESS)[\\t ]+((\\d{1,19})(s|ms|us|ns)))'",
         "converterName": "ClientSideStatementValueConverters$ReadOnlyStalenessConverter"
       }
+    },
+    {
+      "name": "SET STATEMENT_TIMEOUT = '<duration>'|NULL",
+      "executorName": "ClientSideStatementSetExecutor",
+      "resultType": "NO_RESULT",
+      "regex": "(?is)\\A\\s*set\\s+statement_timeout\\s*(?:=)\\s*(.*)\\z",
+      "method": "statementSetStatementTimeout",
+      "exampleStatements": ["set statement_timeout=null", "set statement_timeout='1s'", "set statement_timeout='100ms'", "set statement_timeout='10000us'", "set statement_timeout='9223372036854775807ns'"],
+      "setStatement": {
+        "propertyName": "STATEMENT_TIMEOUT",
+        "separator": "=",
+        "allowedValues": "('(\\d{1,19})(s|ms|us|ns)'|NULL)",
+        "converterName": "ClientSideStatementValueConverters$DurationConverter"
+      }
+    },
+    {
+      "name": "SET MAX_COMMIT_DELAY = '<duration>'|NULL",
+      "executorName": "ClientSideStatementSetExecutor",
+      "resultType": "NO_RESULT",
+      "regex": "(?is)\\A\\s*set\\s+max_commit_delay\\s*(?:=)\\s*(.*)\\z",
+      "method": "statementSetMaxCommitDelay",
+      "exampleStatements": ["set max_commit_delay=null", "set max_commit_delay='1s'", "set max_commit_delay='100ms'", "set max_commit_delay='10000us'", "set max_commit_delay='9223372036854775807ns'"],
+      "setStatement": {
+        "propertyName": "MAX_COMMIT_DELAY",
+        "separator": "=",
+        "allowedValues": "('(\\d{1,19})(s|ms|us|ns)'|NULL)",
+        "converterName": "ClientSideStatementValueConverters$DurationConverter"
+      }
+    },
+    {
+      "name": "SET DIRECTED_READ = '<json>'|NULL",
+      "executorName": "ClientSideStatementSetExecutor",
+      "resultType": "NO_RESULT",
+      "regex": "(?is)\\A\\s*set\\s+directed_read\\s*(?:=)\\s*(.*)\\z",
+      "method": "statementSetDirectedRead",
+      "exampleStatements": ["set directed_read=null", "set directed_read=''", "set directed_read='{\"includeReplicas\":{\"replicaSelections\":[{\"location\":\"us-east1\"}]}}'"],
+      "setStatement": {
+        "propertyName": "DIRECTED_READ",
+        "separator": "=",
+        "allowedValues": "('.*'|NULL)",
+        "converterName": "ClientSideStatementValueConverters$DirectedReadOptionsConverter"
+      }
+    },
+    {
+      "name": "SET DML_AS_MUTATIONS = TRUE|FALSE",
+      "executorName": "ClientSideStatementSetExecutor",
+      "resultType": "NO_RESULT",
+      "regex": "(?is)\\A\\s*set\\s+dml_as_mutations\\s*(?:=)\\s*(.*)\\z",
+      "method": "statementSetDmlAsMutations",
+      "exampleStatements": ["set dml_as_mutations = true", "set dml_as_mutations = false"],
+      "setStatement": {
+        "propertyName": "DML_AS_MUTATIONS",
+        "separator": "=",
+        "allowedValues": "(TRUE|FALSE)",
+        "converterName": "ClientSideStatementValueConverters$BooleanConverter"
+      }
+    },
+    {
+      "name": "SET DECODE_MODE = 'SPANNER'|'NATIVE'|'GENERIC'",
+      "executorName": "ClientSideStatementSetExecutor",
+      "resultType": "NO_RESULT",
+      "regex": "(?is)\\A\\s*set\\s+decode_mode\\s*(?:=)\\s*(.*)\\z",
+      "method": "statementSetDecodeMode",
+      "exampleStatements": ["set decode_mode='SPANNER'", "set decode_mode='NATIVE'", "set decode_mode='GENERIC'"],
+      "setStatement": {
+        "propertyName": "DECODE_MODE",
+        "separator": "=",
+        "allowedValues": "'(SPANNER|NATIVE|GENERIC)'",
+        "converterName": "ClientSideStatementValueConverters$DecodeModeConverter"
+      }
+    },
+    {
+      "name": "SET OPTIMIZER_VERSION = '<version>'|'LATEST'|''",
+      "executorName": "ClientSideStatementSetExecutor",
+      "resultType": "NO_RESULT",
+      "regex": "(?is)\\A\\s*set\\s+optimizer_version\\s*(?:=)\\s*(.*)\\z",
+      "method": "statementSetOptimizerVersion",
+      "exampleStatements": ["set optimizer_version='1'", "set optimizer_version='latest'", "set optimizer_version=''"],
+      "setStatement": {
+        "propertyName": "OPTIMIZER_VERSION",
+        "separator": "=",
+        "allowedValues": "'((\\d{1,20})|(LATEST)|())'",
+        "converterName": "ClientSideStatementValueConverters$StringValueConverter"
+      }
+    },
+    {
+      "name": "SET OPTIMIZER_STATISTICS_PACKAGE = '<package>'|''",
+      "executorName": "ClientSideStatementSetExecutor",
+      "resultType": "NO_RESULT",
+      "regex": "(?is)\\A\\s*set\\s+optimizer_statistics_package\\s*(?:=)\\s*(.*)\\z",
+      "method": "statementSetOptimizerStatisticsPackage",
+      "exampleStatements": ["set optimizer_statistics_package='auto_20191128_14_47_22UTC'", "set optimizer_statistics_package=''"],
+      "setStatement": {
+        "propertyName": "OPTIMIZER_STATISTICS_PACKAGE",
+        "separator": "=",
+        "allowedValues": "'((\\S+)|())'",
+        "converterName": "ClientSideStatementValueConverters$StringValueConverter"
+      }
     }
   ]
 }
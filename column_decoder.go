@@ -0,0 +1,350 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"database/sql/driver"
+	"encoding/base64"
+	"math"
+	"math/big"
+	"reflect"
+	"strconv"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"cloud.google.com/go/spanner"
+	sppb "google.golang.org/genproto/googleapis/spanner/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// columnDecoder decodes the value of a column in a row to the value that is
+// returned by rows.Next.
+type columnDecoder func(col spanner.GenericColumnValue) (driver.Value, error)
+
+// newColumnDecoders returns a decoder for each column of the given row type.
+// The decoders of scalar types decode the values directly from the protobuf
+// values in the row, without decoding them to Spanner types first.
+func newColumnDecoders(rowType *sppb.StructType, mode DecodeMode) []columnDecoder {
+	decoders := make([]columnDecoder, len(rowType.Fields))
+	for i, f := range rowType.Fields {
+		decoders[i] = newColumnDecoder(f.Type, mode)
+	}
+	return decoders
+}
+
+func newColumnDecoder(t *sppb.Type, mode DecodeMode) columnDecoder {
+	if mode == DecodeModeGeneric {
+		return decodeGeneric
+	}
+	switch t.Code {
+	case sppb.TypeCode_BOOL:
+		return decodeBool
+	case sppb.TypeCode_INT64:
+		return decodeInt64
+	case sppb.TypeCode_FLOAT64:
+		return decodeFloat64
+	case sppb.TypeCode_NUMERIC:
+		return decodeNumeric
+	case sppb.TypeCode_STRING:
+		return decodeString
+	case sppb.TypeCode_BYTES:
+		return decodeBytes
+	case sppb.TypeCode_DATE:
+		return decodeDate
+	case sppb.TypeCode_TIMESTAMP:
+		return decodeTimestamp
+	case sppb.TypeCode_JSON, sppb.TypeCode_ARRAY:
+		if mode == DecodeModeNative {
+			return decodeNative
+		}
+		return decodeSpannerValue
+	}
+	// TODO: Implement struct
+	return decodeUnsupported
+}
+
+func isNull(v *structpb.Value) bool {
+	_, ok := v.GetKind().(*structpb.Value_NullValue)
+	return ok
+}
+
+// stringValue returns the string value of the given column, and an error if
+// the value is not a string.
+func stringValue(col spanner.GenericColumnValue) (string, error) {
+	if v, ok := col.Value.GetKind().(*structpb.Value_StringValue); ok {
+		return v.StringValue, nil
+	}
+	return "", decodeError(col)
+}
+
+func decodeError(col spanner.GenericColumnValue) error {
+	return spanner.ToSpannerError(status.Errorf(codes.FailedPrecondition, "cannot decode %v as %v", col.Value, col.Type.GetCode()))
+}
+
+func decodeGeneric(col spanner.GenericColumnValue) (driver.Value, error) {
+	return col, nil
+}
+
+func decodeUnsupported(col spanner.GenericColumnValue) (driver.Value, error) {
+	return nil, nil
+}
+
+func decodeBool(col spanner.GenericColumnValue) (driver.Value, error) {
+	switch v := col.Value.GetKind().(type) {
+	case *structpb.Value_NullValue:
+		return nil, nil
+	case *structpb.Value_BoolValue:
+		return v.BoolValue, nil
+	}
+	return nil, decodeError(col)
+}
+
+func decodeInt64(col spanner.GenericColumnValue) (driver.Value, error) {
+	if isNull(col.Value) {
+		return nil, nil
+	}
+	s, err := stringValue(col)
+	if err != nil {
+		return nil, err
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return nil, decodeError(col)
+	}
+	return v, nil
+}
+
+func decodeFloat64(col spanner.GenericColumnValue) (driver.Value, error) {
+	switch v := col.Value.GetKind().(type) {
+	case *structpb.Value_NullValue:
+		return nil, nil
+	case *structpb.Value_NumberValue:
+		return v.NumberValue, nil
+	case *structpb.Value_StringValue:
+		// Spanner encodes special float values as strings.
+		switch v.StringValue {
+		case "NaN":
+			return math.NaN(), nil
+		case "Infinity":
+			return math.Inf(1), nil
+		case "-Infinity":
+			return math.Inf(-1), nil
+		}
+	}
+	return nil, decodeError(col)
+}
+
+func decodeNumeric(col spanner.GenericColumnValue) (driver.Value, error) {
+	if isNull(col.Value) {
+		return nil, nil
+	}
+	s, err := stringValue(col)
+	if err != nil {
+		return nil, err
+	}
+	v, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, decodeError(col)
+	}
+	return *v, nil
+}
+
+func decodeString(col spanner.GenericColumnValue) (driver.Value, error) {
+	if isNull(col.Value) {
+		return nil, nil
+	}
+	return stringValue(col)
+}
+
+func decodeBytes(col spanner.GenericColumnValue) (driver.Value, error) {
+	// NULL values are returned as a nil byte slice.
+	if isNull(col.Value) {
+		return []byte(nil), nil
+	}
+	// The column value is a base64 encoded string.
+	s, err := stringValue(col)
+	if err != nil {
+		return nil, err
+	}
+	v, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, decodeError(col)
+	}
+	return v, nil
+}
+
+func decodeDate(col spanner.GenericColumnValue) (driver.Value, error) {
+	if isNull(col.Value) {
+		return nil, nil
+	}
+	s, err := stringValue(col)
+	if err != nil {
+		return nil, err
+	}
+	v, err := civil.ParseDate(s)
+	if err != nil {
+		return nil, decodeError(col)
+	}
+	return v, nil
+}
+
+func decodeTimestamp(col spanner.GenericColumnValue) (driver.Value, error) {
+	if isNull(col.Value) {
+		return nil, nil
+	}
+	s, err := stringValue(col)
+	if err != nil {
+		return nil, err
+	}
+	v, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return nil, decodeError(col)
+	}
+	return v, nil
+}
+
+// decodeSpannerValue decodes JSON and ARRAY values to the corresponding
+// Spanner types.
+func decodeSpannerValue(col spanner.GenericColumnValue) (driver.Value, error) {
+	var v interface{}
+	switch col.Type.Code {
+	case sppb.TypeCode_JSON:
+		// JSON values are always returned as a NullJSON, also for NULL values,
+		// because there is no native type for JSON in the Go sql package.
+		v = &spanner.NullJSON{}
+	case sppb.TypeCode_ARRAY:
+		switch col.Type.ArrayElementType.Code {
+		case sppb.TypeCode_INT64:
+			v = &[]spanner.NullInt64{}
+		case sppb.TypeCode_FLOAT64:
+			v = &[]spanner.NullFloat64{}
+		case sppb.TypeCode_NUMERIC:
+			v = &[]spanner.NullNumeric{}
+		case sppb.TypeCode_STRING:
+			v = &[]spanner.NullString{}
+		case sppb.TypeCode_JSON:
+			v = &[]spanner.NullJSON{}
+		case sppb.TypeCode_BYTES:
+			v = &[][]byte{}
+		case sppb.TypeCode_BOOL:
+			v = &[]spanner.NullBool{}
+		case sppb.TypeCode_DATE:
+			v = &[]spanner.NullDate{}
+		case sppb.TypeCode_TIMESTAMP:
+			v = &[]spanner.NullTime{}
+		default:
+			return nil, nil
+		}
+	default:
+		return nil, nil
+	}
+	if err := col.Decode(v); err != nil {
+		return nil, err
+	}
+	return reflect.ValueOf(v).Elem().Interface(), nil
+}
+
+// decodeNative decodes JSON and ARRAY values to plain Go types. JSON values
+// are returned as strings and arrays are returned as slices of the plain Go
+// type of the element type. NULL elements in an array are decoded to the zero
+// value of the element type, except in arrays of bytes, where a NULL element
+// is decoded to a nil byte slice.
+func decodeNative(col spanner.GenericColumnValue) (driver.Value, error) {
+	if _, isNull := col.Value.GetKind().(*structpb.Value_NullValue); isNull {
+		return nil, nil
+	}
+	if col.Type.Code == sppb.TypeCode_JSON {
+		return col.Value.GetStringValue(), nil
+	}
+	col = replaceNullElements(col)
+	var v interface{}
+	switch col.Type.ArrayElementType.Code {
+	case sppb.TypeCode_INT64:
+		v = &[]int64{}
+	case sppb.TypeCode_FLOAT64:
+		v = &[]float64{}
+	case sppb.TypeCode_NUMERIC:
+		v = &[]big.Rat{}
+	case sppb.TypeCode_STRING:
+		v = &[]string{}
+	case sppb.TypeCode_JSON:
+		values := col.Value.GetListValue().GetValues()
+		res := make([]string, len(values))
+		for i, value := range values {
+			res[i] = value.GetStringValue()
+		}
+		return res, nil
+	case sppb.TypeCode_BYTES:
+		v = &[][]byte{}
+	case sppb.TypeCode_BOOL:
+		v = &[]bool{}
+	case sppb.TypeCode_DATE:
+		v = &[]civil.Date{}
+	case sppb.TypeCode_TIMESTAMP:
+		v = &[]time.Time{}
+	default:
+		return nil, spanner.ToSpannerError(status.Errorf(codes.Unimplemented, "unsupported array element type: %v", col.Type.ArrayElementType.Code))
+	}
+	if err := col.Decode(v); err != nil {
+		return nil, err
+	}
+	return reflect.ValueOf(v).Elem().Interface(), nil
+}
+
+// replaceNullElements returns a copy of the given array value where each NULL
+// element has been replaced by the zero value of the element type. The value
+// is returned unmodified if it does not contain any NULL elements, or if it is
+// an array of bytes.
+func replaceNullElements(col spanner.GenericColumnValue) spanner.GenericColumnValue {
+	code := col.Type.GetArrayElementType().GetCode()
+	if code == sppb.TypeCode_BYTES {
+		return col
+	}
+	values := col.Value.GetListValue().GetValues()
+	var res []*structpb.Value
+	for i, value := range values {
+		if _, isNull := value.GetKind().(*structpb.Value_NullValue); !isNull {
+			continue
+		}
+		if res == nil {
+			res = make([]*structpb.Value, len(values))
+			copy(res, values)
+		}
+		res[i] = zeroElementValue(code)
+	}
+	if res == nil {
+		return col
+	}
+	return spanner.GenericColumnValue{Type: col.Type, Value: structpb.NewListValue(&structpb.ListValue{Values: res})}
+}
+
+// zeroElementValue returns the encoded zero value of the given element type.
+func zeroElementValue(code sppb.TypeCode) *structpb.Value {
+	switch code {
+	case sppb.TypeCode_BOOL:
+		return structpb.NewBoolValue(false)
+	case sppb.TypeCode_FLOAT64:
+		return structpb.NewNumberValue(0)
+	case sppb.TypeCode_INT64, sppb.TypeCode_NUMERIC:
+		return structpb.NewStringValue("0")
+	case sppb.TypeCode_DATE:
+		return structpb.NewStringValue("0001-01-01")
+	case sppb.TypeCode_TIMESTAMP:
+		return structpb.NewStringValue("0001-01-01T00:00:00Z")
+	}
+	return structpb.NewStringValue("")
+}
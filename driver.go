@@ -19,7 +19,9 @@ import (
 	"database/sql"
 	"database/sql/driver"
 	"fmt"
+	"math"
 	"math/big"
+	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
@@ -30,11 +32,14 @@ import (
 	"cloud.google.com/go/civil"
 	"cloud.google.com/go/spanner"
 	adminapi "cloud.google.com/go/spanner/admin/database/apiv1"
+	sppb "cloud.google.com/go/spanner/apiv1/spannerpb"
+	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 	adminpb "google.golang.org/genproto/googleapis/spanner/admin/database/v1"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
 )
 
 const userAgent = "go-sql-spanner/0.1"
@@ -51,6 +56,33 @@ const userAgent = "go-sql-spanner/0.1"
 //                    to true to connect to local mock servers that do not use SSL.
 //    - retryAbortsInternally: Boolean that indicates whether the connection should automatically retry aborted errors.
 //                             The default is true.
+//    - statement_timeout: The maximum duration that a single statement may run, for example `10s`. Statements that
+//                         exceed the timeout fail with ErrStatementTimeout. The default is no timeout.
+//    - max_commit_delay: The maximum duration that Spanner may delay the commit of a read/write transaction to
+//                        increase throughput, for example `100ms`. The default is no commit delay.
+//    - directed_read: JSON representation of the DirectedReadOptions that should be used for queries in autocommit
+//                     mode and in read-only transactions, for example `{"includeReplicas":{"replicaSelections":[{"location":"us-east1"}]}}`.
+//                     The directed read options are ignored in read/write transactions.
+//    - dml_as_mutations: Boolean that indicates whether simple single-row INSERT, UPDATE and DELETE statements in
+//                        read/write transactions should be buffered as mutations instead of being executed as DML.
+//                        The default is false. See SpannerConn.SetDmlAsMutations for more information.
+//    - decode_mode: The mode that is used to decode query results. The supported values are `spanner` (the default),
+//                   `native` and `generic`. See DecodeMode for more information.
+//    - optimizer_version: The query optimizer version to use for queries, for example `5` or `latest`. The default
+//                         is the default version of the database.
+//    - optimizer_statistics_package: The query optimizer statistics package to use for queries. The default is the
+//                                    default statistics package of the database.
+//    - prefetch_rows: The maximum number of rows that are read ahead in a background goroutine for queries outside
+//                     read/write transactions. The default is 0, which disables prefetching.
+//    - prefetch_bytes: The maximum approximate number of bytes that are read ahead when prefetching is enabled.
+//                      The default is 0, which means that the buffer is only bounded by prefetch_rows.
+//    - analyze_prepared_statements: Boolean that indicates whether prepared queries should be analyzed in PLAN mode
+//                                   when they are prepared. The parameter types that are returned by Spanner are
+//                                   used to validate the arguments of each execution. The default is false.
+//    - max_mutations_per_commit: The maximum number of mutations that a mutation batch writes in one commit. The
+//                                default is 1000. Lower the value for tables with more than 80 column values per
+//                                mutation, including index entries. See SpannerConn.SetMaxMutationsPerCommit for
+//                                more information.
 // Example: `localhost:9010/projects/test-project/instances/test-instance/databases/test-database;usePlainText=true`
 var dsnRegExp = regexp.MustCompile("((?P<HOSTGROUP>[\\w.-]+(?:\\.[\\w\\.-]+)*[\\w\\-\\._~:/?#\\[\\]@!\\$&'\\(\\)\\*\\+,;=.]+)/)?projects/(?P<PROJECTGROUP>(([a-z]|[-.:]|[0-9])+|(DEFAULT_PROJECT_ID)))(/instances/(?P<INSTANCEGROUP>([a-z]|[-]|[0-9])+)(/databases/(?P<DATABASEGROUP>([a-z]|[-]|[_]|[0-9])+))?)?(([\\?|;])(?P<PARAMSGROUP>.*))?")
 
@@ -152,6 +184,55 @@ type connector struct {
 	// propagated to the caller. This option is enabled by default.
 	retryAbortsInternally bool
 
+	// statementTimeout is the default statement timeout for connections that
+	// are created by this connector. A zero value means no timeout.
+	statementTimeout time.Duration
+
+	// maxCommitDelay is the default max commit delay for connections that are
+	// created by this connector. A zero value means no commit delay.
+	maxCommitDelay time.Duration
+
+	// directedReadOptions are the default directed read options for
+	// connections that are created by this connector.
+	directedReadOptions *sppb.DirectedReadOptions
+
+	// dmlAsMutations determines whether simple DML statements in read/write
+	// transactions are buffered as mutations for connections that are
+	// created by this connector.
+	dmlAsMutations bool
+
+	// decodeMode is the default mode for decoding query results for
+	// connections that are created by this connector.
+	decodeMode DecodeMode
+
+	// optimizerVersion and optimizerStatisticsPackage are the default query
+	// optimizer options for connections that are created by this connector.
+	optimizerVersion           string
+	optimizerStatisticsPackage string
+
+	// prefetchRows and prefetchBytes bound the buffer of rows that are read
+	// ahead in the background for connections that are created by this
+	// connector. Prefetching is disabled if prefetchRows is zero.
+	prefetchRows  int
+	prefetchBytes int64
+
+	// analyzePreparedStatements determines whether connections that are
+	// created by this connector analyze prepared queries in PLAN mode.
+	analyzePreparedStatements bool
+
+	// maxMutationsPerCommit is the default maximum number of mutations in
+	// each commit of a mutation batch for connections that are created by
+	// this connector.
+	maxMutationsPerCommit int
+
+	// primaryKeys caches the primary key columns of the tables that are used
+	// in DML statements that are converted to mutations. The cache is cleared
+	// when a DDL statement is executed on a connection of the connector.
+	// dialect caches the dialect of the database.
+	primaryKeysMu sync.Mutex
+	primaryKeys   map[string][]string
+	dialect       adminpb.DatabaseDialect
+
 	initClient     sync.Once
 	client         *spanner.Client
 	clientErr      error
@@ -189,6 +270,62 @@ func newConnector(d *Driver, dsn string) (*connector, error) {
 			retryAbortsInternally = false
 		}
 	}
+	var statementTimeout time.Duration
+	if strval, ok := connectorConfig.params["statement_timeout"]; ok {
+		if val, err := time.ParseDuration(strval); err == nil && val > 0 {
+			statementTimeout = val
+		}
+	}
+	var maxCommitDelay time.Duration
+	if strval, ok := connectorConfig.params["max_commit_delay"]; ok {
+		if val, err := time.ParseDuration(strval); err == nil && val > 0 {
+			maxCommitDelay = val
+		}
+	}
+	var directedReadOptions *sppb.DirectedReadOptions
+	if strval, ok := connectorConfig.params["directed_read"]; ok {
+		if directedReadOptions, err = parseDirectedReadOptions(strval); err != nil {
+			return nil, err
+		}
+	}
+	var dmlAsMutations bool
+	if strval, ok := connectorConfig.params["dml_as_mutations"]; ok {
+		if val, err := strconv.ParseBool(strval); err == nil {
+			dmlAsMutations = val
+		}
+	}
+	var decodeMode DecodeMode
+	if strval, ok := connectorConfig.params["decode_mode"]; ok {
+		if decodeMode, err = parseDecodeMode(strval); err != nil {
+			return nil, err
+		}
+	}
+	optimizerVersion := connectorConfig.params["optimizer_version"]
+	optimizerStatisticsPackage := connectorConfig.params["optimizer_statistics_package"]
+	var prefetchRows int
+	if strval, ok := connectorConfig.params["prefetch_rows"]; ok {
+		if val, err := strconv.Atoi(strval); err == nil && val > 0 {
+			prefetchRows = val
+		}
+	}
+	var prefetchBytes int64
+	if strval, ok := connectorConfig.params["prefetch_bytes"]; ok {
+		if val, err := strconv.ParseInt(strval, 10, 64); err == nil && val > 0 {
+			prefetchBytes = val
+		}
+	}
+	var analyzePreparedStatements bool
+	if strval, ok := connectorConfig.params["analyze_prepared_statements"]; ok {
+		if val, err := strconv.ParseBool(strval); err == nil {
+			analyzePreparedStatements = val
+		}
+	}
+	maxMutationsPerCommit := defaultMaxMutationsPerCommit
+	if strval, ok := connectorConfig.params["max_mutations_per_commit"]; ok {
+		if val, err := strconv.Atoi(strval); err == nil && val > 0 {
+			maxMutationsPerCommit = val
+		}
+	}
 	config := spanner.ClientConfig{
 		SessionPoolConfig: spanner.DefaultSessionPoolConfig,
 	}
@@ -208,12 +345,23 @@ func newConnector(d *Driver, dsn string) (*connector, error) {
 		}
 	}
 	c := &connector{
-		driver:                d,
-		dsn:                   dsn,
-		connectorConfig:       connectorConfig,
-		spannerClientConfig:   config,
-		options:               opts,
-		retryAbortsInternally: retryAbortsInternally,
+		driver:                     d,
+		dsn:                        dsn,
+		connectorConfig:            connectorConfig,
+		spannerClientConfig:        config,
+		options:                    opts,
+		retryAbortsInternally:      retryAbortsInternally,
+		statementTimeout:           statementTimeout,
+		maxCommitDelay:             maxCommitDelay,
+		directedReadOptions:        directedReadOptions,
+		dmlAsMutations:             dmlAsMutations,
+		decodeMode:                 decodeMode,
+		optimizerVersion:           optimizerVersion,
+		optimizerStatisticsPackage: optimizerStatisticsPackage,
+		prefetchRows:               prefetchRows,
+		prefetchBytes:              prefetchBytes,
+		analyzePreparedStatements:  analyzePreparedStatements,
+		maxMutationsPerCommit:      maxMutationsPerCommit,
 	}
 	d.connectors[dsn] = c
 	return c, nil
@@ -248,6 +396,17 @@ func openDriverConn(ctx context.Context, c *connector) (driver.Conn, error) {
 		adminClient:                c.adminClient,
 		database:                   databaseName,
 		retryAborts:                c.retryAbortsInternally,
+		statementTimeout:           c.statementTimeout,
+		maxCommitDelay:             c.maxCommitDelay,
+		directedReadOptions:        c.directedReadOptions,
+		dmlAsMutations:             c.dmlAsMutations,
+		decodeMode:                 c.decodeMode,
+		optimizerVersion:           c.optimizerVersion,
+		optimizerStatisticsPackage: c.optimizerStatisticsPackage,
+		prefetchRows:               c.prefetchRows,
+		prefetchBytes:              c.prefetchBytes,
+		analyzePreparedStatements:  c.analyzePreparedStatements,
+		maxMutationsPerCommit:      c.maxMutationsPerCommit,
 		execSingleQuery:            queryInSingleUse,
 		execSingleDMLTransactional: execInNewRWTransaction,
 		execSingleDMLPartitioned:   execAsPartitionedDML,
@@ -282,16 +441,65 @@ type SpannerConn interface {
 	// be returned to the application, and the application can decide whether
 	// to commit or rollback the transaction.
 	StartBatchDML() error
-	// RunBatch sends all batched DDL or DML statements to Spanner. This is a
-	// no-op if no statements have been batched or if there is no active batch.
+	// StartBatchMutations starts a mutation batch on the connection. After
+	// calling this method all mutations that are passed to Apply or BufferWrite
+	// will be buffered locally. Calling RunBatch or RunMutationBatch will write
+	// the buffered mutations to Spanner in one or more commits. Each commit
+	// contains at most MaxMutationsPerCommit mutations. Use a mutation batch to
+	// efficiently load large amounts of data in autocommit mode.
+	// Spanner rejects a commit with more than 80,000 column values, counting
+	// the values that are written to secondary indexes. The driver cannot
+	// count those values, and only limits the number of mutations in each
+	// commit. Use SetMaxMutationsPerCommit to lower the limit for mutations
+	// that write more than 80 values each.
+	// Note that a mutation batch is not atomic if it is written in more than
+	// one commit. A mutation batch can only be started when the connection
+	// does not have an active transaction.
+	StartBatchMutations() error
+	// RunBatch sends all batched DDL or DML statements or mutations to
+	// Spanner. This is a no-op if no statements have been batched or if there
+	// is no active batch.
 	RunBatch(ctx context.Context) error
-	// AbortBatch aborts the current DDL or DML batch and discards all batched
-	// statements.
+	// RunMutationBatch writes all buffered mutations of the current mutation
+	// batch to Spanner and returns the commit timestamp of each commit that
+	// was used to write the mutations. Each commit contains at most
+	// MaxMutationsPerCommit mutations, see StartBatchMutations for the limits
+	// that apply. If one of the commits fails, the timestamps of the commits
+	// that succeeded are returned together with a *MutationBatchError that
+	// contains the mutations that were not written. The mutation batch is
+	// ended in all cases, and the application can write the remaining
+	// mutations in a new mutation batch.
+	RunMutationBatch(ctx context.Context) ([]time.Time, error)
+	// AbortBatch aborts the current DDL, DML or mutation batch and discards
+	// all batched statements and mutations.
 	AbortBatch() error
 	// InDDLBatch returns true if the connection is currently in a DDL batch.
 	InDDLBatch() bool
 	// InDMLBatch returns true if the connection is currently in a DML batch.
 	InDMLBatch() bool
+	// InMutationBatch returns true if the connection is currently in a
+	// mutation batch.
+	InMutationBatch() bool
+	// MaxMutationsPerCommit returns the maximum number of mutations that a
+	// mutation batch writes in one commit.
+	MaxMutationsPerCommit() int
+	// SetMaxMutationsPerCommit sets the maximum number of mutations that a
+	// mutation batch writes in one commit. Each mutation is counted as one,
+	// regardless of the number of columns that it writes. Spanner limits the
+	// number of mutations in a commit to 80,000, where Spanner counts each
+	// column value that is written, including the values that are written to
+	// secondary indexes, as one mutation. The default of 1000 stays within
+	// that limit as long as each mutation writes at most 80 values, including
+	// index entries. Lower the value for tables with many columns or indexes.
+	SetMaxMutationsPerCommit(n int) error
+	// ExecScript executes all statements in the given sql script. The
+	// statements in the script must be separated by semicolons. Consecutive
+	// DDL statements are executed as one DDL batch, and consecutive DML
+	// statements are executed as one DML batch. The script stops at the first
+	// statement that fails, and the returned error is a *ScriptError that
+	// contains the failed statement. Statements that have already been
+	// executed are not rolled back.
+	ExecScript(ctx context.Context, script string) error
 
 	// RetryAbortsInternally returns true if the connection automatically
 	// retries all aborted transactions.
@@ -318,13 +526,126 @@ type SpannerConn interface {
 	// mode and for read-only transaction.
 	SetReadOnlyStaleness(staleness spanner.TimestampBound) error
 
+	// StatementTimeout returns the current statement timeout of the
+	// connection. A zero value means that statements do not time out.
+	StatementTimeout() time.Duration
+	// SetStatementTimeout sets the maximum duration that a single query, DML
+	// statement, DDL statement or batch may run on this connection. Statements
+	// that exceed the timeout return ErrStatementTimeout. Set the timeout to
+	// zero to disable it.
+	SetStatementTimeout(timeout time.Duration) error
+
+	// MaxCommitDelay returns the current max commit delay of the connection.
+	// A zero value means that commits are not delayed.
+	MaxCommitDelay() time.Duration
+	// SetMaxCommitDelay sets the maximum duration that Spanner may delay the
+	// commit of read/write transactions on this connection in order to
+	// increase throughput. The delay is applied to transactions that are
+	// started after calling this method, to DML statements in autocommit mode,
+	// and to Apply. Set the delay to zero to disable it.
+	// See https://cloud.google.com/spanner/docs/throughput-optimized-writes
+	// for more information.
+	SetMaxCommitDelay(delay time.Duration) error
+
+	// DirectedReadOptions returns the directed read options that are used for
+	// queries in autocommit mode and in read-only transactions.
+	DirectedReadOptions() *sppb.DirectedReadOptions
+	// SetDirectedReadOptions sets the directed read options to use for queries
+	// in autocommit mode and in read-only transactions. Directed reads are not
+	// supported for read/write transactions, and the options are ignored by
+	// read/write transactions. This method returns an error if the connection
+	// has an active read/write transaction. Set the options to nil to let
+	// Spanner choose the replica to read from.
+	// See https://cloud.google.com/spanner/docs/directed-reads for more
+	// information.
+	SetDirectedReadOptions(options *sppb.DirectedReadOptions) error
+
+	// DmlAsMutations returns true if the connection buffers simple DML
+	// statements in read/write transactions as mutations.
+	DmlAsMutations() bool
+	// SetDmlAsMutations sets whether simple single-row INSERT, UPDATE and
+	// DELETE statements in read/write transactions should be buffered as
+	// mutations instead of being executed as DML statements. This saves one
+	// round trip to Spanner for each statement. Statements are only converted
+	// if all values are given as query parameters, for example
+	// `INSERT INTO Singers (SingerId, Name) VALUES (@id, @name)`,
+	// `UPDATE Singers SET Name=@name WHERE SingerId=@id` and
+	// `DELETE FROM Singers WHERE SingerId=@id`. The driver reads the primary
+	// key of the table from INFORMATION_SCHEMA, and only converts UPDATE and
+	// DELETE statements with a WHERE clause that consists of exactly one
+	// equality condition for each primary key column. Other statements are
+	// executed as DML statements, also if the primary key cannot be read. The
+	// primary keys are cached until a DDL statement is executed through the
+	// same database handle. Tables that are recreated by other processes
+	// with a different primary key require a new database handle.
+	//
+	// The update count of a statement that is buffered as a mutation is
+	// always 1, also if the statement would not have modified any rows.
+	// Mutations are only applied when the transaction is committed, which
+	// means that the transaction cannot read its own buffered writes, and that
+	// errors are returned by Commit instead of by the statement. This includes
+	// constraint violations, inserts of rows that already exist, and updates of
+	// rows that do not exist, which fail with NOT_FOUND instead of updating
+	// zero rows.
+	SetDmlAsMutations(dmlAsMutations bool) error
+
+	// DecodeMode returns the mode that is used to decode the results of
+	// queries that are executed on this connection.
+	DecodeMode() DecodeMode
+	// SetDecodeMode sets the mode that is used to decode the results of
+	// queries that are executed on this connection. The mode is applied to
+	// queries that are executed after calling this method.
+	SetDecodeMode(mode DecodeMode) error
+
+	// OptimizerVersion returns the query optimizer version that is used for
+	// queries on this connection. An empty string means that the default
+	// version of the database is used.
+	OptimizerVersion() string
+	// SetOptimizerVersion sets the query optimizer version to use for queries
+	// on this connection, for example "5" or "latest". Set the version to an
+	// empty string to use the default version of the database.
+	SetOptimizerVersion(version string) error
+	// OptimizerStatisticsPackage returns the query optimizer statistics
+	// package that is used for queries on this connection. An empty string
+	// means that the default statistics package of the database is used.
+	OptimizerStatisticsPackage() string
+	// SetOptimizerStatisticsPackage sets the query optimizer statistics
+	// package to use for queries on this connection. Set the package to an
+	// empty string to use the default statistics package of the database.
+	SetOptimizerStatisticsPackage(statisticsPackage string) error
+
+	// Read reads rows from the given table or index using the Spanner Read API.
+	// The read is executed as a single-use read-only transaction using the
+	// read-only staleness of the connection if the connection is in autocommit
+	// mode, and otherwise as part of the current transaction. Reads in a
+	// read/write transaction are included in the checksum that is used to
+	// verify internal retries of aborted transactions.
+	// Set ReadOptions.Index to read using a secondary index.
+	// See also spanner.ReadOnlyTransaction#ReadWithOptions
+	Read(ctx context.Context, table string, keySet spanner.KeySet, columns []string, opts *spanner.ReadOptions) (driver.Rows, error)
+
 	// Apply writes an array of mutations to the database. This method may only be called while the connection
 	// is outside a transaction. Use BufferWrite to write mutations in a transaction.
+	// ApplyOptions cannot be combined with the max commit delay of the connection, as the
+	// Spanner client does not support a commit delay for Apply. Calling Apply with one or
+	// more ApplyOptions while a max commit delay is set returns a FailedPrecondition error.
+	// The mutations are buffered and a zero commit timestamp is returned if the connection
+	// has an active mutation batch.
 	// See also spanner.Client#Apply
 	Apply(ctx context.Context, ms []*spanner.Mutation, opts ...spanner.ApplyOption) (commitTimestamp time.Time, err error)
 
+	// BatchWrite applies the given mutation groups non-atomically to the
+	// database. Each mutation group is applied atomically, but different
+	// groups may be applied in any order, and some groups may fail while
+	// others succeed. The returned iterator contains the status and commit
+	// timestamp of each group. This method may only be called while the
+	// connection is outside a transaction.
+	// See also spanner.Client#BatchWrite
+	BatchWrite(ctx context.Context, mgs []*spanner.MutationGroup) (*spanner.BatchWriteResponseIterator, error)
+
 	// BufferWrite writes an array of mutations to the current transaction. This method may only be called while the
-	// connection is in a read/write transaction. Use Apply to write mutations outside a transaction.
+	// connection is in a read/write transaction or in a mutation batch. Use Apply to write mutations outside a
+	// transaction.
 	// See also spanner.ReadWriteTransaction#BufferWrite
 	BufferWrite(ms []*spanner.Mutation) error
 
@@ -343,9 +664,12 @@ type conn struct {
 	commitTs    *time.Time
 	database    string
 	retryAborts bool
+	// queryStats contains the statistics of the last query that returned
+	// statistics on this connection.
+	queryStats *sppb.ResultSetStats
 
-	execSingleQuery            func(ctx context.Context, c *spanner.Client, statement spanner.Statement, bound spanner.TimestampBound) *spanner.RowIterator
-	execSingleDMLTransactional func(ctx context.Context, c *spanner.Client, statement spanner.Statement) (int64, time.Time, error)
+	execSingleQuery            func(ctx context.Context, c *spanner.Client, statement spanner.Statement, bound spanner.TimestampBound, options spanner.QueryOptions) *spanner.RowIterator
+	execSingleDMLTransactional func(ctx context.Context, c *spanner.Client, statement spanner.Statement, options spanner.TransactionOptions) (int64, spanner.CommitResponse, error)
 	execSingleDMLPartitioned   func(ctx context.Context, c *spanner.Client, statement spanner.Statement) (int64, error)
 
 	// batch is the currently active DDL or DML batch on this connection.
@@ -358,6 +682,36 @@ type conn struct {
 	autocommitDMLMode AutocommitDMLMode
 	// readOnlyStaleness is used for queries in autocommit mode and for read-only transactions.
 	readOnlyStaleness spanner.TimestampBound
+	// statementTimeout is the maximum duration that a single statement may
+	// run. A zero value means no timeout.
+	statementTimeout time.Duration
+	// maxCommitDelay is the maximum duration that Spanner may delay the commit
+	// of read/write transactions on this connection. A zero value means that
+	// commits are not delayed.
+	maxCommitDelay time.Duration
+	// directedReadOptions are used for queries in autocommit mode and in
+	// read-only transactions.
+	directedReadOptions *sppb.DirectedReadOptions
+	// dmlAsMutations determines whether simple DML statements in read/write
+	// transactions are buffered as mutations.
+	dmlAsMutations bool
+	// decodeMode determines how query results are decoded.
+	decodeMode DecodeMode
+	// optimizerVersion and optimizerStatisticsPackage are the query optimizer
+	// options that are used for queries. Empty strings mean that the defaults
+	// of the database are used.
+	optimizerVersion           string
+	optimizerStatisticsPackage string
+	// prefetchRows and prefetchBytes bound the buffer of rows that are read
+	// ahead in the background for queries outside read/write transactions.
+	prefetchRows  int
+	prefetchBytes int64
+	// analyzePreparedStatements determines whether prepared queries are
+	// analyzed in PLAN mode to determine the types of their parameters.
+	analyzePreparedStatements bool
+	// maxMutationsPerCommit is the maximum number of mutations in each
+	// commit of a mutation batch.
+	maxMutationsPerCommit int
 }
 
 type batchType int
@@ -365,11 +719,39 @@ type batchType int
 const (
 	ddl batchType = iota
 	dml
+	mutations
 )
 
+// defaultMaxMutationsPerCommit is the default maximum number of mutations in
+// each commit of a mutation batch. Spanner accepts at most 80,000 mutations in
+// a single commit, but counts each column value and each secondary index entry
+// that is written as one mutation. The driver cannot determine that number for
+// a spanner.Mutation, and instead uses a conservative limit on the number of
+// spanner.Mutation values.
+const defaultMaxMutationsPerCommit = 1000
+
+// MutationBatchError is returned by RunMutationBatch and RunBatch if one of
+// the commits of a mutation batch fails. Index is the zero-based index of the
+// first mutation in the batch that was not written, and Mutations contains
+// that mutation and all mutations after it.
+type MutationBatchError struct {
+	Index     int
+	Mutations []*spanner.Mutation
+	Err       error
+}
+
+func (e *MutationBatchError) Error() string {
+	return fmt.Sprintf("mutation %d failed: %v", e.Index+1, e.Err)
+}
+
+func (e *MutationBatchError) Unwrap() error {
+	return e.Err
+}
+
 type batch struct {
 	tp         batchType
 	statements []spanner.Statement
+	mutations  []*spanner.Mutation
 }
 
 // AutocommitDMLMode indicates whether a single DML statement should be executed
@@ -392,6 +774,49 @@ const (
 	PartitionedNonAtomic
 )
 
+// DecodeMode determines how the values in query results are returned by the
+// driver.Rows that are returned by a connection.
+type DecodeMode int
+
+const (
+	// DecodeModeSpanner returns scalar values as plain Go values, NULL values
+	// as nil, JSON values as spanner.NullJSON and arrays as slices of
+	// Spanner null types, for example []spanner.NullInt64. This is the
+	// default.
+	DecodeModeSpanner DecodeMode = iota
+	// DecodeModeNative returns all values as plain Go values. JSON values
+	// are returned as strings, and arrays are returned as plain Go slices,
+	// for example []int64. NULL elements in an array are decoded to the zero
+	// value of the element type, for example 0 for an ARRAY<INT64> and "" for
+	// an ARRAY<JSON>, and to nil for an ARRAY<BYTES>. Use DecodeModeSpanner to
+	// distinguish NULL elements from zero values.
+	DecodeModeNative
+	// DecodeModeGeneric returns all values as spanner.GenericColumnValue.
+	DecodeModeGeneric
+)
+
+func (mode DecodeMode) String() string {
+	switch mode {
+	case DecodeModeSpanner:
+		return "Spanner"
+	case DecodeModeNative:
+		return "Native"
+	case DecodeModeGeneric:
+		return "Generic"
+	}
+	return ""
+}
+
+// parseDecodeMode parses the name of a DecodeMode. The name is case-insensitive.
+func parseDecodeMode(value string) (DecodeMode, error) {
+	for _, mode := range []DecodeMode{DecodeModeSpanner, DecodeModeNative, DecodeModeGeneric} {
+		if strings.EqualFold(value, mode.String()) {
+			return mode, nil
+		}
+	}
+	return 0, spanner.ToSpannerError(status.Errorf(codes.InvalidArgument, "invalid decode mode: %s", value))
+}
+
 func (c *conn) CommitTimestamp() (time.Time, error) {
 	if c.commitTs == nil {
 		return time.Time{}, spanner.ToSpannerError(status.Error(codes.FailedPrecondition, "this connection has not executed a read/write transaction that committed successfully"))
@@ -444,6 +869,178 @@ func (c *conn) setReadOnlyStaleness(staleness spanner.TimestampBound) (driver.Re
 	return driver.ResultNoRows, nil
 }
 
+func (c *conn) StatementTimeout() time.Duration {
+	return c.statementTimeout
+}
+
+func (c *conn) SetStatementTimeout(timeout time.Duration) error {
+	_, err := c.setStatementTimeout(timeout)
+	return err
+}
+
+func (c *conn) setStatementTimeout(timeout time.Duration) (driver.Result, error) {
+	if timeout < 0 {
+		return nil, spanner.ToSpannerError(status.Errorf(codes.InvalidArgument, "statement timeout must not be negative: %v", timeout))
+	}
+	c.statementTimeout = timeout
+	return driver.ResultNoRows, nil
+}
+
+func (c *conn) MaxCommitDelay() time.Duration {
+	return c.maxCommitDelay
+}
+
+func (c *conn) SetMaxCommitDelay(delay time.Duration) error {
+	_, err := c.setMaxCommitDelay(delay)
+	return err
+}
+
+func (c *conn) setMaxCommitDelay(delay time.Duration) (driver.Result, error) {
+	if delay < 0 {
+		return nil, spanner.ToSpannerError(status.Errorf(codes.InvalidArgument, "max commit delay must not be negative: %v", delay))
+	}
+	c.maxCommitDelay = delay
+	return driver.ResultNoRows, nil
+}
+
+func (c *conn) DirectedReadOptions() *sppb.DirectedReadOptions {
+	return c.directedReadOptions
+}
+
+func (c *conn) SetDirectedReadOptions(options *sppb.DirectedReadOptions) error {
+	_, err := c.setDirectedReadOptions(options)
+	return err
+}
+
+func (c *conn) setDirectedReadOptions(options *sppb.DirectedReadOptions) (driver.Result, error) {
+	if c.inReadWriteTransaction() && options != nil {
+		return nil, errDirectedReadInReadWriteTransaction()
+	}
+	c.directedReadOptions = options
+	return driver.ResultNoRows, nil
+}
+
+func errDirectedReadInReadWriteTransaction() error {
+	return spanner.ToSpannerError(status.Error(codes.FailedPrecondition, "directed read options cannot be set while a read/write transaction is active"))
+}
+
+func (c *conn) DmlAsMutations() bool {
+	return c.dmlAsMutations
+}
+
+func (c *conn) SetDmlAsMutations(dmlAsMutations bool) error {
+	_, err := c.setDmlAsMutations(dmlAsMutations)
+	return err
+}
+
+func (c *conn) setDmlAsMutations(dmlAsMutations bool) (driver.Result, error) {
+	c.dmlAsMutations = dmlAsMutations
+	return driver.ResultNoRows, nil
+}
+
+func (c *conn) DecodeMode() DecodeMode {
+	return c.decodeMode
+}
+
+func (c *conn) SetDecodeMode(mode DecodeMode) error {
+	_, err := c.setDecodeMode(mode)
+	return err
+}
+
+func (c *conn) setDecodeMode(mode DecodeMode) (driver.Result, error) {
+	if mode.String() == "" {
+		return nil, spanner.ToSpannerError(status.Errorf(codes.InvalidArgument, "invalid decode mode: %d", mode))
+	}
+	c.decodeMode = mode
+	return driver.ResultNoRows, nil
+}
+
+func (c *conn) OptimizerVersion() string {
+	return c.optimizerVersion
+}
+
+func (c *conn) SetOptimizerVersion(version string) error {
+	_, err := c.setOptimizerVersion(version)
+	return err
+}
+
+func (c *conn) setOptimizerVersion(version string) (driver.Result, error) {
+	c.optimizerVersion = version
+	return driver.ResultNoRows, nil
+}
+
+func (c *conn) OptimizerStatisticsPackage() string {
+	return c.optimizerStatisticsPackage
+}
+
+func (c *conn) SetOptimizerStatisticsPackage(statisticsPackage string) error {
+	_, err := c.setOptimizerStatisticsPackage(statisticsPackage)
+	return err
+}
+
+func (c *conn) setOptimizerStatisticsPackage(statisticsPackage string) (driver.Result, error) {
+	c.optimizerStatisticsPackage = statisticsPackage
+	return driver.ResultNoRows, nil
+}
+
+// parseDirectedReadOptions parses the JSON representation of a
+// DirectedReadOptions proto.
+func parseDirectedReadOptions(value string) (*sppb.DirectedReadOptions, error) {
+	options := &sppb.DirectedReadOptions{}
+	if err := protojson.Unmarshal([]byte(value), options); err != nil {
+		return nil, spanner.ToSpannerError(status.Errorf(codes.InvalidArgument, "invalid directed read options %q: %v", value, err))
+	}
+	return options, nil
+}
+
+// queryOptions returns the options that should be used for queries on this
+// connection. Directed read options are only included for queries that are
+// not executed in a read/write transaction.
+func (c *conn) queryOptions() spanner.QueryOptions {
+	var options spanner.QueryOptions
+	if !c.inReadWriteTransaction() {
+		options.DirectedReadOptions = c.directedReadOptions
+	}
+	if c.optimizerVersion != "" || c.optimizerStatisticsPackage != "" {
+		options.Options = &sppb.ExecuteSqlRequest_QueryOptions{
+			OptimizerVersion:           c.optimizerVersion,
+			OptimizerStatisticsPackage: c.optimizerStatisticsPackage,
+		}
+	}
+	return options
+}
+
+// transactionOptions returns the options that should be used for read/write
+// transactions that are started by this connection.
+func (c *conn) transactionOptions() spanner.TransactionOptions {
+	var options spanner.TransactionOptions
+	if c.maxCommitDelay > 0 {
+		delay := c.maxCommitDelay
+		options.CommitOptions.MaxCommitDelay = &delay
+	}
+	return options
+}
+
+// statementContext returns a context that expires when the statement timeout
+// of the connection is exceeded. The given context is returned unchanged if
+// the connection has no statement timeout.
+func (c *conn) statementContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.statementTimeout == 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, c.statementTimeout)
+}
+
+// statementTimeoutErr returns ErrStatementTimeout if err was caused by the
+// statement timeout of stmtCtx, and not by the deadline or cancellation of
+// the parent context ctx. Any other error is returned unchanged.
+func statementTimeoutErr(ctx, stmtCtx context.Context, err error) error {
+	if err != nil && stmtCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		return ErrStatementTimeout
+	}
+	return err
+}
+
 func (c *conn) StartBatchDDL() error {
 	_, err := c.startBatchDDL()
 	return err
@@ -454,11 +1051,32 @@ func (c *conn) StartBatchDML() error {
 	return err
 }
 
-func (c *conn) RunBatch(ctx context.Context) error {
-	_, err := c.runBatch(ctx)
+func (c *conn) StartBatchMutations() error {
+	_, err := c.startBatchMutations()
 	return err
 }
 
+func (c *conn) RunBatch(ctx context.Context) error {
+	stmtCtx, cancel := c.statementContext(ctx)
+	defer cancel()
+	_, err := c.runBatch(stmtCtx)
+	return statementTimeoutErr(ctx, stmtCtx, err)
+}
+
+func (c *conn) RunMutationBatch(ctx context.Context) ([]time.Time, error) {
+	if !c.InMutationBatch() {
+		return nil, spanner.ToSpannerError(status.Errorf(codes.FailedPrecondition, "This connection does not have an active mutation batch"))
+	}
+	stmtCtx, cancel := c.statementContext(ctx)
+	defer cancel()
+	commitTimestamps, err := c.runMutationBatch(stmtCtx)
+	if batchErr, ok := err.(*MutationBatchError); ok {
+		batchErr.Err = statementTimeoutErr(ctx, stmtCtx, batchErr.Err)
+		return commitTimestamps, batchErr
+	}
+	return commitTimestamps, statementTimeoutErr(ctx, stmtCtx, err)
+}
+
 func (c *conn) AbortBatch() error {
 	_, err := c.abortBatch()
 	return err
@@ -472,8 +1090,24 @@ func (c *conn) InDMLBatch() bool {
 	return (c.batch != nil && c.batch.tp == dml) || (c.inReadWriteTransaction() && c.tx.(*readWriteTransaction).batch != nil)
 }
 
+func (c *conn) InMutationBatch() bool {
+	return c.batch != nil && c.batch.tp == mutations
+}
+
+func (c *conn) MaxMutationsPerCommit() int {
+	return c.maxMutationsPerCommit
+}
+
+func (c *conn) SetMaxMutationsPerCommit(n int) error {
+	if n <= 0 {
+		return spanner.ToSpannerError(status.Errorf(codes.InvalidArgument, "max mutations per commit must be positive: %v", n))
+	}
+	c.maxMutationsPerCommit = n
+	return nil
+}
+
 func (c *conn) inBatch() bool {
-	return c.InDDLBatch() || c.InDMLBatch()
+	return c.InDDLBatch() || c.InDMLBatch() || c.InMutationBatch()
 }
 
 func (c *conn) startBatchDDL() (driver.Result, error) {
@@ -502,6 +1136,17 @@ func (c *conn) startBatchDML() (driver.Result, error) {
 	return driver.ResultNoRows, nil
 }
 
+func (c *conn) startBatchMutations() (driver.Result, error) {
+	if c.batch != nil {
+		return nil, spanner.ToSpannerError(status.Errorf(codes.FailedPrecondition, "This connection already has an active batch."))
+	}
+	if c.inTransaction() {
+		return nil, spanner.ToSpannerError(status.Errorf(codes.FailedPrecondition, "This connection has an active transaction. Mutation batches in transactions are not supported."))
+	}
+	c.batch = &batch{tp: mutations}
+	return driver.ResultNoRows, nil
+}
+
 func (c *conn) runBatch(ctx context.Context) (driver.Result, error) {
 	if c.inTransaction() {
 		return c.tx.RunBatch(ctx)
@@ -515,6 +1160,11 @@ func (c *conn) runBatch(ctx context.Context) (driver.Result, error) {
 		return c.runDDLBatch(ctx)
 	case dml:
 		return c.runDMLBatch(ctx)
+	case mutations:
+		if _, err := c.runMutationBatch(ctx); err != nil {
+			return nil, err
+		}
+		return driver.ResultNoRows, nil
 	default:
 		return nil, spanner.ToSpannerError(status.Errorf(codes.InvalidArgument, "Unknown batch type: %d", c.batch.tp))
 	}
@@ -532,6 +1182,35 @@ func (c *conn) runDMLBatch(ctx context.Context) (driver.Result, error) {
 	return c.execBatchDML(ctx, statements)
 }
 
+// runMutationBatch writes the buffered mutations of the current mutation batch
+// in one or more commits. Each commit contains at most maxMutationsPerCommit
+// mutations. The commit timestamp of the connection is set to the commit
+// timestamp of the last commit. A failed commit returns a *MutationBatchError
+// with the mutations that were not written.
+func (c *conn) runMutationBatch(ctx context.Context) ([]time.Time, error) {
+	ms := c.batch.mutations
+	c.batch = nil
+	limit := c.maxMutationsPerCommit
+	if limit <= 0 {
+		limit = defaultMaxMutationsPerCommit
+	}
+	var commitTimestamps []time.Time
+	for start := 0; start < len(ms); {
+		end := start + limit
+		if end > len(ms) {
+			end = len(ms)
+		}
+		commitTs, err := c.applyMutations(ctx, ms[start:end])
+		if err != nil {
+			return commitTimestamps, &MutationBatchError{Index: start, Mutations: ms[start:], Err: err}
+		}
+		c.commitTs = &commitTs
+		commitTimestamps = append(commitTimestamps, commitTs)
+		start = end
+	}
+	return commitTimestamps, nil
+}
+
 func (c *conn) abortBatch() (driver.Result, error) {
 	if c.inTransaction() {
 		return c.tx.AbortBatch()
@@ -555,25 +1234,59 @@ func (c *conn) execDDL(ctx context.Context, statements ...spanner.Statement) (dr
 		for i, s := range statements {
 			ddlStatements[i] = s.SQL
 		}
-		op, err := c.adminClient.UpdateDatabaseDdl(ctx, &adminpb.UpdateDatabaseDdlRequest{
-			Database:   c.database,
-			Statements: ddlStatements,
-		})
-		if err != nil {
-			return nil, err
-		}
-		if err := op.Wait(ctx); err != nil {
+		if _, err := c.execDDLBatch(ctx, ddlStatements); err != nil {
 			return nil, err
 		}
 	}
 	return driver.ResultNoRows, nil
 }
 
+// execDDLBatch executes the given DDL statements as one batch and waits until
+// the batch has finished. It returns the number of statements that were
+// executed successfully if the batch fails. The cached primary keys of the
+// connector are cleared, as the statements can drop and recreate tables.
+func (c *conn) execDDLBatch(ctx context.Context, statements []string) (int, error) {
+	if c.connector != nil {
+		defer c.connector.clearPrimaryKeys()
+	}
+	op, err := c.adminClient.UpdateDatabaseDdl(ctx, &adminpb.UpdateDatabaseDdlRequest{
+		Database:   c.database,
+		Statements: statements,
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err := op.Wait(ctx); err != nil {
+		// The metadata of the operation contains a commit timestamp for
+		// each statement that was executed successfully.
+		var executed int
+		if metadata, mdErr := op.Metadata(); mdErr == nil && metadata != nil {
+			executed = len(metadata.CommitTimestamps)
+		}
+		if executed >= len(statements) {
+			executed = len(statements) - 1
+		}
+		return executed, err
+	}
+	return len(statements), nil
+}
+
 func (c *conn) execBatchDML(ctx context.Context, statements []spanner.Statement) (driver.Result, error) {
 	if len(statements) == 0 {
 		return &result{}, nil
 	}
 
+	affected, err := c.batchUpdate(ctx, statements)
+	return &result{rowsAffected: sum(affected)}, err
+}
+
+// batchUpdate executes the given DML statements as one batch in the current
+// read/write transaction, or in a new read/write transaction if the
+// connection does not have an active transaction. It returns the update
+// counts of the statements that were executed successfully. The commit
+// timestamp of the connection is set if the batch was executed in a new
+// read/write transaction that was committed.
+func (c *conn) batchUpdate(ctx context.Context, statements []spanner.Statement) ([]int64, error) {
 	var affected []int64
 	var err error
 	if c.inTransaction() {
@@ -583,12 +1296,16 @@ func (c *conn) execBatchDML(ctx context.Context, statements []spanner.Statement)
 		}
 		affected, err = tx.rwTx.BatchUpdate(ctx, statements)
 	} else {
-		_, err = c.client.ReadWriteTransaction(ctx, func(ctx context.Context, transaction *spanner.ReadWriteTransaction) error {
+		var resp spanner.CommitResponse
+		resp, err = c.client.ReadWriteTransactionWithOptions(ctx, func(ctx context.Context, transaction *spanner.ReadWriteTransaction) error {
 			affected, err = transaction.BatchUpdate(ctx, statements)
 			return err
-		})
+		}, c.transactionOptions())
+		if err == nil {
+			c.commitTs = &resp.CommitTs
+		}
 	}
-	return &result{rowsAffected: sum(affected)}, err
+	return affected, err
 }
 
 func sum(affected []int64) int64 {
@@ -606,10 +1323,49 @@ func (c *conn) Apply(ctx context.Context, ms []*spanner.Mutation, opts ...spanne
 				codes.FailedPrecondition,
 				"Apply may not be called while the connection is in a transaction. Use BufferWrite to write mutations in a transaction."))
 	}
+	if c.InMutationBatch() {
+		c.batch.mutations = append(c.batch.mutations, ms...)
+		return time.Time{}, nil
+	}
+	if len(opts) == 0 {
+		return c.applyMutations(ctx, ms)
+	}
+	if c.maxCommitDelay > 0 {
+		return time.Time{}, spanner.ToSpannerError(
+			status.Error(
+				codes.FailedPrecondition,
+				"ApplyOptions cannot be used in combination with a max commit delay. Remove the max commit delay from the connection or call Apply without any options."))
+	}
 	return c.client.Apply(ctx, ms, opts...)
 }
 
+func (c *conn) BatchWrite(ctx context.Context, mgs []*spanner.MutationGroup) (*spanner.BatchWriteResponseIterator, error) {
+	if c.inTransaction() {
+		return nil, spanner.ToSpannerError(
+			status.Error(
+				codes.FailedPrecondition,
+				"BatchWrite may not be called while the connection is in a transaction."))
+	}
+	return c.client.BatchWrite(ctx, mgs), nil
+}
+
+// applyMutations writes the given mutations to the database in a single
+// commit using the transaction options of the connection.
+func (c *conn) applyMutations(ctx context.Context, ms []*spanner.Mutation) (time.Time, error) {
+	if c.maxCommitDelay > 0 {
+		resp, err := c.client.ReadWriteTransactionWithOptions(ctx, func(ctx context.Context, tx *spanner.ReadWriteTransaction) error {
+			return tx.BufferWrite(ms)
+		}, c.transactionOptions())
+		return resp.CommitTs, err
+	}
+	return c.client.Apply(ctx, ms)
+}
+
 func (c *conn) BufferWrite(ms []*spanner.Mutation) error {
+	if c.InMutationBatch() {
+		c.batch.mutations = append(c.batch.mutations, ms...)
+		return nil
+	}
 	if !c.inTransaction() {
 		return spanner.ToSpannerError(
 			status.Error(
@@ -656,6 +1412,24 @@ func (c *conn) ResetSession(_ context.Context) error {
 	c.retryAborts = true
 	c.autocommitDMLMode = Transactional
 	c.readOnlyStaleness = spanner.TimestampBound{}
+	c.statementTimeout = 0
+	c.maxCommitDelay = 0
+	c.directedReadOptions = nil
+	c.dmlAsMutations = false
+	c.decodeMode = DecodeModeSpanner
+	c.optimizerVersion = ""
+	c.optimizerStatisticsPackage = ""
+	c.maxMutationsPerCommit = defaultMaxMutationsPerCommit
+	if c.connector != nil {
+		c.statementTimeout = c.connector.statementTimeout
+		c.maxCommitDelay = c.connector.maxCommitDelay
+		c.directedReadOptions = c.connector.directedReadOptions
+		c.dmlAsMutations = c.connector.dmlAsMutations
+		c.decodeMode = c.connector.decodeMode
+		c.optimizerVersion = c.connector.optimizerVersion
+		c.optimizerStatisticsPackage = c.connector.optimizerStatisticsPackage
+		c.maxMutationsPerCommit = c.connector.maxMutationsPerCommit
+	}
 	return nil
 }
 
@@ -670,8 +1444,9 @@ func (c *conn) CheckNamedValue(value *driver.NamedValue) error {
 	}
 	switch t := value.Value.(type) {
 	default:
-		// Default is to fail, unless it is one of the following supported types.
-		return spanner.ToSpannerError(status.Errorf(codes.InvalidArgument, "unsupported value type: %v", t))
+		// Values of other types are only accepted if they can be encoded or
+		// converted to one of the following supported types.
+		return c.checkCustomValue(value)
 	case nil:
 	case sql.NullInt64:
 	case sql.NullTime:
@@ -728,89 +1503,499 @@ func (c *conn) CheckNamedValue(value *driver.NamedValue) error {
 	case spanner.NullJSON:
 	case []spanner.NullJSON:
 	case spanner.GenericColumnValue:
+	case sql.Out:
+		switch t.Dest.(type) {
+		case *time.Time, *spanner.CommitResponse:
+		default:
+			return spanner.ToSpannerError(status.Errorf(codes.InvalidArgument, "unsupported OUT parameter type: %T, only *time.Time and *spanner.CommitResponse are supported", t.Dest))
+		}
+		if t.In {
+			return spanner.ToSpannerError(status.Error(codes.InvalidArgument, "INOUT parameters are not supported"))
+		}
 	}
 	return nil
 }
 
+var valuerReflectType = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+
+// checkCustomValue checks a value of a type that is not natively supported by
+// the driver. The value is accepted as-is if it implements spanner.Encoder. It
+// is converted to a supported value if it implements driver.Valuer, or if it
+// can be widened to a supported type, for example `type UserID int64`, int32
+// or []float32.
+func (c *conn) checkCustomValue(value *driver.NamedValue) error {
+	switch t := value.Value.(type) {
+	case spanner.Encoder:
+		return nil
+	case driver.Valuer:
+		v, err := callValuer(t)
+		if err != nil {
+			return spanner.ToSpannerError(status.Errorf(codes.InvalidArgument, "failed to get value from %T: %v", t, err))
+		}
+		if v != nil && reflect.TypeOf(v) == reflect.TypeOf(t) {
+			return spanner.ToSpannerError(status.Errorf(codes.InvalidArgument, "unsupported value type: %v", t))
+		}
+		value.Value = v
+		return c.CheckNamedValue(value)
+	}
+	v, ok, err := convertToSupportedType(value.Value)
+	if err != nil {
+		return err
+	}
+	if ok {
+		value.Value = v
+		return nil
+	}
+	return spanner.ToSpannerError(status.Errorf(codes.InvalidArgument, "unsupported value type: %v", value.Value))
+}
+
+// callValuer returns the value of the given driver.Valuer. A nil pointer to a
+// type that implements driver.Valuer with a value receiver returns nil.
+func callValuer(vr driver.Valuer) (driver.Value, error) {
+	if rv := reflect.ValueOf(vr); rv.Kind() == reflect.Ptr && rv.IsNil() && rv.Type().Elem().Implements(valuerReflectType) {
+		return nil, nil
+	}
+	return vr.Value()
+}
+
+// convertToSupportedType converts a value of a type that is not natively
+// supported to a value of a supported type. Named types are converted to the
+// supported type with the same underlying kind, signed and unsigned integers of
+// any size are widened to int64, and float32 is widened to float64. Pointers
+// and slices of these types are converted to pointers and slices of the
+// widened types. It returns false if the value cannot be converted, and an
+// error if an unsigned integer value does not fit in an INT64.
+func convertToSupportedType(v interface{}) (interface{}, bool, error) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr:
+		target, ok := widenedType(rv.Type().Elem())
+		if !ok {
+			return nil, false, nil
+		}
+		if rv.IsNil() {
+			return reflect.Zero(reflect.PtrTo(target)).Interface(), true, nil
+		}
+		ev, err := widenValue(rv.Elem())
+		if err != nil {
+			return nil, false, err
+		}
+		p := reflect.New(target)
+		p.Elem().Set(ev)
+		return p.Interface(), true, nil
+	case reflect.Slice:
+		elemType := rv.Type().Elem()
+		if elemType.Kind() == reflect.Uint8 {
+			return rv.Bytes(), true, nil
+		}
+		isPtr := elemType.Kind() == reflect.Ptr
+		if isPtr {
+			elemType = elemType.Elem()
+		}
+		target, ok := widenedType(elemType)
+		if !ok {
+			return nil, false, nil
+		}
+		if isPtr {
+			target = reflect.PtrTo(target)
+		}
+		res := reflect.MakeSlice(reflect.SliceOf(target), rv.Len(), rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			ev := rv.Index(i)
+			if isPtr {
+				if ev.IsNil() {
+					continue
+				}
+				ev = ev.Elem()
+			}
+			wv, err := widenValue(ev)
+			if err != nil {
+				return nil, false, err
+			}
+			if isPtr {
+				p := reflect.New(target.Elem())
+				p.Elem().Set(wv)
+				wv = p
+			}
+			res.Index(i).Set(wv)
+		}
+		return res.Interface(), true, nil
+	}
+	if _, ok := widenedType(rv.Type()); !ok {
+		return nil, false, nil
+	}
+	wv, err := widenValue(rv)
+	if err != nil {
+		return nil, false, err
+	}
+	return wv.Interface(), true, nil
+}
+
+var (
+	boolType    = reflect.TypeOf(false)
+	int64Type   = reflect.TypeOf(int64(0))
+	float64Type = reflect.TypeOf(float64(0))
+	stringType  = reflect.TypeOf("")
+)
+
+// widenedType returns the supported type that values of the given scalar type
+// are converted to.
+func widenedType(t reflect.Type) (reflect.Type, bool) {
+	switch t.Kind() {
+	case reflect.Bool:
+		return boolType, true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64Type, true
+	case reflect.Float32, reflect.Float64:
+		return float64Type, true
+	case reflect.String:
+		return stringType, true
+	}
+	return nil, false
+}
+
+// widenValue converts the given scalar value to a value of its widened type.
+func widenValue(rv reflect.Value) (reflect.Value, error) {
+	switch rv.Kind() {
+	case reflect.Bool:
+		return reflect.ValueOf(rv.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return reflect.ValueOf(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u := rv.Uint()
+		if u > math.MaxInt64 {
+			return reflect.Value{}, spanner.ToSpannerError(status.Errorf(codes.OutOfRange, "value %d of type %v overflows INT64", u, rv.Type()))
+		}
+		return reflect.ValueOf(int64(u)), nil
+	case reflect.Float32, reflect.Float64:
+		return reflect.ValueOf(rv.Float()), nil
+	default:
+		return reflect.ValueOf(rv.String()), nil
+	}
+}
+
 func (c *conn) Prepare(query string) (driver.Stmt, error) {
 	return c.PrepareContext(context.Background(), query)
 }
 
 func (c *conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
-	args, err := parseNamedParameters(query)
+	parsed, err := parseStatement(c, query)
 	if err != nil {
 		return nil, err
 	}
-	return &stmt{conn: c, query: query, numArgs: len(args)}, nil
+	if c.analyzePreparedStatements && parsed.statementType == statementTypeQuery && len(parsed.params) > 0 && parsed.statements == nil {
+		if parsed.paramTypes, err = c.analyzeParameters(ctx, query); err != nil {
+			return nil, err
+		}
+	}
+	return &stmt{conn: c, parsed: parsed}, nil
+}
+
+// analyzeParameters executes the given query in PLAN mode and returns the
+// types of the parameters in the query as inferred by Spanner.
+func (c *conn) analyzeParameters(ctx context.Context, query string) (map[string]*sppb.Type, error) {
+	mode := sppb.ExecuteSqlRequest_PLAN
+	options := c.queryOptions()
+	options.Mode = &mode
+	it := c.client.Single().QueryWithOptions(ctx, spanner.NewStatement(query), options)
+	defer it.Stop()
+	for {
+		_, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	fields := it.Metadata.GetUndeclaredParameters().GetFields()
+	paramTypes := make(map[string]*sppb.Type, len(fields))
+	for _, field := range fields {
+		paramTypes[field.Name] = field.Type
+	}
+	return paramTypes, nil
 }
 
 func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	parsed, err := parseStatement(c, query)
+	if err != nil {
+		return nil, err
+	}
+	return c.queryStatement(ctx, parsed, args)
+}
+
+func (c *conn) queryStatement(ctx context.Context, parsed *parsedStatement, args []driver.NamedValue) (driver.Rows, error) {
 	// Execute client side statement if it is one.
-	clientStmt, err := parseClientSideStatement(c, query)
+	if parsed.clientSide != nil {
+		return parsed.clientSide.QueryContext(ctx, args)
+	}
+	if parsed.statements != nil {
+		return c.queryMultiple(ctx, parsed.statements, args)
+	}
+	var iter rowIterator
+	var err error
+	if parsed.statementType == statementTypeDml && c.InDMLBatch() {
+		return nil, spanner.ToSpannerError(status.Error(codes.FailedPrecondition, "DML statements in a DML batch must be executed with ExecContext"))
+	} else if parsed.statementType == statementTypeDml && c.tx == nil {
+		iter, err = c.queryDML(ctx, parsed, args)
+	} else {
+		iter, err = c.query(ctx, parsed, args, c.queryOptions())
+	}
 	if err != nil {
 		return nil, err
 	}
-	if clientStmt != nil {
-		return clientStmt.QueryContext(ctx, args)
+	return &rows{it: iter, conn: c, decodeMode: c.decodeMode}, nil
+}
+
+func (c *conn) query(ctx context.Context, parsed *parsedStatement, args []driver.NamedValue, options spanner.QueryOptions) (rowIterator, error) {
+	// Clear the commit timestamp and query statistics of this connection
+	// before we execute the query.
+	c.commitTs = nil
+	c.queryStats = nil
+
+	stmt, err := prepareSpannerStmt(parsed, args)
+	if err != nil {
+		return nil, err
+	}
+	stmtCtx, cancel := c.statementContext(ctx)
+	// Results are not prefetched in read/write transactions, as all rows
+	// that are read by a read/write transaction are included in the
+	// checksum that is used to verify retries of aborted transactions.
+	prefetch := c.prefetchRows > 0 && !c.inReadWriteTransaction()
+	exec := func(ctx context.Context) rowIterator {
+		if c.tx == nil {
+			return &readOnlyRowIterator{c.execSingleQuery(ctx, c.client, stmt, c.readOnlyStaleness, options)}
+		}
+		return c.tx.Query(ctx, stmt, options)
+	}
+	var iter rowIterator
+	if prefetch {
+		queryCtx, cancelQuery := context.WithCancel(stmtCtx)
+		iter = newPrefetchRowIterator(exec(queryCtx), cancelQuery, c.prefetchRows, c.prefetchBytes)
+	} else {
+		iter = exec(stmtCtx)
+	}
+	if c.statementTimeout > 0 {
+		iter = &timeoutRowIterator{rowIterator: iter, ctx: ctx, stmtCtx: stmtCtx, cancel: cancel}
+	}
+	return iter, nil
+}
+
+// queryDML executes a DML statement that is executed with QueryContext
+// outside a transaction. The statement is executed in a new read/write
+// transaction, and the rows that are returned by a DML statement with a THEN
+// RETURN clause are buffered until the transaction has been committed. DML
+// statements without a THEN RETURN clause return an empty result set. DML
+// statements that are executed as Partitioned DML always return an empty
+// result set.
+func (c *conn) queryDML(ctx context.Context, parsed *parsedStatement, args []driver.NamedValue) (rowIterator, error) {
+	if c.autocommitDMLMode != Transactional {
+		if _, err := c.execStatement(ctx, parsed, args); err != nil {
+			return nil, err
+		}
+		return &clientSideIterator{metadata: &sppb.ResultSetMetadata{RowType: &sppb.StructType{}}}, nil
 	}
-	// Clear the commit timestamp of this connection before we execute the query.
+	// Clear the commit timestamp and query statistics of this connection
+	// before we execute the statement.
 	c.commitTs = nil
+	c.queryStats = nil
+
+	stmt, err := prepareSpannerStmt(parsed, args)
+	if err != nil {
+		return nil, err
+	}
+	commitResponse := commitResponseFromContext(ctx)
+	options := c.transactionOptions()
+	options.CommitOptions.ReturnCommitStats = commitResponse != nil
+	queryOptions := c.queryOptions()
+	// Directed reads are not supported in read/write transactions.
+	queryOptions.DirectedReadOptions = nil
+	stmtCtx, cancel := c.statementContext(ctx)
+	defer cancel()
+	iter, resp, err := queryInNewRWTransaction(stmtCtx, c.client, stmt, options, queryOptions)
+	if err != nil {
+		return nil, statementTimeoutErr(ctx, stmtCtx, err)
+	}
+	c.commitTs = &resp.CommitTs
+	c.queryStats = iter.stats
+	if commitResponse != nil {
+		*commitResponse = resp
+	}
+	return iter, nil
+}
+
+// queryMultiple executes a query string that contains multiple statements.
+// Each statement is returned as a separate result set, and is executed on the
+// connection when the caller advances to its result set. This ensures that
+// all statements are executed in order and use the transaction or read-only
+// staleness of the connection at that moment. Statements that the caller has
+// not advanced to when the rows are closed are not executed. Named arguments
+// are assigned to the parameters with the same name in all statements.
+// Positional arguments are assigned to the statements in order, and each
+// statement consumes as many positional arguments as it contains parameters
+// that have no named argument. DML statements return a result set with one
+// row containing the update count of the statement.
+func (c *conn) queryMultiple(ctx context.Context, statements []string, args []driver.NamedValue) (driver.Rows, error) {
+	named := make(map[string]driver.NamedValue)
+	var positional []driver.NamedValue
+	for _, arg := range args {
+		if arg.Name == "" {
+			positional = append(positional, arg)
+		} else {
+			named[arg.Name] = arg
+		}
+	}
+	used := make(map[string]bool, len(named))
+	results := make([]func() (rowIterator, error), len(statements))
+	for i, statement := range statements {
+		parsed, err := parseStatement(c, statement)
+		if err != nil {
+			return nil, err
+		}
+		statementArgs := make([]driver.NamedValue, 0, len(parsed.params))
+		for _, param := range parsed.params {
+			if arg, ok := named[param]; ok {
+				used[param] = true
+				statementArgs = append(statementArgs, arg)
+				continue
+			}
+			if len(positional) == 0 {
+				return nil, spanner.ToSpannerError(status.Errorf(codes.InvalidArgument, "missing argument value for parameter %s in statement %q", param, statement))
+			}
+			statementArgs = append(statementArgs, positional[0])
+			positional = positional[1:]
+		}
+		results[i] = func() (rowIterator, error) {
+			return c.resultSet(ctx, parsed, statementArgs)
+		}
+	}
+	if unused := len(positional) + len(named) - len(used); unused > 0 {
+		return nil, spanner.ToSpannerError(status.Errorf(codes.InvalidArgument, "got %v argument values that are not used by any statement", unused))
+	}
+	it, err := results[0]()
+	if err != nil {
+		return nil, err
+	}
+	return &rows{it: it, conn: c, decodeMode: c.decodeMode, nextResultSets: results[1:]}, nil
+}
 
-	stmt, err := prepareSpannerStmt(query, args)
+// resultSet executes a single statement of a query string with multiple
+// statements and returns its result as a row iterator.
+func (c *conn) resultSet(ctx context.Context, parsed *parsedStatement, args []driver.NamedValue) (rowIterator, error) {
+	if parsed.clientSide != nil && parsed.clientSide.queryContext != nil {
+		r, err := parsed.clientSide.QueryContext(ctx, args)
+		if err != nil {
+			return nil, err
+		}
+		return r.(*rows).it, nil
+	}
+	if parsed.statementType == statementTypeQuery {
+		return c.query(ctx, parsed, args, c.queryOptions())
+	}
+	res, err := c.execStatement(ctx, parsed, args)
 	if err != nil {
 		return nil, err
 	}
+	if updateCount, err := res.RowsAffected(); err == nil {
+		return createSingleValueIterator("UpdateCount", updateCount, sppb.TypeCode_INT64)
+	}
+	return &clientSideIterator{metadata: &sppb.ResultSetMetadata{RowType: &sppb.StructType{}}}, nil
+}
+
+func (c *conn) Read(ctx context.Context, table string, keySet spanner.KeySet, columns []string, opts *spanner.ReadOptions) (driver.Rows, error) {
+	// Clear the commit timestamp of this connection before we execute the read.
+	c.commitTs = nil
+
+	readOpts := spanner.ReadOptions{}
+	if opts != nil {
+		readOpts = *opts
+	}
+	if readOpts.DirectedReadOptions == nil {
+		readOpts.DirectedReadOptions = c.queryOptions().DirectedReadOptions
+	}
+	stmtCtx, cancel := c.statementContext(ctx)
 	var iter rowIterator
 	if c.tx == nil {
-		iter = &readOnlyRowIterator{c.execSingleQuery(ctx, c.client, stmt, c.readOnlyStaleness)}
+		iter = &readOnlyRowIterator{c.client.Single().WithTimestampBound(c.readOnlyStaleness).ReadWithOptions(stmtCtx, table, keySet, columns, &readOpts)}
 	} else {
-		iter = c.tx.Query(ctx, stmt)
+		iter = c.tx.Read(stmtCtx, table, keySet, columns, &readOpts)
+	}
+	if c.statementTimeout > 0 {
+		iter = &timeoutRowIterator{rowIterator: iter, ctx: ctx, stmtCtx: stmtCtx, cancel: cancel}
 	}
-	return &rows{it: iter}, nil
+	return &rows{it: iter, decodeMode: c.decodeMode}, nil
 }
 
 func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
-	// Execute client side statement if it is one.
-	stmt, err := parseClientSideStatement(c, query)
+	parsed, err := parseStatement(c, query)
 	if err != nil {
 		return nil, err
 	}
-	if stmt != nil {
-		return stmt.ExecContext(ctx, args)
+	return c.execStatement(ctx, parsed, args)
+}
+
+func (c *conn) execStatement(ctx context.Context, parsed *parsedStatement, args []driver.NamedValue) (driver.Result, error) {
+	stmtCtx, cancel := c.statementContext(ctx)
+	defer cancel()
+	res, err := c.execContext(stmtCtx, parsed, args)
+	return res, statementTimeoutErr(ctx, stmtCtx, err)
+}
+
+func (c *conn) execContext(ctx context.Context, parsed *parsedStatement, args []driver.NamedValue) (driver.Result, error) {
+	// Execute client side statement if it is one.
+	if parsed.clientSide != nil {
+		return parsed.clientSide.ExecContext(ctx, args)
+	}
+	// Queries that are executed with ExecContext are executed and the rows
+	// that they return are discarded.
+	if parsed.statementType == statementTypeQuery {
+		return c.execQuery(ctx, parsed, args)
 	}
 	// Clear the commit timestamp of this connection before we execute the statement.
 	c.commitTs = nil
 
 	// Use admin API if DDL statement is provided.
-	isDDL, err := isDDL(query)
-	if err != nil {
-		return nil, err
-	}
-	if isDDL {
+	if parsed.statementType == statementTypeDdl {
 		// Spanner does not support DDL in transactions, and although it is technically possible to execute DDL
 		// statements while a transaction is active, we return an error to avoid any confusion whether the DDL
 		// statement is executed as part of the active transaction or not.
 		if c.inTransaction() {
 			return nil, spanner.ToSpannerError(status.Errorf(codes.FailedPrecondition, "cannot execute DDL as part of a transaction"))
 		}
-		return c.execDDL(ctx, spanner.NewStatement(query))
+		return c.execDDL(ctx, spanner.NewStatement(parsed.query))
 	}
 
-	ss, err := prepareSpannerStmt(query, args)
+	args, outs := extractCommitResponseOuts(args)
+	returnsCommitResponse := c.tx == nil && !c.InDMLBatch() && c.autocommitDMLMode == Transactional
+	if len(outs) > 0 && !returnsCommitResponse {
+		return nil, spanner.ToSpannerError(status.Error(codes.FailedPrecondition, "the commit response can only be returned for DML statements that are executed in autocommit mode using transactional DML"))
+	}
+	// The commit response in the context is ignored for statements that do
+	// not commit a transaction themselves. The context that was used to begin
+	// a transaction is often also used for the statements in the transaction,
+	// and the commit response of the transaction is set when it is committed.
+	if resp := commitResponseFromContext(ctx); resp != nil && returnsCommitResponse {
+		outs = append(outs, resp)
+	}
+	ss, err := prepareSpannerStmt(parsed, args)
 	if err != nil {
 		return nil, err
 	}
 
 	var rowsAffected int64
-	var commitTs time.Time
+	var resp spanner.CommitResponse
 	if c.tx == nil {
 		if c.InDMLBatch() {
 			c.batch.statements = append(c.batch.statements, ss)
 		} else {
 			if c.autocommitDMLMode == Transactional {
-				rowsAffected, commitTs, err = c.execSingleDMLTransactional(ctx, c.client, ss)
+				options := c.transactionOptions()
+				options.CommitOptions.ReturnCommitStats = len(outs) > 0
+				rowsAffected, resp, err = c.execSingleDMLTransactional(ctx, c.client, ss, options)
 				if err == nil {
-					c.commitTs = &commitTs
+					c.commitTs = &resp.CommitTs
+					setCommitResponse(outs, resp)
 				}
 			} else if c.autocommitDMLMode == PartitionedNonAtomic {
 				rowsAffected, err = c.execSingleDMLPartitioned(ctx, c.client, ss)
@@ -818,6 +2003,8 @@ func (c *conn) ExecContext(ctx context.Context, query string, args []driver.Name
 				return nil, status.Errorf(codes.FailedPrecondition, "connection in invalid state for DML statements: %s", c.autocommitDMLMode.String())
 			}
 		}
+	} else if c.dmlAsMutations && c.inReadWriteTransaction() && !c.InDMLBatch() {
+		rowsAffected, err = c.execDMLAsMutation(ctx, ss)
 	} else {
 		rowsAffected, err = c.tx.ExecContext(ctx, ss)
 	}
@@ -827,6 +2014,222 @@ func (c *conn) ExecContext(ctx context.Context, query string, args []driver.Name
 	return &result{rowsAffected: rowsAffected}, nil
 }
 
+// execQuery executes a query that is executed with ExecContext. The query is
+// executed as if it was executed with QueryContext, and all rows that are
+// returned by the query are read and discarded.
+func (c *conn) execQuery(ctx context.Context, parsed *parsedStatement, args []driver.NamedValue) (driver.Result, error) {
+	it, err := c.query(ctx, parsed, args, c.queryOptions())
+	if err != nil {
+		return nil, err
+	}
+	defer it.Stop()
+	for {
+		_, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	c.queryStats = it.ResultSetStats()
+	return driver.ResultNoRows, nil
+}
+
+type commitResponseKey struct{}
+
+// WithCommitResponse returns a context that instructs the driver to store the
+// commit timestamp and commit statistics of the transaction that is committed
+// using the context in resp. Pass the context to ExecContext to get the
+// commit response of a DML statement in autocommit mode, or to BeginTx to get
+// the commit response of a read/write transaction when it is committed. This
+// makes it possible to get the commit response when using a *sql.DB without
+// pinning a connection. The commit response in the context is ignored by
+// statements that do not commit a transaction, such as statements in a
+// transaction, so the same context can be used for BeginTx and for the
+// statements in the transaction.
+//
+// Example:
+//
+//	var resp spanner.CommitResponse
+//	tx, err := db.BeginTx(spannerdriver.WithCommitResponse(ctx, &resp), &sql.TxOptions{})
+//	// ... execute statements
+//	err = tx.Commit()
+//	fmt.Println(resp.CommitTs)
+func WithCommitResponse(ctx context.Context, resp *spanner.CommitResponse) context.Context {
+	return context.WithValue(ctx, commitResponseKey{}, resp)
+}
+
+func commitResponseFromContext(ctx context.Context) *spanner.CommitResponse {
+	resp, _ := ctx.Value(commitResponseKey{}).(*spanner.CommitResponse)
+	return resp
+}
+
+// extractCommitResponseOuts removes all sql.Out arguments from the given
+// arguments and returns the remaining arguments and the destinations of the
+// OUT parameters. An OUT parameter with a *time.Time destination receives the
+// commit timestamp, and an OUT parameter with a *spanner.CommitResponse
+// destination receives the full commit response of the statement.
+func extractCommitResponseOuts(args []driver.NamedValue) ([]driver.NamedValue, []interface{}) {
+	var outs []interface{}
+	res := make([]driver.NamedValue, 0, len(args))
+	for _, arg := range args {
+		if out, ok := arg.Value.(sql.Out); ok {
+			outs = append(outs, out.Dest)
+			continue
+		}
+		res = append(res, arg)
+	}
+	return res, outs
+}
+
+// setCommitResponse sets the given commit response on all destinations.
+func setCommitResponse(outs []interface{}, resp spanner.CommitResponse) {
+	for _, out := range outs {
+		switch dest := out.(type) {
+		case *time.Time:
+			*dest = resp.CommitTs
+		case *spanner.CommitResponse:
+			*dest = resp
+		}
+	}
+}
+
+// execDMLAsMutation buffers the given DML statement as a mutation in the
+// current read/write transaction if it is a simple DML statement that can be
+// converted to a mutation. UPDATE and DELETE statements are only converted if
+// the WHERE clause contains an equality condition for exactly each primary key
+// column of the table. Other statements, and UPDATE and DELETE statements for
+// tables whose primary key cannot be read, are executed as DML statements.
+func (c *conn) execDMLAsMutation(ctx context.Context, stmt spanner.Statement) (int64, error) {
+	dml, err := parseDMLMutation(stmt.SQL)
+	if err != nil {
+		return 0, err
+	}
+	if dml == nil {
+		return c.tx.ExecContext(ctx, stmt)
+	}
+	var primaryKey []string
+	if dml.op != insertMutation {
+		// The statement is executed as DML if the primary key cannot be
+		// read, as the statement itself is still valid.
+		if primaryKey, err = c.primaryKey(ctx, dml.table); err != nil {
+			return c.tx.ExecContext(ctx, stmt)
+		}
+	}
+	m, err := dml.mutation(primaryKey, stmt.Params)
+	if err != nil {
+		return 0, err
+	}
+	if m == nil {
+		return c.tx.ExecContext(ctx, stmt)
+	}
+	if err := c.tx.BufferWrite([]*spanner.Mutation{m}); err != nil {
+		return 0, err
+	}
+	return 1, nil
+}
+
+const (
+	dialectQuery    = `SELECT OPTION_VALUE FROM INFORMATION_SCHEMA.DATABASE_OPTIONS WHERE OPTION_NAME='database_dialect'`
+	primaryKeyQuery = `SELECT COLUMN_NAME FROM INFORMATION_SCHEMA.INDEX_COLUMNS
+WHERE TABLE_SCHEMA=@schema AND LOWER(TABLE_NAME)=LOWER(@table) AND INDEX_TYPE='PRIMARY_KEY'
+ORDER BY ORDINAL_POSITION`
+	pgPrimaryKeyQuery = `SELECT column_name FROM information_schema.index_columns
+WHERE table_schema=$1 AND LOWER(table_name)=LOWER($2) AND index_type='PRIMARY_KEY'
+ORDER BY ordinal_position`
+)
+
+// primaryKey returns the primary key columns of the given table in key order.
+// It returns nil if the table does not exist. The table name can be qualified
+// with the name of a named schema. The result is cached by the connector for
+// tables that exist until a DDL statement is executed on a connection of the
+// connector. Changes to the schema that are made by other processes are not
+// detected. INFORMATION_SCHEMA cannot be queried in a read/write transaction,
+// so the query is executed in a single-use read-only transaction.
+func (c *conn) primaryKey(ctx context.Context, table string) ([]string, error) {
+	key := strings.ToLower(table)
+	if c.connector != nil {
+		c.connector.primaryKeysMu.Lock()
+		primaryKey, ok := c.connector.primaryKeys[key]
+		c.connector.primaryKeysMu.Unlock()
+		if ok {
+			return primaryKey, nil
+		}
+	}
+	dialect, err := c.databaseDialect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var schema string
+	if i := strings.LastIndex(table, "."); i >= 0 {
+		schema, table = table[:i], table[i+1:]
+	} else if dialect == adminpb.DatabaseDialect_POSTGRESQL {
+		schema = "public"
+	}
+	stmt := spanner.Statement{SQL: primaryKeyQuery, Params: map[string]interface{}{"schema": schema, "table": table}}
+	if dialect == adminpb.DatabaseDialect_POSTGRESQL {
+		stmt = spanner.Statement{SQL: pgPrimaryKeyQuery, Params: map[string]interface{}{"p1": schema, "p2": table}}
+	}
+	var primaryKey []string
+	iter := c.client.Single().Query(ctx, stmt)
+	if err := iter.Do(func(row *spanner.Row) error {
+		var column string
+		if err := row.Columns(&column); err != nil {
+			return err
+		}
+		primaryKey = append(primaryKey, column)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	if c.connector != nil && len(primaryKey) > 0 {
+		c.connector.primaryKeysMu.Lock()
+		if c.connector.primaryKeys == nil {
+			c.connector.primaryKeys = make(map[string][]string)
+		}
+		c.connector.primaryKeys[key] = primaryKey
+		c.connector.primaryKeysMu.Unlock()
+	}
+	return primaryKey, nil
+}
+
+// databaseDialect returns the dialect of the database of the connection. The
+// dialect of a database cannot be changed, so it is cached by the connector.
+func (c *conn) databaseDialect(ctx context.Context) (adminpb.DatabaseDialect, error) {
+	if c.connector != nil {
+		c.connector.primaryKeysMu.Lock()
+		dialect := c.connector.dialect
+		c.connector.primaryKeysMu.Unlock()
+		if dialect != adminpb.DatabaseDialect_DATABASE_DIALECT_UNSPECIFIED {
+			return dialect, nil
+		}
+	}
+	dialect := adminpb.DatabaseDialect_GOOGLE_STANDARD_SQL
+	var value string
+	if err := c.client.Single().Query(ctx, spanner.NewStatement(dialectQuery)).Do(func(row *spanner.Row) error {
+		return row.Columns(&value)
+	}); err != nil {
+		return dialect, err
+	}
+	if v, ok := adminpb.DatabaseDialect_value[strings.ToUpper(value)]; ok {
+		dialect = adminpb.DatabaseDialect(v)
+	}
+	if c.connector != nil {
+		c.connector.primaryKeysMu.Lock()
+		c.connector.dialect = dialect
+		c.connector.primaryKeysMu.Unlock()
+	}
+	return dialect, nil
+}
+
+// clearPrimaryKeys removes all cached primary keys.
+func (c *connector) clearPrimaryKeys() {
+	c.primaryKeysMu.Lock()
+	c.primaryKeys = nil
+	c.primaryKeysMu.Unlock()
+}
+
 func (c *conn) Close() error {
 	// Check if this is the last open connection of the connector.
 	if count := atomic.AddInt32(&c.connector.connCount, -1); count > 0 {
@@ -864,15 +2267,19 @@ func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, e
 		}
 		return c.tx, nil
 	}
-
-	tx, err := spanner.NewReadWriteStmtBasedTransaction(ctx, c.client)
+	options := c.transactionOptions()
+	commitResponse := commitResponseFromContext(ctx)
+	options.CommitOptions.ReturnCommitStats = commitResponse != nil
+	tx, err := spanner.NewReadWriteStmtBasedTransactionWithOptions(ctx, c.client, options)
 	if err != nil {
 		return nil, err
 	}
 	c.tx = &readWriteTransaction{
-		ctx:    ctx,
-		client: c.client,
-		rwTx:   tx,
+		ctx:            ctx,
+		client:         c.client,
+		options:        options,
+		rwTx:           tx,
+		commitResponse: commitResponse,
 		close: func(commitTs *time.Time, commitErr error) {
 			c.tx = nil
 			if commitErr == nil {
@@ -905,22 +2312,56 @@ func (c *conn) inReadWriteTransaction() bool {
 	return false
 }
 
-func queryInSingleUse(ctx context.Context, c *spanner.Client, statement spanner.Statement, tb spanner.TimestampBound) *spanner.RowIterator {
-	return c.Single().WithTimestampBound(tb).Query(ctx, statement)
+func queryInSingleUse(ctx context.Context, c *spanner.Client, statement spanner.Statement, tb spanner.TimestampBound, options spanner.QueryOptions) *spanner.RowIterator {
+	return c.Single().WithTimestampBound(tb).QueryWithOptions(ctx, statement, options)
 }
 
-func execInNewRWTransaction(ctx context.Context, c *spanner.Client, statement spanner.Statement) (int64, time.Time, error) {
+func execInNewRWTransaction(ctx context.Context, c *spanner.Client, statement spanner.Statement, options spanner.TransactionOptions) (int64, spanner.CommitResponse, error) {
 	var rowsAffected int64
 	fn := func(ctx context.Context, tx *spanner.ReadWriteTransaction) error {
 		count, err := tx.Update(ctx, statement)
 		rowsAffected = count
 		return err
 	}
-	ts, err := c.ReadWriteTransaction(ctx, fn)
+	resp, err := c.ReadWriteTransactionWithOptions(ctx, fn, options)
+	if err != nil {
+		return 0, spanner.CommitResponse{}, err
+	}
+	return rowsAffected, resp, nil
+}
+
+// queryInNewRWTransaction executes the given DML statement in a new
+// read/write transaction and returns the rows that are returned by the
+// statement. The rows are read before the transaction is committed.
+func queryInNewRWTransaction(ctx context.Context, c *spanner.Client, statement spanner.Statement, options spanner.TransactionOptions, queryOptions spanner.QueryOptions) (*clientSideIterator, spanner.CommitResponse, error) {
+	var res *clientSideIterator
+	fn := func(ctx context.Context, tx *spanner.ReadWriteTransaction) error {
+		it := tx.QueryWithOptions(ctx, statement, queryOptions)
+		defer it.Stop()
+		var rows []*spanner.Row
+		for {
+			row, err := it.Next()
+			if err == iterator.Done {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			rows = append(rows, row)
+		}
+		stats := resultSetStats(it)
+		if stats == nil {
+			stats = &sppb.ResultSetStats{}
+		}
+		stats.RowCount = &sppb.ResultSetStats_RowCountExact{RowCountExact: it.RowCount}
+		res = &clientSideIterator{metadata: it.Metadata, rows: rows, stats: stats}
+		return nil
+	}
+	resp, err := c.ReadWriteTransactionWithOptions(ctx, fn, options)
 	if err != nil {
-		return 0, time.Time{}, err
+		return nil, spanner.CommitResponse{}, err
 	}
-	return rowsAffected, ts, nil
+	return res, resp, nil
 }
 
 func execAsPartitionedDML(ctx context.Context, c *spanner.Client, statement spanner.Statement) (int64, error) {
@@ -17,6 +17,7 @@ package spannerdriver
 import (
 	"context"
 	"database/sql/driver"
+	"math"
 	"testing"
 	"time"
 
@@ -159,14 +160,15 @@ func TestExtractDnsParts(t *testing.T) {
 			},
 			wantSpannerConfig: spanner.ClientConfig{
 				SessionPoolConfig: spanner.SessionPoolConfig{
-					MinOpened:           200,
-					MaxOpened:           1000,
-					WriteSessions:       0.5,
-					HealthCheckInterval: spanner.DefaultSessionPoolConfig.HealthCheckInterval,
-					HealthCheckWorkers:  spanner.DefaultSessionPoolConfig.HealthCheckWorkers,
-					MaxBurst:            spanner.DefaultSessionPoolConfig.MaxBurst,
-					MaxIdle:             spanner.DefaultSessionPoolConfig.MaxIdle,
-					TrackSessionHandles: spanner.DefaultSessionPoolConfig.TrackSessionHandles,
+					MinOpened:                         200,
+					MaxOpened:                         1000,
+					WriteSessions:                     0.5,
+					HealthCheckInterval:               spanner.DefaultSessionPoolConfig.HealthCheckInterval,
+					HealthCheckWorkers:                spanner.DefaultSessionPoolConfig.HealthCheckWorkers,
+					MaxBurst:                          spanner.DefaultSessionPoolConfig.MaxBurst,
+					MaxIdle:                           spanner.DefaultSessionPoolConfig.MaxIdle,
+					TrackSessionHandles:               spanner.DefaultSessionPoolConfig.TrackSessionHandles,
+					InactiveTransactionRemovalOptions: spanner.DefaultSessionPoolConfig.InactiveTransactionRemovalOptions,
 				},
 			},
 		},
@@ -183,7 +185,7 @@ func TestExtractDnsParts(t *testing.T) {
 			if err != nil {
 				t.Errorf("failed to get connector for %q: %v", tc.input, err)
 			}
-			if !cmp.Equal(conn.spannerClientConfig, tc.wantSpannerConfig, cmpopts.IgnoreUnexported(spanner.ClientConfig{}, spanner.SessionPoolConfig{})) {
+			if !cmp.Equal(conn.spannerClientConfig, tc.wantSpannerConfig, cmpopts.IgnoreUnexported(spanner.ClientConfig{}, spanner.SessionPoolConfig{}, spanner.InactiveTransactionRemovalOptions{})) {
 				t.Errorf("connector Spanner client config mismatch for %q\n Got: %v\nWant: %v", tc.input, conn.spannerClientConfig, tc.wantSpannerConfig)
 			}
 		}
@@ -320,11 +322,11 @@ func TestConn_StartBatchDml(t *testing.T) {
 func TestConn_NonDdlStatementsInDdlBatch(t *testing.T) {
 	c := &conn{
 		batch: &batch{tp: ddl},
-		execSingleQuery: func(ctx context.Context, c *spanner.Client, statement spanner.Statement, tb spanner.TimestampBound) *spanner.RowIterator {
+		execSingleQuery: func(ctx context.Context, c *spanner.Client, statement spanner.Statement, tb spanner.TimestampBound, options spanner.QueryOptions) *spanner.RowIterator {
 			return &spanner.RowIterator{}
 		},
-		execSingleDMLTransactional: func(ctx context.Context, c *spanner.Client, statement spanner.Statement) (int64, time.Time, error) {
-			return 0, time.Time{}, nil
+		execSingleDMLTransactional: func(ctx context.Context, c *spanner.Client, statement spanner.Statement, options spanner.TransactionOptions) (int64, spanner.CommitResponse, error) {
+			return 0, spanner.CommitResponse{}, nil
 		},
 		execSingleDMLPartitioned: func(ctx context.Context, c *spanner.Client, statement spanner.Statement) (int64, error) {
 			return 0, nil
@@ -353,11 +355,11 @@ func TestConn_NonDdlStatementsInDdlBatch(t *testing.T) {
 func TestConn_NonDmlStatementsInDmlBatch(t *testing.T) {
 	c := &conn{
 		batch: &batch{tp: dml},
-		execSingleQuery: func(ctx context.Context, c *spanner.Client, statement spanner.Statement, tb spanner.TimestampBound) *spanner.RowIterator {
+		execSingleQuery: func(ctx context.Context, c *spanner.Client, statement spanner.Statement, tb spanner.TimestampBound, options spanner.QueryOptions) *spanner.RowIterator {
 			return &spanner.RowIterator{}
 		},
-		execSingleDMLTransactional: func(ctx context.Context, c *spanner.Client, statement spanner.Statement) (int64, time.Time, error) {
-			return 0, time.Time{}, nil
+		execSingleDMLTransactional: func(ctx context.Context, c *spanner.Client, statement spanner.Statement, options spanner.TransactionOptions) (int64, spanner.CommitResponse, error) {
+			return 0, spanner.CommitResponse{}, nil
 		},
 		execSingleDMLPartitioned: func(ctx context.Context, c *spanner.Client, statement spanner.Statement) (int64, error) {
 			return 0, nil
@@ -387,11 +389,11 @@ func TestConn_NonDmlStatementsInDmlBatch(t *testing.T) {
 func TestConn_GetCommitTimestampAfterAutocommitDml(t *testing.T) {
 	want := time.Now()
 	c := &conn{
-		execSingleQuery: func(ctx context.Context, c *spanner.Client, statement spanner.Statement, tb spanner.TimestampBound) *spanner.RowIterator {
+		execSingleQuery: func(ctx context.Context, c *spanner.Client, statement spanner.Statement, tb spanner.TimestampBound, options spanner.QueryOptions) *spanner.RowIterator {
 			return &spanner.RowIterator{}
 		},
-		execSingleDMLTransactional: func(ctx context.Context, c *spanner.Client, statement spanner.Statement) (int64, time.Time, error) {
-			return 0, want, nil
+		execSingleDMLTransactional: func(ctx context.Context, c *spanner.Client, statement spanner.Statement, options spanner.TransactionOptions) (int64, spanner.CommitResponse, error) {
+			return 0, spanner.CommitResponse{CommitTs: want}, nil
 		},
 		execSingleDMLPartitioned: func(ctx context.Context, c *spanner.Client, statement spanner.Statement) (int64, error) {
 			return 0, nil
@@ -412,11 +414,11 @@ func TestConn_GetCommitTimestampAfterAutocommitDml(t *testing.T) {
 
 func TestConn_GetCommitTimestampAfterAutocommitQuery(t *testing.T) {
 	c := &conn{
-		execSingleQuery: func(ctx context.Context, c *spanner.Client, statement spanner.Statement, tb spanner.TimestampBound) *spanner.RowIterator {
+		execSingleQuery: func(ctx context.Context, c *spanner.Client, statement spanner.Statement, tb spanner.TimestampBound, options spanner.QueryOptions) *spanner.RowIterator {
 			return &spanner.RowIterator{}
 		},
-		execSingleDMLTransactional: func(ctx context.Context, c *spanner.Client, statement spanner.Statement) (int64, time.Time, error) {
-			return 0, time.Time{}, nil
+		execSingleDMLTransactional: func(ctx context.Context, c *spanner.Client, statement spanner.Statement, options spanner.TransactionOptions) (int64, spanner.CommitResponse, error) {
+			return 0, spanner.CommitResponse{}, nil
 		},
 		execSingleDMLPartitioned: func(ctx context.Context, c *spanner.Client, statement spanner.Statement) (int64, error) {
 			return 0, nil
@@ -431,3 +433,94 @@ func TestConn_GetCommitTimestampAfterAutocommitQuery(t *testing.T) {
 		t.Fatalf("error code mismatch\n Got: %v\nWant: %v", g, w)
 	}
 }
+
+type testUserID int64
+type testName string
+type testFlag bool
+type testPayload []byte
+
+type testStatus int
+
+func (s testStatus) Value() (driver.Value, error) {
+	if s == 0 {
+		return nil, nil
+	}
+	return []string{"", "ACTIVE", "INACTIVE"}[s], nil
+}
+
+type testNullableName struct {
+	name  string
+	valid bool
+}
+
+func (n testNullableName) Value() (driver.Value, error) {
+	return spanner.NullString{StringVal: n.name, Valid: n.valid}, nil
+}
+
+type testPoint struct {
+	x, y float64
+}
+
+func (p testPoint) EncodeSpanner() (interface{}, error) {
+	return []float64{p.x, p.y}, nil
+}
+
+func TestConn_CheckNamedValue(t *testing.T) {
+	c := &conn{}
+	int32Val := int32(3)
+	float32Val := float32(1.5)
+	intVal := 4
+	for i, test := range []struct {
+		value    interface{}
+		want     interface{}
+		wantCode codes.Code
+	}{
+		{value: testUserID(1), want: int64(1)},
+		{value: testName("foo"), want: "foo"},
+		{value: testFlag(true), want: true},
+		{value: testPayload("bar"), want: []byte("bar")},
+		{value: testStatus(1), want: "ACTIVE"},
+		{value: testStatus(0), want: nil},
+		{value: (*testStatus)(nil), want: nil},
+		{value: testNullableName{name: "foo", valid: true}, want: spanner.NullString{StringVal: "foo", Valid: true}},
+		{value: testPoint{x: 1, y: 2}, want: testPoint{x: 1, y: 2}},
+		{value: []testUserID{1}, want: []int64{1}},
+		{value: int8(-1), want: int64(-1)},
+		{value: int16(2), want: int64(2)},
+		{value: int32Val, want: int64(3)},
+		{value: uint(4), want: int64(4)},
+		{value: uint8(5), want: int64(5)},
+		{value: uint16(6), want: int64(6)},
+		{value: uint32(math.MaxUint32), want: int64(math.MaxUint32)},
+		{value: uint64(math.MaxInt64), want: int64(math.MaxInt64)},
+		{value: float32Val, want: float64(1.5)},
+		{value: &int32Val, want: func() *int64 { v := int64(3); return &v }()},
+		{value: &intVal, want: func() *int64 { v := int64(4); return &v }()},
+		{value: (*uint16)(nil), want: (*int64)(nil)},
+		{value: (*float32)(nil), want: (*float64)(nil)},
+		{value: []int32{1, 2}, want: []int64{1, 2}},
+		{value: []uint64{1, math.MaxInt64}, want: []int64{1, math.MaxInt64}},
+		{value: []float32{1.5}, want: []float64{1.5}},
+		{value: []*float32{&float32Val, nil}, want: []*float64{func() *float64 { v := 1.5; return &v }(), nil}},
+		{value: struct{}{}, wantCode: codes.InvalidArgument},
+		{value: []struct{}{}, wantCode: codes.InvalidArgument},
+		{value: uint64(math.MaxInt64 + 1), wantCode: codes.OutOfRange},
+		{value: []uint64{math.MaxUint64}, wantCode: codes.OutOfRange},
+		{value: func() *uint { v := uint(math.MaxUint64); return &v }(), wantCode: codes.OutOfRange},
+	} {
+		value := &driver.NamedValue{Ordinal: 1, Value: test.value}
+		err := c.CheckNamedValue(value)
+		if test.wantCode != codes.OK {
+			if g, w := spanner.ErrCode(err), test.wantCode; g != w {
+				t.Fatalf("%d: error code mismatch\n Got: %v\nWant: %v", i, g, w)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%d: failed to check value %v: %v", i, test.value, err)
+		}
+		if !cmp.Equal(value.Value, test.want, cmp.AllowUnexported(testPoint{})) {
+			t.Fatalf("%d: value mismatch\n Got: %#v\nWant: %#v", i, value.Value, test.want)
+		}
+	}
+}
@@ -20,7 +20,10 @@ import (
 	"database/sql/driver"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math"
 	"math/big"
 	"math/rand"
 	"reflect"
@@ -30,6 +33,7 @@ import (
 
 	"cloud.google.com/go/civil"
 	"cloud.google.com/go/spanner"
+	sppb "cloud.google.com/go/spanner/apiv1/spannerpb"
 	"github.com/golang/protobuf/proto"
 	"github.com/golang/protobuf/ptypes"
 	emptypb "github.com/golang/protobuf/ptypes/empty"
@@ -40,7 +44,6 @@ import (
 	"google.golang.org/api/option"
 	longrunningpb "google.golang.org/genproto/googleapis/longrunning"
 	databasepb "google.golang.org/genproto/googleapis/spanner/admin/database/v1"
-	sppb "google.golang.org/genproto/googleapis/spanner/v1"
 	"google.golang.org/grpc/codes"
 	gstatus "google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/structpb"
@@ -1013,16 +1016,120 @@ func TestDmlInAutocommit(t *testing.T) {
 	if req.Transaction == nil {
 		t.Fatalf("missing transaction for ExecuteSqlRequest")
 	}
-	if req.Transaction.GetId() == nil {
-		t.Fatalf("missing id selector for ExecuteSqlRequest")
+	// The transaction is started inline with the DML statement.
+	if req.Transaction.GetBegin() == nil {
+		t.Fatalf("missing begin selector for ExecuteSqlRequest")
 	}
 	commitRequests := requestsOfType(requests, reflect.TypeOf(&sppb.CommitRequest{}))
 	if g, w := len(commitRequests), 1; g != w {
 		t.Fatalf("commit requests count mismatch\nGot: %v\nWant: %v", g, w)
 	}
 	commitReq := commitRequests[0].(*sppb.CommitRequest)
-	if c, e := commitReq.GetTransactionId(), req.Transaction.GetId(); !cmp.Equal(c, e) {
-		t.Fatalf("transaction id mismatch\nCommit: %c\nExecute: %v", c, e)
+	if commitReq.GetTransactionId() == nil {
+		t.Fatalf("missing transaction id for CommitRequest")
+	}
+}
+
+func TestStatementTimeout(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db, server, teardown := setupTestDBConnection(t)
+	defer teardown()
+	c, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("failed to obtain a connection: %v", err)
+	}
+	defer c.Close()
+
+	// Make sure the session pool has been initialized before setting a
+	// statement timeout.
+	if err := c.PingContext(ctx); err != nil {
+		t.Fatalf("failed to ping: %v", err)
+	}
+	if _, err := c.ExecContext(ctx, "SET STATEMENT_TIMEOUT = '10ms'"); err != nil {
+		t.Fatalf("failed to set statement timeout: %v", err)
+	}
+	server.TestSpanner.PutExecutionTime(testutil.MethodExecuteStreamingSql, testutil.SimulatedExecutionTime{
+		MinimumExecutionTime: 100 * time.Millisecond,
+	})
+	server.TestSpanner.PutExecutionTime(testutil.MethodExecuteSql, testutil.SimulatedExecutionTime{
+		MinimumExecutionTime: 100 * time.Millisecond,
+	})
+
+	rows, err := c.QueryContext(ctx, testutil.SelectFooFromBar)
+	if err != nil {
+		t.Fatalf("failed to execute query: %v", err)
+	}
+	for rows.Next() {
+	}
+	if g, w := rows.Err(), ErrStatementTimeout; g != w {
+		t.Fatalf("query error mismatch\nGot: %v\nWant: %v", g, w)
+	}
+	_ = rows.Close()
+
+	_, err = c.ExecContext(ctx, testutil.UpdateBarSetFoo)
+	if g, w := err, ErrStatementTimeout; g != w {
+		t.Fatalf("dml error mismatch\nGot: %v\nWant: %v", g, w)
+	}
+	if g, w := spanner.ErrCode(err), codes.DeadlineExceeded; g != w {
+		t.Fatalf("dml error code mismatch\nGot: %v\nWant: %v", g, w)
+	}
+
+	// A deadline on the context of the caller should not be reported as a
+	// statement timeout.
+	if _, err := c.ExecContext(ctx, "SET STATEMENT_TIMEOUT = '10s'"); err != nil {
+		t.Fatalf("failed to set statement timeout: %v", err)
+	}
+	callCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = c.ExecContext(callCtx, testutil.UpdateBarSetFoo)
+	if err == nil || err == ErrStatementTimeout {
+		t.Fatalf("dml error mismatch\nGot: %v\nWant: a context deadline error", err)
+	}
+
+	// Removing the statement timeout should allow slow statements to finish.
+	if _, err := c.ExecContext(ctx, "SET STATEMENT_TIMEOUT = NULL"); err != nil {
+		t.Fatalf("failed to remove statement timeout: %v", err)
+	}
+	if _, err := c.ExecContext(ctx, testutil.UpdateBarSetFoo); err != nil {
+		t.Fatalf("failed to execute dml without statement timeout: %v", err)
+	}
+}
+
+func TestStatementTimeoutInConnectionString(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db, server, teardown := setupTestDBConnectionWithParams(t, "statement_timeout=10ms")
+	defer teardown()
+	c, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("failed to obtain a connection: %v", err)
+	}
+	defer c.Close()
+
+	rows, err := c.QueryContext(ctx, "SHOW VARIABLE STATEMENT_TIMEOUT")
+	if err != nil {
+		t.Fatalf("failed to get statement timeout: %v", err)
+	}
+	var timeout string
+	for rows.Next() {
+		if err := rows.Scan(&timeout); err != nil {
+			t.Fatalf("failed to scan statement timeout: %v", err)
+		}
+	}
+	_ = rows.Close()
+	if g, w := timeout, "10ms"; g != w {
+		t.Fatalf("statement timeout mismatch\nGot: %v\nWant: %v", g, w)
+	}
+
+	server.TestSpanner.PutExecutionTime(testutil.MethodExecuteSql, testutil.SimulatedExecutionTime{
+		MinimumExecutionTime: 100 * time.Millisecond,
+	})
+	_, err = c.ExecContext(ctx, testutil.UpdateBarSetFoo)
+	if g, w := err, ErrStatementTimeout; g != w {
+		t.Fatalf("dml error mismatch\nGot: %v\nWant: %v", g, w)
 	}
 }
 
@@ -1177,1019 +1284,2932 @@ func TestApplyMutations(t *testing.T) {
 	}
 }
 
-func TestApplyMutationsFailure(t *testing.T) {
+func TestMaxCommitDelay(t *testing.T) {
 	t.Parallel()
 
 	ctx := context.Background()
-	db, _, teardown := setupTestDBConnection(t)
+	db, server, teardown := setupTestDBConnectionWithParams(t, "max_commit_delay=50ms")
 	defer teardown()
-
-	con, err := db.Conn(ctx)
+	c, err := db.Conn(ctx)
 	if err != nil {
 		t.Fatalf("failed to get connection: %v", err)
 	}
-	_, err = con.BeginTx(ctx, &sql.TxOptions{})
+	defer c.Close()
+
+	verifyCommitDelay := func(name string, want time.Duration) {
+		requests := drainRequestsFromServer(server.TestSpanner)
+		commitRequests := requestsOfType(requests, reflect.TypeOf(&sppb.CommitRequest{}))
+		if g, w := len(commitRequests), 1; g != w {
+			t.Fatalf("%s: commit requests count mismatch\nGot: %v\nWant: %v", name, g, w)
+		}
+		commitRequest := commitRequests[0].(*sppb.CommitRequest)
+		var got time.Duration
+		if commitRequest.MaxCommitDelay != nil {
+			got = commitRequest.MaxCommitDelay.AsDuration()
+		}
+		if got != want {
+			t.Fatalf("%s: max commit delay mismatch\nGot: %v\nWant: %v", name, got, want)
+		}
+	}
+
+	// Autocommit DML.
+	if _, err := c.ExecContext(ctx, testutil.UpdateBarSetFoo); err != nil {
+		t.Fatalf("failed to execute dml: %v", err)
+	}
+	verifyCommitDelay("autocommit dml", 50*time.Millisecond)
+
+	// Read/write transaction.
+	tx, err := c.BeginTx(ctx, &sql.TxOptions{})
 	if err != nil {
 		t.Fatalf("failed to begin transaction: %v", err)
 	}
-	if g, w := spanner.ErrCode(con.Raw(func(driverConn interface{}) error {
+	if _, err := tx.ExecContext(ctx, testutil.UpdateBarSetFoo); err != nil {
+		t.Fatalf("failed to execute dml: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+	verifyCommitDelay("read/write transaction", 50*time.Millisecond)
+
+	// Apply mutations with a delay that is set using the SpannerConn interface.
+	if err := c.Raw(func(driverConn interface{}) error {
 		spannerConn, ok := driverConn.(SpannerConn)
 		if !ok {
 			return fmt.Errorf("unexpected driver connection %v, expected SpannerConn", driverConn)
 		}
+		if err := spannerConn.SetMaxCommitDelay(100 * time.Millisecond); err != nil {
+			return err
+		}
 		_, err = spannerConn.Apply(ctx, []*spanner.Mutation{
 			spanner.Insert("Accounts", []string{"AccountId", "Nickname", "Balance"}, []interface{}{int64(1), "Foo", int64(50)}),
-			spanner.Insert("Accounts", []string{"AccountId", "Nickname", "Balance"}, []interface{}{int64(2), "Bar", int64(1)}),
 		})
 		return err
-	})), codes.FailedPrecondition; g != w {
-		t.Fatalf("error code mismatch for Apply during transaction\nGot:  %v\nWant: %v", g, w)
+	}); err != nil {
+		t.Fatalf("failed to apply mutations: %v", err)
 	}
-}
-
-func TestBufferWriteMutations(t *testing.T) {
-	t.Parallel()
+	verifyCommitDelay("apply", 100*time.Millisecond)
 
-	ctx := context.Background()
-	db, server, teardown := setupTestDBConnection(t)
-	defer teardown()
+	// ApplyOptions cannot be combined with a max commit delay.
+	if err := c.Raw(func(driverConn interface{}) error {
+		_, err := driverConn.(SpannerConn).Apply(ctx, []*spanner.Mutation{
+			spanner.Insert("Accounts", []string{"AccountId", "Nickname", "Balance"}, []interface{}{int64(1), "Foo", int64(50)}),
+		}, spanner.ApplyAtLeastOnce())
+		return err
+	}); spanner.ErrCode(err) != codes.FailedPrecondition {
+		t.Fatalf("error code mismatch\nGot: %v\nWant: %v", spanner.ErrCode(err), codes.FailedPrecondition)
+	}
+	if g, w := len(requestsOfType(drainRequestsFromServer(server.TestSpanner), reflect.TypeOf(&sppb.CommitRequest{}))), 0; g != w {
+		t.Fatalf("commit requests count mismatch\nGot: %v\nWant: %v", g, w)
+	}
 
-	con, err := db.Conn(ctx)
-	if err != nil {
-		t.Fatalf("failed to get connection: %v", err)
+	// Removing the max commit delay should remove it from the commit requests.
+	if _, err := c.ExecContext(ctx, "SET MAX_COMMIT_DELAY = NULL"); err != nil {
+		t.Fatalf("failed to remove max commit delay: %v", err)
 	}
-	tx, err := con.BeginTx(ctx, &sql.TxOptions{})
-	if err != nil {
-		t.Fatalf("failed to begin transaction: %v", err)
+	if _, err := c.ExecContext(ctx, testutil.UpdateBarSetFoo); err != nil {
+		t.Fatalf("failed to execute dml: %v", err)
 	}
-	if err := con.Raw(func(driverConn interface{}) error {
-		spannerConn, ok := driverConn.(SpannerConn)
-		if !ok {
-			return fmt.Errorf("unexpected driver connection %v, expected SpannerConn", driverConn)
-		}
-		return spannerConn.BufferWrite([]*spanner.Mutation{
-			spanner.Insert("Accounts", []string{"AccountId", "Nickname", "Balance"}, []interface{}{int64(1), "Foo", int64(50)}),
-			spanner.Insert("Accounts", []string{"AccountId", "Nickname", "Balance"}, []interface{}{int64(2), "Bar", int64(1)}),
-		})
+	verifyCommitDelay("no delay", 0)
+
+	// Resetting the connection should restore the default from the connection string.
+	if err := c.Raw(func(driverConn interface{}) error {
+		return driverConn.(driver.SessionResetter).ResetSession(ctx)
 	}); err != nil {
-		t.Fatalf("failed to buffer mutations: %v", err)
+		t.Fatalf("failed to reset connection: %v", err)
 	}
-	if err := tx.Commit(); err != nil {
-		t.Fatalf("failed to commit transaction: %v", err)
+	rows, err := c.QueryContext(ctx, "SHOW VARIABLE MAX_COMMIT_DELAY")
+	if err != nil {
+		t.Fatalf("failed to get max commit delay: %v", err)
 	}
-
-	requests := drainRequestsFromServer(server.TestSpanner)
-	commitRequests := requestsOfType(requests, reflect.TypeOf(&sppb.CommitRequest{}))
-	if g, w := len(commitRequests), 1; g != w {
-		t.Fatalf("commit requests count mismatch\nGot: %v\nWant: %v", g, w)
+	var delay string
+	for rows.Next() {
+		if err := rows.Scan(&delay); err != nil {
+			t.Fatalf("failed to scan max commit delay: %v", err)
+		}
 	}
-	commitRequest := commitRequests[0].(*sppb.CommitRequest)
-	if g, w := len(commitRequest.Mutations), 2; g != w {
-		t.Fatalf("mutation count mismatch\nGot: %v\nWant: %v", g, w)
+	_ = rows.Close()
+	if g, w := delay, "50ms"; g != w {
+		t.Fatalf("max commit delay mismatch\nGot: %v\nWant: %v", g, w)
 	}
 }
 
-func TestBufferWriteMutationsFails(t *testing.T) {
+func TestDirectedRead(t *testing.T) {
 	t.Parallel()
 
 	ctx := context.Background()
-	db, _, teardown := setupTestDBConnection(t)
+	db, server, teardown := setupTestDBConnectionWithParams(t, `directed_read={"includeReplicas":{"replicaSelections":[{"location":"us-east1"}]}}`)
 	defer teardown()
-
-	con, err := db.Conn(ctx)
+	c, err := db.Conn(ctx)
 	if err != nil {
 		t.Fatalf("failed to get connection: %v", err)
 	}
-	if g, w := spanner.ErrCode(con.Raw(func(driverConn interface{}) error {
-		spannerConn, ok := driverConn.(SpannerConn)
-		if !ok {
-			return fmt.Errorf("unexpected driver connection %v, expected SpannerConn", driverConn)
+	defer c.Close()
+
+	usEast := &sppb.DirectedReadOptions{
+		Replicas: &sppb.DirectedReadOptions_IncludeReplicas_{
+			IncludeReplicas: &sppb.DirectedReadOptions_IncludeReplicas{
+				ReplicaSelections: []*sppb.DirectedReadOptions_ReplicaSelection{{Location: "us-east1"}},
+			},
+		},
+	}
+	euWest := &sppb.DirectedReadOptions{
+		Replicas: &sppb.DirectedReadOptions_IncludeReplicas_{
+			IncludeReplicas: &sppb.DirectedReadOptions_IncludeReplicas{
+				ReplicaSelections: []*sppb.DirectedReadOptions_ReplicaSelection{{Location: "eu-west1"}},
+			},
+		},
+	}
+	query := func(name string, q func(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error), want *sppb.DirectedReadOptions) {
+		rows, err := q(ctx, testutil.SelectFooFromBar)
+		if err != nil {
+			t.Fatalf("%s: failed to execute query: %v", name, err)
+		}
+		for rows.Next() {
+		}
+		if rows.Err() != nil {
+			t.Fatalf("%s: failed to iterate over query result: %v", name, rows.Err())
+		}
+		_ = rows.Close()
+		requests := drainRequestsFromServer(server.TestSpanner)
+		sqlRequests := requestsOfType(requests, reflect.TypeOf(&sppb.ExecuteSqlRequest{}))
+		if g, w := len(sqlRequests), 1; g != w {
+			t.Fatalf("%s: sql requests count mismatch\nGot: %v\nWant: %v", name, g, w)
+		}
+		if g, w := sqlRequests[0].(*sppb.ExecuteSqlRequest).DirectedReadOptions, want; !proto.Equal(g, w) {
+			t.Fatalf("%s: directed read options mismatch\nGot: %v\nWant: %v", name, g, w)
 		}
-		return spannerConn.BufferWrite([]*spanner.Mutation{
-			spanner.Insert("Accounts", []string{"AccountId", "Nickname", "Balance"}, []interface{}{int64(1), "Foo", int64(50)}),
-			spanner.Insert("Accounts", []string{"AccountId", "Nickname", "Balance"}, []interface{}{int64(2), "Bar", int64(1)}),
-		})
-	})), codes.FailedPrecondition; g != w {
-		t.Fatalf("error code mismatch for BufferWrite outside transaction\nGot:  %v\nWant: %v", g, w)
 	}
-}
+	// Autocommit queries use the directed read options from the connection string.
+	query("autocommit", c.QueryContext, usEast)
 
-func TestPing(t *testing.T) {
-	t.Parallel()
+	// Read-only transactions use the directed read options of the connection.
+	if _, err := c.ExecContext(ctx, `SET DIRECTED_READ = '{"includeReplicas":{"replicaSelections":[{"location":"eu-west1"}]}}'`); err != nil {
+		t.Fatalf("failed to set directed read: %v", err)
+	}
+	tx, err := c.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		t.Fatalf("failed to begin read-only transaction: %v", err)
+	}
+	query("read-only transaction", tx.QueryContext, euWest)
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("failed to commit read-only transaction: %v", err)
+	}
 
-	db, _, teardown := setupTestDBConnection(t)
-	defer teardown()
+	// Read/write transactions ignore the directed read options, as Spanner
+	// does not support directed reads in read/write transactions.
+	tx, err = c.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		t.Fatalf("failed to begin read/write transaction: %v", err)
+	}
+	query("read/write transaction", tx.QueryContext, nil)
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("failed to commit read/write transaction: %v", err)
+	}
 
-	// Ensure that the old Ping method works.
-	err := db.Ping()
+	// Setting the value to NULL removes the directed read options.
+	if _, err := c.ExecContext(ctx, "SET DIRECTED_READ = NULL"); err != nil {
+		t.Fatalf("failed to remove directed read: %v", err)
+	}
+	query("no directed read", c.QueryContext, nil)
+
+	tx, err = c.BeginTx(ctx, &sql.TxOptions{})
 	if err != nil {
-		t.Fatalf("Ping failed: %v", err)
+		t.Fatalf("failed to begin read/write transaction: %v", err)
+	}
+	// Setting directed read options in a read/write transaction is not allowed.
+	if _, err := tx.ExecContext(ctx, "SET DIRECTED_READ = '{\"includeReplicas\":{}}'"); spanner.ErrCode(err) != codes.FailedPrecondition {
+		t.Fatalf("error code mismatch\nGot: %v\nWant: %v", spanner.ErrCode(err), codes.FailedPrecondition)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("failed to rollback read/write transaction: %v", err)
 	}
 }
 
-func TestDdlBatch(t *testing.T) {
+func TestRead(t *testing.T) {
 	t.Parallel()
 
 	ctx := context.Background()
 	db, server, teardown := setupTestDBConnection(t)
 	defer teardown()
+	c, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("failed to get connection: %v", err)
+	}
+	defer c.Close()
 
-	var expectedResponse = &emptypb.Empty{}
-	any, _ := ptypes.MarshalAny(expectedResponse)
-	server.TestDatabaseAdmin.SetResps([]proto.Message{
-		&longrunningpb.Operation{
-			Done:   true,
-			Result: &longrunningpb.Operation_Response{Response: any},
-			Name:   "test-operation",
-		},
-	})
+	read := func(name string, opts *spanner.ReadOptions) *sppb.ReadRequest {
+		var values []int64
+		if err := c.Raw(func(driverConn interface{}) error {
+			rows, err := driverConn.(SpannerConn).Read(ctx, "BAR", spanner.KeySets(spanner.Key{1}, spanner.Key{2}), []string{"FOO"}, opts)
+			if err != nil {
+				return err
+			}
+			defer rows.Close()
+			if g, w := rows.Columns(), []string{"FOO"}; !cmp.Equal(g, w) {
+				return fmt.Errorf("columns mismatch\nGot: %v\nWant: %v", g, w)
+			}
+			dest := make([]driver.Value, 1)
+			for {
+				if err := rows.Next(dest); err == io.EOF {
+					return nil
+				} else if err != nil {
+					return err
+				}
+				values = append(values, dest[0].(int64))
+			}
+		}); err != nil {
+			t.Fatalf("%s: read failed: %v", name, err)
+		}
+		if g, w := values, []int64{1, 2}; !cmp.Equal(g, w) {
+			t.Fatalf("%s: values mismatch\nGot: %v\nWant: %v", name, g, w)
+		}
+		requests := drainRequestsFromServer(server.TestSpanner)
+		readRequests := requestsOfType(requests, reflect.TypeOf(&sppb.ReadRequest{}))
+		if g, w := len(readRequests), 1; g != w {
+			t.Fatalf("%s: read requests count mismatch\nGot: %v\nWant: %v", name, g, w)
+		}
+		req := readRequests[0].(*sppb.ReadRequest)
+		if g, w := req.Table, "BAR"; g != w {
+			t.Fatalf("%s: table mismatch\nGot: %v\nWant: %v", name, g, w)
+		}
+		if g, w := len(req.KeySet.Keys), 2; g != w {
+			t.Fatalf("%s: key count mismatch\nGot: %v\nWant: %v", name, g, w)
+		}
+		return req
+	}
 
-	statements := []string{"CREATE TABLE FOO", "CREATE TABLE BAR"}
-	conn, err := db.Conn(ctx)
-	defer conn.Close()
+	// Reads in autocommit mode use a single-use read-only transaction.
+	req := read("autocommit", &spanner.ReadOptions{Index: "IDX_BAR_FOO"})
+	if req.Transaction.GetSingleUse().GetReadOnly() == nil {
+		t.Fatalf("autocommit: missing single-use read-only transaction: %v", req.Transaction)
+	}
+	if g, w := req.Index, "IDX_BAR_FOO"; g != w {
+		t.Fatalf("autocommit: index mismatch\nGot: %v\nWant: %v", g, w)
+	}
 
-	if _, err = conn.ExecContext(ctx, "START BATCH DDL"); err != nil {
-		t.Fatalf("failed to start DDL batch: %v", err)
+	// Reads in a read-only transaction use the transaction.
+	tx, err := c.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		t.Fatalf("failed to begin read-only transaction: %v", err)
 	}
-	for _, stmt := range statements {
-		if _, err = conn.ExecContext(ctx, stmt); err != nil {
-			t.Fatalf("failed to execute statement in DDL batch: %v", err)
-		}
+	req = read("read-only transaction", nil)
+	if req.Transaction.GetSingleUse() != nil {
+		t.Fatalf("read-only transaction: unexpected single-use transaction: %v", req.Transaction)
 	}
-	if _, err = conn.ExecContext(ctx, "RUN BATCH"); err != nil {
-		t.Fatalf("failed to run DDL batch: %v", err)
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("failed to commit read-only transaction: %v", err)
 	}
 
-	requests := server.TestDatabaseAdmin.Reqs()
-	if g, w := len(requests), 1; g != w {
-		t.Fatalf("requests count mismatch\nGot: %v\nWant: %v", g, w)
+	// Reads in a read/write transaction use the transaction.
+	tx, err = c.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		t.Fatalf("failed to begin read/write transaction: %v", err)
 	}
-	if req, ok := requests[0].(*databasepb.UpdateDatabaseDdlRequest); ok {
-		if g, w := len(req.Statements), len(statements); g != w {
-			t.Fatalf("statement count mismatch\nGot: %v\nWant: %v", g, w)
-		}
-		for i, stmt := range statements {
-			if g, w := req.Statements[i], stmt; g != w {
-				t.Fatalf("statement mismatch\nGot: %v\nWant: %v", g, w)
-			}
-		}
-	} else {
-		t.Fatalf("request type mismatch, got %v", requests[0])
+	req = read("read/write transaction", nil)
+	if req.Transaction.GetSingleUse() != nil {
+		t.Fatalf("read/write transaction: unexpected single-use transaction: %v", req.Transaction)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("failed to commit read/write transaction: %v", err)
 	}
 }
 
-func TestAbortDdlBatch(t *testing.T) {
+func TestDirectedReadInReadWriteTransaction(t *testing.T) {
 	t.Parallel()
 
 	ctx := context.Background()
-	db, server, teardown := setupTestDBConnection(t)
+	db, server, teardown := setupTestDBConnectionWithParams(t, `directed_read={"includeReplicas":{"replicaSelections":[{"location":"us-east1"}]}}`)
 	defer teardown()
 
-	statements := []string{"CREATE TABLE FOO", "CREATE TABLE BAR"}
-	c, err := db.Conn(ctx)
-	defer c.Close()
-
-	if _, err = c.ExecContext(ctx, "START BATCH DDL"); err != nil {
-		t.Fatalf("failed to start DDL batch: %v", err)
+	// Read/write transactions can be used on a connection with directed read
+	// options from the connection string. The options are not included in
+	// the statements of the transaction.
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		t.Fatalf("failed to begin read/write transaction: %v", err)
 	}
-	for _, stmt := range statements {
-		if _, err = c.ExecContext(ctx, stmt); err != nil {
-			t.Fatalf("failed to execute statement in DDL batch: %v", err)
-		}
+	rows, err := tx.QueryContext(ctx, testutil.SelectFooFromBar)
+	if err != nil {
+		t.Fatalf("failed to execute query: %v", err)
 	}
-	// Check that the statements have been batched.
-	_ = c.Raw(func(driverConn interface{}) error {
-		conn := driverConn.(*conn)
-		if conn.batch == nil {
-			t.Fatalf("missing batch on connection")
-		}
-		if g, w := len(conn.batch.statements), 2; g != w {
-			t.Fatalf("batch length mismatch\nGot: %v\nWant: %v", g, w)
+	for rows.Next() {
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("failed to iterate over query result: %v", err)
+	}
+	_ = rows.Close()
+	if _, err := tx.ExecContext(ctx, testutil.UpdateBarSetFoo); err != nil {
+		t.Fatalf("failed to execute update: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("failed to commit read/write transaction: %v", err)
+	}
+	requests := drainRequestsFromServer(server.TestSpanner)
+	sqlRequests := requestsOfType(requests, reflect.TypeOf(&sppb.ExecuteSqlRequest{}))
+	if g, w := len(sqlRequests), 2; g != w {
+		t.Fatalf("sql requests count mismatch\nGot: %v\nWant: %v", g, w)
+	}
+	for i, req := range sqlRequests {
+		if opts := req.(*sppb.ExecuteSqlRequest).DirectedReadOptions; opts != nil {
+			t.Fatalf("%d: unexpected directed read options in read/write transaction: %v", i, opts)
 		}
-		return nil
-	})
-
-	if _, err = c.ExecContext(ctx, "ABORT BATCH"); err != nil {
-		t.Fatalf("failed to abort DDL batch: %v", err)
 	}
+}
 
-	requests := server.TestDatabaseAdmin.Reqs()
-	if g, w := len(requests), 0; g != w {
-		t.Fatalf("requests count mismatch\nGot: %v\nWant: %v", g, w)
-	}
+func TestDirectedReadInvalidConnectionString(t *testing.T) {
+	t.Parallel()
 
-	_ = c.Raw(func(driverConn interface{}) error {
-		spannerConn := driverConn.(SpannerConn)
-		if spannerConn.InDDLBatch() {
-			t.Fatalf("connection still has an active DDL batch")
-		}
-		return nil
-	})
+	server, _, serverTeardown := setupMockedTestServer(t)
+	defer serverTeardown()
+	_, err := sql.Open("spanner", fmt.Sprintf("%s/projects/p/instances/i/databases/d?useplaintext=true;directed_read={", server.Address))
+	if g, w := spanner.ErrCode(err), codes.InvalidArgument; g != w {
+		t.Fatalf("error code mismatch\nGot: %v\nWant: %v", g, w)
+	}
 }
 
-func TestShowAndSetVariableRetryAbortsInternally(t *testing.T) {
+func TestMutationBatch(t *testing.T) {
 	t.Parallel()
 
 	ctx := context.Background()
 	db, server, teardown := setupTestDBConnection(t)
 	defer teardown()
-
 	c, err := db.Conn(ctx)
 	if err != nil {
-		t.Fatalf("failed to obtain a connection: %v", err)
+		t.Fatalf("failed to get connection: %v", err)
 	}
 	defer c.Close()
 
-	for _, tc := range []struct {
-		expected bool
-		set      bool
-	}{
-		{expected: true, set: false},
-		{expected: false, set: true},
-		{expected: true, set: true},
-	} {
-		// Get the current value.
-		rows, err := c.QueryContext(ctx, "SHOW VARIABLE RETRY_ABORTS_INTERNALLY")
-		if err != nil {
-			t.Fatalf("failed to execute get variable retry_aborts_internally: %v", err)
+	var commitTimestamps []time.Time
+	if err := c.Raw(func(driverConn interface{}) error {
+		spannerConn := driverConn.(SpannerConn)
+		if g, w := spannerConn.MaxMutationsPerCommit(), defaultMaxMutationsPerCommit; g != w {
+			return fmt.Errorf("max mutations per commit mismatch\nGot: %v\nWant: %v", g, w)
 		}
-		defer rows.Close()
-		for rows.Next() {
-			var retry bool
-			if err := rows.Scan(&retry); err != nil {
-				t.Fatalf("failed to scan value for retry_aborts_internally: %v", err)
+		if err := spannerConn.SetMaxMutationsPerCommit(0); spanner.ErrCode(err) != codes.InvalidArgument {
+			return fmt.Errorf("error code mismatch\nGot: %v\nWant: %v", spanner.ErrCode(err), codes.InvalidArgument)
+		}
+		// Limit the number of mutations per commit to 3. The first commit
+		// will contain three inserts, and the second commit will contain one
+		// update and one delete.
+		if err := spannerConn.SetMaxMutationsPerCommit(3); err != nil {
+			return err
+		}
+		if err := spannerConn.StartBatchMutations(); err != nil {
+			return err
+		}
+		if !spannerConn.InMutationBatch() {
+			return fmt.Errorf("connection not in mutation batch")
+		}
+		for i := int64(0); i < 3; i++ {
+			ts, err := spannerConn.Apply(ctx, []*spanner.Mutation{
+				spanner.Insert("Accounts", []string{"AccountId", "Nickname"}, []interface{}{i, "Foo"}),
+			})
+			if err != nil {
+				return err
 			}
-			if g, w := retry, tc.expected; g != w {
-				t.Fatalf("retry_aborts_internally mismatch\nGot: %v\nWant: %v", g, w)
+			if !ts.IsZero() {
+				return fmt.Errorf("unexpected commit timestamp for buffered mutation: %v", ts)
 			}
 		}
-		if err := rows.Err(); err != nil {
-			t.Fatalf("failed to iterate over result for get variable retry_aborts_internally: %v", err)
+		if err := spannerConn.BufferWrite([]*spanner.Mutation{
+			spanner.Update("Accounts", []string{"AccountId", "Nickname"}, []interface{}{int64(1), "Bar"}),
+			spanner.Delete("Accounts", spanner.Key{int64(2)}),
+		}); err != nil {
+			return err
 		}
-
-		// Check that the behavior matches the setting.
-		tx, _ := c.BeginTx(ctx, nil)
-		server.TestSpanner.PutExecutionTime(testutil.MethodCommitTransaction, testutil.SimulatedExecutionTime{
-			Errors: []error{gstatus.Error(codes.Aborted, "Aborted")},
-		})
-		err = tx.Commit()
-		if tc.expected && err != nil {
-			t.Fatalf("unexpected error for commit: %v", err)
-		} else if !tc.expected && spanner.ErrCode(err) != codes.Aborted {
-			t.Fatalf("error code mismatch\nGot: %v\nWant: %v", spanner.ErrCode(err), codes.Aborted)
+		commitTimestamps, err = spannerConn.RunMutationBatch(ctx)
+		if err != nil {
+			return err
 		}
-
-		// Set a new value for the variable.
-		if _, err := c.ExecContext(ctx, fmt.Sprintf("SET RETRY_ABORTS_INTERNALLY = %v", tc.set)); err != nil {
-			t.Fatalf("failed to set value for retry_aborts_internally: %v", err)
+		if spannerConn.InMutationBatch() {
+			return fmt.Errorf("connection still in mutation batch")
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("failed to run mutation batch: %v", err)
+	}
+	requests := drainRequestsFromServer(server.TestSpanner)
+	commitRequests := requestsOfType(requests, reflect.TypeOf(&sppb.CommitRequest{}))
+	if g, w := len(commitRequests), 2; g != w {
+		t.Fatalf("commit requests count mismatch\nGot: %v\nWant: %v", g, w)
+	}
+	if g, w := len(commitTimestamps), 2; g != w {
+		t.Fatalf("commit timestamps count mismatch\nGot: %v\nWant: %v", g, w)
+	}
+	for i, want := range []int{3, 2} {
+		if g, w := len(commitRequests[i].(*sppb.CommitRequest).Mutations), want; g != w {
+			t.Fatalf("%d: mutations count mismatch\nGot: %v\nWant: %v", i, g, w)
+		}
+		if commitTimestamps[i].IsZero() {
+			t.Fatalf("%d: missing commit timestamp", i)
 		}
 	}
 
-	// Verify that the value cannot be set during a transaction.
-	tx, _ := c.BeginTx(ctx, nil)
-	defer tx.Rollback()
-	_, err = c.ExecContext(ctx, "SET RETRY_ABORTS_INTERNALLY = TRUE")
-	if g, w := spanner.ErrCode(err), codes.FailedPrecondition; g != w {
-		t.Fatalf("error code mismatch for setting retry_aborts_internally during a transaction\nGot: %v\nWant: %v", g, w)
+	// Aborting a mutation batch discards all buffered mutations.
+	if err := c.Raw(func(driverConn interface{}) error {
+		spannerConn := driverConn.(SpannerConn)
+		if err := spannerConn.StartBatchMutations(); err != nil {
+			return err
+		}
+		if _, err := spannerConn.Apply(ctx, []*spanner.Mutation{
+			spanner.Insert("Accounts", []string{"AccountId", "Nickname"}, []interface{}{int64(1), "Foo"}),
+		}); err != nil {
+			return err
+		}
+		return spannerConn.AbortBatch()
+	}); err != nil {
+		t.Fatalf("failed to abort mutation batch: %v", err)
+	}
+	requests = drainRequestsFromServer(server.TestSpanner)
+	if g, w := len(requestsOfType(requests, reflect.TypeOf(&sppb.CommitRequest{}))), 0; g != w {
+		t.Fatalf("commit requests count mismatch\nGot: %v\nWant: %v", g, w)
 	}
 }
 
-func TestPartitionedDml(t *testing.T) {
+func TestMutationBatch_CommitFailure(t *testing.T) {
 	t.Parallel()
 
 	ctx := context.Background()
 	db, server, teardown := setupTestDBConnection(t)
 	defer teardown()
-
 	c, err := db.Conn(ctx)
 	if err != nil {
-		t.Fatalf("failed to obtain a connection: %v", err)
+		t.Fatalf("failed to get connection: %v", err)
 	}
 	defer c.Close()
 
-	if _, err := c.ExecContext(ctx, "set autocommit_dml_mode = 'Partitioned_Non_Atomic'"); err != nil {
-		t.Fatalf("could not set autocommit dml mode: %v", err)
-	}
-
-	server.TestSpanner.PutStatementResult("DELETE FROM Foo WHERE TRUE", &testutil.StatementResult{
-		Type:        testutil.StatementResultUpdateCount,
-		UpdateCount: 200,
+	// The first commit succeeds and the second commit fails.
+	server.TestSpanner.PutExecutionTime(testutil.MethodCommitTransaction, testutil.SimulatedExecutionTime{
+		Errors: []error{nil, gstatus.Error(codes.FailedPrecondition, "Invalid mutation")},
 	})
-	// The following statement should be executed using PDML instead of DML.
-	res, err := c.ExecContext(ctx, "DELETE FROM Foo WHERE TRUE")
-	if err != nil {
-		t.Fatalf("could not execute DML statement: %v", err)
-	}
-	affected, _ := res.RowsAffected()
-	if affected != 200 {
-		t.Fatalf("affected rows mismatch\nGot: %v\nWant: %v", affected, 200)
+	var mutations []*spanner.Mutation
+	for i := int64(0); i < 5; i++ {
+		mutations = append(mutations, spanner.Insert("Accounts", []string{"AccountId", "Nickname"}, []interface{}{i, "Foo"}))
 	}
-	requests := drainRequestsFromServer(server.TestSpanner)
-	beginRequests := requestsOfType(requests, reflect.TypeOf(&sppb.BeginTransactionRequest{}))
-	var beginPdml *sppb.BeginTransactionRequest
-	for _, req := range beginRequests {
-		if req.(*sppb.BeginTransactionRequest).Options.GetPartitionedDml() != nil {
-			beginPdml = req.(*sppb.BeginTransactionRequest)
-			break
+	var commitTimestamps []time.Time
+	var batchErr error
+	if err := c.Raw(func(driverConn interface{}) error {
+		spannerConn := driverConn.(SpannerConn)
+		if err := spannerConn.SetMaxMutationsPerCommit(2); err != nil {
+			return err
+		}
+		if err := spannerConn.StartBatchMutations(); err != nil {
+			return err
+		}
+		if err := spannerConn.BufferWrite(mutations); err != nil {
+			return err
+		}
+		commitTimestamps, batchErr = spannerConn.RunMutationBatch(ctx)
+		if spannerConn.InMutationBatch() {
+			return fmt.Errorf("connection still in mutation batch")
 		}
+		return nil
+	}); err != nil {
+		t.Fatalf("failed to run mutation batch: %v", err)
 	}
-	if beginPdml == nil {
-		t.Fatal("no begin request for Partitioned DML found")
+	if g, w := spanner.ErrCode(batchErr), codes.FailedPrecondition; g != w {
+		t.Fatalf("error code mismatch\nGot: %v\nWant: %v", g, w)
 	}
-	sqlRequests := requestsOfType(requests, reflect.TypeOf(&sppb.ExecuteSqlRequest{}))
-	if len(sqlRequests) != 1 {
-		t.Fatalf("sql requests count mismatch\nGot: %v\nWant: %v", len(sqlRequests), 1)
+	var mutationBatchErr *MutationBatchError
+	if !errors.As(batchErr, &mutationBatchErr) {
+		t.Fatalf("unexpected error type: %v", batchErr)
 	}
-	req := sqlRequests[0].(*sppb.ExecuteSqlRequest)
-	if req.Transaction == nil || req.Transaction.GetId() == nil {
-		t.Fatal("missing transaction id for sql request")
+	if g, w := mutationBatchErr.Index, 2; g != w {
+		t.Fatalf("index mismatch\nGot: %v\nWant: %v", g, w)
 	}
-	if !server.TestSpanner.IsPartitionedDmlTransaction(req.Transaction.GetId()) {
-		t.Fatalf("sql request did not use a PDML transaction")
+	if g, w := len(mutationBatchErr.Mutations), 3; g != w {
+		t.Fatalf("unwritten mutations count mismatch\nGot: %v\nWant: %v", g, w)
+	}
+	for i, m := range mutationBatchErr.Mutations {
+		if m != mutations[i+2] {
+			t.Fatalf("%d: unwritten mutation mismatch", i)
+		}
+	}
+	if g, w := len(commitTimestamps), 1; g != w {
+		t.Fatalf("commit timestamps count mismatch\nGot: %v\nWant: %v", g, w)
+	}
+	requests := drainRequestsFromServer(server.TestSpanner)
+	if g, w := len(requestsOfType(requests, reflect.TypeOf(&sppb.CommitRequest{}))), 2; g != w {
+		t.Fatalf("commit requests count mismatch\nGot: %v\nWant: %v", g, w)
 	}
 }
 
-func TestAutocommitBatchDml(t *testing.T) {
+func TestMutationBatchInTransaction(t *testing.T) {
 	t.Parallel()
 
 	ctx := context.Background()
-	db, server, teardown := setupTestDBConnection(t)
+	db, _, teardown := setupTestDBConnection(t)
 	defer teardown()
-
 	c, err := db.Conn(ctx)
 	if err != nil {
-		t.Fatalf("failed to obtain a connection: %v", err)
+		t.Fatalf("failed to get connection: %v", err)
 	}
 	defer c.Close()
 
-	if _, err := c.ExecContext(ctx, "START BATCH DML"); err != nil {
-		t.Fatalf("could not start a DML batch: %v", err)
+	tx, err := c.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		t.Fatalf("failed to begin transaction: %v", err)
 	}
-	server.TestSpanner.PutStatementResult("INSERT INTO Foo (Id, Val) VALUES (1, 'One')", &testutil.StatementResult{
-		Type:        testutil.StatementResultUpdateCount,
-		UpdateCount: 1,
-	})
-	server.TestSpanner.PutStatementResult("INSERT INTO Foo (Id, Val) VALUES (2, 'Two')", &testutil.StatementResult{
-		Type:        testutil.StatementResultUpdateCount,
-		UpdateCount: 1,
+	err = c.Raw(func(driverConn interface{}) error {
+		return driverConn.(SpannerConn).StartBatchMutations()
 	})
+	if g, w := spanner.ErrCode(err), codes.FailedPrecondition; g != w {
+		t.Fatalf("error code mismatch\nGot: %v\nWant: %v", g, w)
+	}
+	_ = tx.Rollback()
+}
 
-	// The following statements should be batched locally and only sent to Spanner once
-	// 'RUN BATCH' is executed.
-	res, err := c.ExecContext(ctx, "INSERT INTO Foo (Id, Val) VALUES (1, 'One')")
+func TestBatchWrite(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db, server, teardown := setupTestDBConnection(t)
+	defer teardown()
+	c, err := db.Conn(ctx)
 	if err != nil {
-		t.Fatalf("could not execute DML statement: %v", err)
+		t.Fatalf("failed to get connection: %v", err)
 	}
-	affected, _ := res.RowsAffected()
-	if affected != 0 {
-		t.Fatalf("affected rows mismatch\nGot: %v\nWant: %v", affected, 0)
+	defer c.Close()
+
+	var responses []*sppb.BatchWriteResponse
+	if err := c.Raw(func(driverConn interface{}) error {
+		it, err := driverConn.(SpannerConn).BatchWrite(ctx, []*spanner.MutationGroup{
+			{Mutations: []*spanner.Mutation{
+				spanner.Insert("Singers", []string{"SingerId", "Name"}, []interface{}{int64(1), "Foo"}),
+			}},
+			{Mutations: []*spanner.Mutation{
+				spanner.Insert("Singers", []string{"SingerId", "Name"}, []interface{}{int64(2), "Bar"}),
+				spanner.Insert("Albums", []string{"SingerId", "AlbumId", "Title"}, []interface{}{int64(2), int64(1), "Baz"}),
+			}},
+		})
+		if err != nil {
+			return err
+		}
+		return it.Do(func(r *sppb.BatchWriteResponse) error {
+			responses = append(responses, r)
+			return nil
+		})
+	}); err != nil {
+		t.Fatalf("batch write failed: %v", err)
 	}
-	res, err = c.ExecContext(ctx, "INSERT INTO Foo (Id, Val) VALUES (2, 'Two')")
-	if err != nil {
-		t.Fatalf("could not execute DML statement: %v", err)
+	if g, w := len(responses), 2; g != w {
+		t.Fatalf("response count mismatch\nGot: %v\nWant: %v", g, w)
 	}
-	affected, _ = res.RowsAffected()
-	if affected != 0 {
-		t.Fatalf("affected rows mismatch\nGot: %v\nWant: %v", affected, 0)
+	for i, r := range responses {
+		if g, w := r.Indexes, []int32{int32(i)}; !cmp.Equal(g, w) {
+			t.Fatalf("%d: indexes mismatch\nGot: %v\nWant: %v", i, g, w)
+		}
+		if g, w := codes.Code(r.Status.Code), codes.OK; g != w {
+			t.Fatalf("%d: status mismatch\nGot: %v\nWant: %v", i, g, w)
+		}
+		if r.CommitTimestamp == nil {
+			t.Fatalf("%d: missing commit timestamp", i)
+		}
 	}
-
-	// There should be no ExecuteSqlRequest statements on the server.
 	requests := drainRequestsFromServer(server.TestSpanner)
-	sqlRequests := requestsOfType(requests, reflect.TypeOf(&sppb.ExecuteSqlRequest{}))
-	if len(sqlRequests) != 0 {
-		t.Fatalf("sql requests count mismatch\nGot: %v\nWant: %v", len(sqlRequests), 0)
+	batchWriteRequests := requestsOfType(requests, reflect.TypeOf(&sppb.BatchWriteRequest{}))
+	if g, w := len(batchWriteRequests), 1; g != w {
+		t.Fatalf("batch write requests count mismatch\nGot: %v\nWant: %v", g, w)
 	}
-	batchRequests := requestsOfType(requests, reflect.TypeOf(&sppb.ExecuteBatchDmlRequest{}))
-	if len(batchRequests) != 0 {
-		t.Fatalf("BatchDML requests count mismatch\nGot: %v\nWant: %v", len(batchRequests), 0)
+	if g, w := len(batchWriteRequests[0].(*sppb.BatchWriteRequest).MutationGroups), 2; g != w {
+		t.Fatalf("mutation groups count mismatch\nGot: %v\nWant: %v", g, w)
 	}
 
-	// Execute a RUN BATCH statement. This should trigger a BatchDML request followed by a Commit request.
-	res, err = c.ExecContext(ctx, "RUN BATCH")
-	if err != nil {
-		t.Fatalf("failed to execute RUN BATCH: %v", err)
-	}
-	affected, err = res.RowsAffected()
+	// BatchWrite is not supported in transactions.
+	tx, err := c.BeginTx(ctx, &sql.TxOptions{})
 	if err != nil {
-		t.Fatalf("could not get rows affected from batch: %v", err)
+		t.Fatalf("failed to begin transaction: %v", err)
 	}
-	if affected != 2 {
-		t.Fatalf("affected rows mismatch\nGot: %v\nWant: %v", affected, 2)
+	err = c.Raw(func(driverConn interface{}) error {
+		_, err := driverConn.(SpannerConn).BatchWrite(ctx, []*spanner.MutationGroup{})
+		return err
+	})
+	if g, w := spanner.ErrCode(err), codes.FailedPrecondition; g != w {
+		t.Fatalf("error code mismatch\nGot: %v\nWant: %v", g, w)
 	}
+	_ = tx.Rollback()
+}
 
-	requests = drainRequestsFromServer(server.TestSpanner)
-	// There should still be no ExecuteSqlRequests on the server.
-	sqlRequests = requestsOfType(requests, reflect.TypeOf(&sppb.ExecuteSqlRequest{}))
-	if len(sqlRequests) != 0 {
-		t.Fatalf("sql requests count mismatch\nGot: %v\nWant: %v", len(sqlRequests), 0)
-	}
-	batchRequests = requestsOfType(requests, reflect.TypeOf(&sppb.ExecuteBatchDmlRequest{}))
-	if len(batchRequests) != 1 {
-		t.Fatalf("BatchDML requests count mismatch\nGot: %v\nWant: %v", len(batchRequests), 1)
-	}
-	// The transaction should also have been committed.
-	commitRequests := requestsOfType(requests, reflect.TypeOf(&sppb.CommitRequest{}))
-	if len(commitRequests) != 1 {
-		t.Fatalf("Commit requests count mismatch\nGot: %v\nWant: %v", len(commitRequests), 1)
-	}
-}
-
-func TestTransactionBatchDml(t *testing.T) {
+func TestDmlAsMutations(t *testing.T) {
 	t.Parallel()
 
 	ctx := context.Background()
 	db, server, teardown := setupTestDBConnection(t)
 	defer teardown()
-
-	tx, err := db.BeginTx(ctx, nil)
+	c, err := db.Conn(ctx)
 	if err != nil {
-		t.Fatalf("failed to start transaction: %v", err)
+		t.Fatalf("failed to get connection: %v", err)
 	}
-
-	if _, err := tx.ExecContext(ctx, "START BATCH DML"); err != nil {
-		t.Fatalf("could not start a DML batch: %v", err)
+	defer c.Close()
+	if _, err := c.ExecContext(ctx, "SET DML_AS_MUTATIONS = TRUE"); err != nil {
+		t.Fatalf("failed to enable dml as mutations: %v", err)
 	}
-	server.TestSpanner.PutStatementResult("INSERT INTO Foo (Id, Val) VALUES (1, 'One')", &testutil.StatementResult{
-		Type:        testutil.StatementResultUpdateCount,
-		UpdateCount: 1,
+	// The primary key of Albums is (SingerId, AlbumId).
+	_ = server.TestSpanner.PutStatementResult(dialectQuery, &testutil.StatementResult{
+		Type:      testutil.StatementResultResultSet,
+		ResultSet: createStringResultSet("OPTION_VALUE", "GOOGLE_STANDARD_SQL"),
 	})
-	server.TestSpanner.PutStatementResult("INSERT INTO Foo (Id, Val) VALUES (2, 'Two')", &testutil.StatementResult{
-		Type:        testutil.StatementResultUpdateCount,
-		UpdateCount: 1,
+	_ = server.TestSpanner.PutStatementResult(primaryKeyQuery, &testutil.StatementResult{
+		Type:      testutil.StatementResultResultSet,
+		ResultSet: createStringResultSet("COLUMN_NAME", "SingerId", "AlbumId"),
 	})
-
-	// The following statements should be batched locally and only sent to Spanner once
-	// 'RUN BATCH' is executed.
-	res, err := tx.ExecContext(ctx, "INSERT INTO Foo (Id, Val) VALUES (1, 'One')")
-	if err != nil {
-		t.Fatalf("could not execute DML statement: %v", err)
-	}
-	affected, _ := res.RowsAffected()
-	if affected != 0 {
-		t.Fatalf("affected rows mismatch\nGot: %v\nWant: %v", affected, 0)
+	// These statements cannot be converted to mutations, as the WHERE clause
+	// does not consist of exactly the primary key columns.
+	notConverted := []string{
+		"UPDATE Albums SET Title=@title WHERE SingerId=@singer AND AlbumId=@album AND Active=@active",
+		"DELETE FROM Albums WHERE Title=@title",
+		"DELETE FROM Albums WHERE SingerId=@singer",
+	}
+	for _, sql := range notConverted {
+		_ = server.TestSpanner.PutStatementResult(sql, &testutil.StatementResult{
+			Type:        testutil.StatementResultUpdateCount,
+			UpdateCount: 2,
+		})
 	}
-	res, err = tx.ExecContext(ctx, "INSERT INTO Foo (Id, Val) VALUES (2, 'Two')")
+	// Abort the first commit to verify that the mutations are included in the
+	// retried transaction.
+	server.TestSpanner.PutExecutionTime(testutil.MethodCommitTransaction, testutil.SimulatedExecutionTime{
+		Errors: []error{gstatus.Error(codes.Aborted, "Aborted")},
+	})
+
+	tx, err := c.BeginTx(ctx, &sql.TxOptions{})
 	if err != nil {
-		t.Fatalf("could not execute DML statement: %v", err)
+		t.Fatalf("failed to begin transaction: %v", err)
 	}
-	affected, _ = res.RowsAffected()
-	if affected != 0 {
-		t.Fatalf("affected rows mismatch\nGot: %v\nWant: %v", affected, 0)
+	for _, stmt := range []struct {
+		sql  string
+		args []interface{}
+	}{
+		{"INSERT INTO Albums (SingerId, AlbumId, Title) VALUES (@singer, @album, @title)", []interface{}{int64(1), int64(1), "Foo"}},
+		// The WHERE clause is not in primary key order.
+		{"UPDATE Albums SET Title=@title WHERE AlbumId=@album AND SingerId=@singer", []interface{}{sql.Named("title", "Bar"), sql.Named("album", int64(1)), sql.Named("singer", int64(2))}},
+		{"DELETE FROM Albums WHERE AlbumId=@album AND SingerId=@singer", []interface{}{sql.Named("album", int64(3)), sql.Named("singer", int64(4))}},
+		{notConverted[0], []interface{}{sql.Named("title", "Bar"), sql.Named("singer", int64(1)), sql.Named("album", int64(1)), sql.Named("active", true)}},
+		{notConverted[1], []interface{}{"Foo"}},
+		{notConverted[2], []interface{}{int64(1)}},
+		{testutil.UpdateBarSetFoo, nil},
+	} {
+		res, err := tx.ExecContext(ctx, stmt.sql, stmt.args...)
+		if err != nil {
+			t.Fatalf("failed to execute %q: %v", stmt.sql, err)
+		}
+		if c, _ := res.RowsAffected(); c == 0 {
+			t.Fatalf("missing update count for %q", stmt.sql)
+		}
 	}
-
-	// There should be no ExecuteSqlRequest statements on the server.
 	requests := drainRequestsFromServer(server.TestSpanner)
 	sqlRequests := requestsOfType(requests, reflect.TypeOf(&sppb.ExecuteSqlRequest{}))
-	if len(sqlRequests) != 0 {
-		t.Fatalf("sql requests count mismatch\nGot: %v\nWant: %v", len(sqlRequests), 0)
+	// The dialect and the primary key are read once, and are then cached.
+	wantSQL := append(append([]string{dialectQuery, primaryKeyQuery}, notConverted...), testutil.UpdateBarSetFoo)
+	if g, w := len(sqlRequests), len(wantSQL); g != w {
+		t.Fatalf("sql requests count mismatch\nGot: %v\nWant: %v", g, w)
 	}
-	batchRequests := requestsOfType(requests, reflect.TypeOf(&sppb.ExecuteBatchDmlRequest{}))
-	if len(batchRequests) != 0 {
-		t.Fatalf("BatchDML requests count mismatch\nGot: %v\nWant: %v", len(batchRequests), 0)
+	for i, req := range sqlRequests {
+		if g, w := req.(*sppb.ExecuteSqlRequest).Sql, wantSQL[i]; g != w {
+			t.Fatalf("%d: sql mismatch\nGot: %v\nWant: %v", i, g, w)
+		}
 	}
-
-	// Execute a RUN BATCH statement. This should trigger a BatchDML request.
-	res, err = tx.ExecContext(ctx, "RUN BATCH")
-	if err != nil {
-		t.Fatalf("failed to execute RUN BATCH: %v", err)
+	if sqlRequests[1].(*sppb.ExecuteSqlRequest).Transaction.GetSingleUse() == nil {
+		t.Fatal("primary key query was not executed in a single-use transaction")
 	}
-	affected, err = res.RowsAffected()
-	if err != nil {
-		t.Fatalf("could not get rows affected from batch: %v", err)
+	if g, w := sqlRequests[1].(*sppb.ExecuteSqlRequest).Params.GetFields()["schema"].GetStringValue(), ""; g != w {
+		t.Fatalf("schema mismatch\nGot: %v\nWant: %v", g, w)
 	}
-	if affected != 2 {
-		t.Fatalf("affected rows mismatch\nGot: %v\nWant: %v", affected, 2)
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("failed to commit: %v", err)
 	}
-
 	requests = drainRequestsFromServer(server.TestSpanner)
-	// There should still be no ExecuteSqlRequests on the server.
-	sqlRequests = requestsOfType(requests, reflect.TypeOf(&sppb.ExecuteSqlRequest{}))
-	if len(sqlRequests) != 0 {
-		t.Fatalf("sql requests count mismatch\nGot: %v\nWant: %v", len(sqlRequests), 0)
-	}
-	batchRequests = requestsOfType(requests, reflect.TypeOf(&sppb.ExecuteBatchDmlRequest{}))
-	if len(batchRequests) != 1 {
-		t.Fatalf("BatchDML requests count mismatch\nGot: %v\nWant: %v", len(batchRequests), 1)
-	}
-	// The transaction should still be active.
 	commitRequests := requestsOfType(requests, reflect.TypeOf(&sppb.CommitRequest{}))
-	if len(commitRequests) != 0 {
-		t.Fatalf("Commit requests count mismatch\nGot: %v\nWant: %v", len(commitRequests), 0)
-	}
-
-	// Executing another DML statement on the same transaction now that the batch has been
-	// executed should cause the statement to be sent to Spanner.
-	server.TestSpanner.PutStatementResult("INSERT INTO Foo (Id, Val) VALUES (3, 'Three')", &testutil.StatementResult{
-		Type:        testutil.StatementResultUpdateCount,
-		UpdateCount: 1,
-	})
-	if _, err := tx.ExecContext(ctx, "INSERT INTO Foo (Id, Val) VALUES (3, 'Three')"); err != nil {
-		t.Fatalf("failed to execute DML statement after batch: %v", err)
+	if g, w := len(commitRequests), 2; g != w {
+		t.Fatalf("commit requests count mismatch\nGot: %v\nWant: %v", g, w)
 	}
-	if err := tx.Commit(); err != nil {
-		t.Fatalf("failed to commit transaction after batch: %v", err)
+	for i, req := range commitRequests {
+		mutations := req.(*sppb.CommitRequest).Mutations
+		if g, w := len(mutations), 3; g != w {
+			t.Fatalf("%d: mutations count mismatch\nGot: %v\nWant: %v", i, g, w)
+		}
+		if mutations[0].GetInsert() == nil || mutations[1].GetUpdate() == nil || mutations[2].GetDelete() == nil {
+			t.Fatalf("%d: unexpected mutations: %v", i, mutations)
+		}
+		update := mutations[1].GetUpdate()
+		if g, w := update.Columns, []string{"SingerId", "AlbumId", "Title"}; !cmp.Equal(g, w) {
+			t.Fatalf("%d: update columns mismatch\nGot: %v\nWant: %v", i, g, w)
+		}
+		if g, w := update.Values[0].Values[0].GetStringValue(), "2"; g != w {
+			t.Fatalf("%d: update SingerId mismatch\nGot: %v\nWant: %v", i, g, w)
+		}
+		keys := mutations[2].GetDelete().KeySet.Keys
+		if g, w := len(keys), 1; g != w {
+			t.Fatalf("%d: delete keys count mismatch\nGot: %v\nWant: %v", i, g, w)
+		}
+		if g, w := []string{keys[0].Values[0].GetStringValue(), keys[0].Values[1].GetStringValue()}, []string{"4", "3"}; !cmp.Equal(g, w) {
+			t.Fatalf("%d: delete key mismatch\nGot: %v\nWant: %v", i, g, w)
+		}
 	}
 
-	requests = drainRequestsFromServer(server.TestSpanner)
-	// There should now be one ExecuteSqlRequests on the server.
-	sqlRequests = requestsOfType(requests, reflect.TypeOf(&sppb.ExecuteSqlRequest{}))
-	if len(sqlRequests) != 1 {
-		t.Fatalf("sql requests count mismatch\nGot: %v\nWant: %v", len(sqlRequests), 1)
-	}
-	// There should be no new Batch DML requests.
-	batchRequests = requestsOfType(requests, reflect.TypeOf(&sppb.ExecuteBatchDmlRequest{}))
-	if len(batchRequests) != 0 {
-		t.Fatalf("BatchDML requests count mismatch\nGot: %v\nWant: %v", len(batchRequests), 0)
-	}
-	// The transaction should now be committed.
-	commitRequests = requestsOfType(requests, reflect.TypeOf(&sppb.CommitRequest{}))
-	if len(commitRequests) != 1 {
-		t.Fatalf("Commit requests count mismatch\nGot: %v\nWant: %v", len(commitRequests), 1)
+	// DML statements outside transactions are not converted to mutations.
+	if _, err := c.ExecContext(ctx, "DELETE FROM Albums WHERE SingerId=@singer AND AlbumId=@album", int64(1), int64(1)); err == nil {
+		t.Fatal("missing expected error for unknown DML statement in autocommit mode")
 	}
 }
 
-func TestCommitTimestamp(t *testing.T) {
+func TestDmlAsMutations_PostgreSQL(t *testing.T) {
 	t.Parallel()
 
 	ctx := context.Background()
-	db, _, teardown := setupTestDBConnection(t)
+	db, server, teardown := setupTestDBConnectionWithParams(t, "dml_as_mutations=true")
 	defer teardown()
+	_ = server.TestSpanner.PutStatementResult(dialectQuery, &testutil.StatementResult{
+		Type:      testutil.StatementResultResultSet,
+		ResultSet: createStringResultSet("option_value", "POSTGRESQL"),
+	})
+	_ = server.TestSpanner.PutStatementResult(pgPrimaryKeyQuery, &testutil.StatementResult{
+		Type:      testutil.StatementResultResultSet,
+		ResultSet: createStringResultSet("column_name", "id"),
+	})
 
-	conn, err := db.Conn(ctx)
-	defer conn.Close()
-	if err != nil {
-		t.Fatalf("failed to get a connection: %v", err)
-	}
-	tx, err := conn.BeginTx(ctx, nil)
-	if err != nil {
-		t.Fatalf("failed to start transaction: %v", err)
-	}
-	if err := tx.Commit(); err != nil {
-		t.Fatalf("commit failed: %v", err)
-	}
-	// Get the commit timestamp from the connection.
-	// We do this in a simple loop to verify that we can get it multiple times.
-	for i := 0; i < 2; i++ {
-		var ts time.Time
-		if err := conn.Raw(func(driverConn interface{}) error {
-			ts, err = driverConn.(SpannerConn).CommitTimestamp()
-			return err
-		}); err != nil {
-			t.Fatalf("failed to get commit timestamp: %v", err)
+	for _, test := range []struct {
+		sql           string
+		schema        string
+		table         string
+		mutationTable string
+	}{
+		{sql: "DELETE FROM albums WHERE id=@id", schema: "public", table: "albums", mutationTable: "albums"},
+		{sql: "DELETE FROM music.albums WHERE id=@id", schema: "music", table: "albums", mutationTable: "music.albums"},
+	} {
+		tx, err := db.BeginTx(ctx, &sql.TxOptions{})
+		if err != nil {
+			t.Fatalf("failed to begin transaction: %v", err)
 		}
-		if cmp.Equal(time.Time{}, ts) {
-			t.Fatalf("got zero commit timestamp: %v", ts)
+		if _, err := tx.ExecContext(ctx, test.sql, int64(1)); err != nil {
+			t.Fatalf("failed to execute %q: %v", test.sql, err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("failed to commit: %v", err)
+		}
+		requests := drainRequestsFromServer(server.TestSpanner)
+		var keyRequest *sppb.ExecuteSqlRequest
+		for _, req := range requestsOfType(requests, reflect.TypeOf(&sppb.ExecuteSqlRequest{})) {
+			if req.(*sppb.ExecuteSqlRequest).Sql == pgPrimaryKeyQuery {
+				keyRequest = req.(*sppb.ExecuteSqlRequest)
+			}
+		}
+		if keyRequest == nil {
+			t.Fatalf("%s: missing primary key query", test.sql)
+		}
+		params := keyRequest.Params.GetFields()
+		if g, w := []string{params["p1"].GetStringValue(), params["p2"].GetStringValue()}, []string{test.schema, test.table}; !cmp.Equal(g, w) {
+			t.Fatalf("%s: primary key query params mismatch\nGot: %v\nWant: %v", test.sql, g, w)
+		}
+		commitRequests := requestsOfType(requests, reflect.TypeOf(&sppb.CommitRequest{}))
+		if g, w := len(commitRequests), 1; g != w {
+			t.Fatalf("%s: commit requests count mismatch\nGot: %v\nWant: %v", test.sql, g, w)
+		}
+		mutations := commitRequests[0].(*sppb.CommitRequest).Mutations
+		if g, w := len(mutations), 1; g != w {
+			t.Fatalf("%s: mutations count mismatch\nGot: %v\nWant: %v", test.sql, g, w)
+		}
+		if g, w := mutations[0].GetDelete().GetTable(), test.mutationTable; g != w {
+			t.Fatalf("%s: mutation table mismatch\nGot: %v\nWant: %v", test.sql, g, w)
 		}
 	}
 }
 
-func TestCommitTimestampAutocommit(t *testing.T) {
+func TestDmlAsMutations_PrimaryKeyLookup(t *testing.T) {
 	t.Parallel()
 
 	ctx := context.Background()
-	db, _, teardown := setupTestDBConnection(t)
+	db, server, teardown := setupTestDBConnectionWithParams(t, "dml_as_mutations=true")
 	defer teardown()
+	deleteSQL := "DELETE FROM Albums WHERE AlbumId=@album"
+	_ = server.TestSpanner.PutStatementResult(deleteSQL, &testutil.StatementResult{
+		Type:        testutil.StatementResultUpdateCount,
+		UpdateCount: 1,
+	})
+	execDelete := func() []interface{} {
+		tx, err := db.BeginTx(ctx, &sql.TxOptions{})
+		if err != nil {
+			t.Fatalf("failed to begin transaction: %v", err)
+		}
+		if _, err := tx.ExecContext(ctx, deleteSQL, int64(1)); err != nil {
+			t.Fatalf("failed to execute delete: %v", err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("failed to commit: %v", err)
+		}
+		return drainRequestsFromServer(server.TestSpanner)
+	}
+	mutationCount := func(requests []interface{}) int {
+		commitRequests := requestsOfType(requests, reflect.TypeOf(&sppb.CommitRequest{}))
+		return len(commitRequests[len(commitRequests)-1].(*sppb.CommitRequest).Mutations)
+	}
 
-	conn, err := db.Conn(ctx)
-	defer conn.Close()
-	if err != nil {
-		t.Fatalf("failed to get a connection: %v", err)
+	// The statement is executed as DML if the primary key cannot be read.
+	if g, w := mutationCount(execDelete()), 0; g != w {
+		t.Fatalf("mutations count mismatch\nGot: %v\nWant: %v", g, w)
 	}
-	if _, err := conn.ExecContext(ctx, testutil.UpdateBarSetFoo); err != nil {
-		t.Fatalf("failed to execute update: %v", err)
+
+	_ = server.TestSpanner.PutStatementResult(dialectQuery, &testutil.StatementResult{
+		Type:      testutil.StatementResultResultSet,
+		ResultSet: createStringResultSet("OPTION_VALUE", "GOOGLE_STANDARD_SQL"),
+	})
+	_ = server.TestSpanner.PutStatementResult(primaryKeyQuery, &testutil.StatementResult{
+		Type:      testutil.StatementResultResultSet,
+		ResultSet: createStringResultSet("COLUMN_NAME", "AlbumId"),
+	})
+	if g, w := mutationCount(execDelete()), 1; g != w {
+		t.Fatalf("mutations count mismatch\nGot: %v\nWant: %v", g, w)
 	}
-	// Get the commit timestamp from the connection.
-	// We do this in a simple loop to verify that we can get it multiple times.
-	for i := 0; i < 2; i++ {
-		var ts time.Time
-		if err := conn.Raw(func(driverConn interface{}) error {
-			ts, err = driverConn.(SpannerConn).CommitTimestamp()
-			return err
-		}); err != nil {
-			t.Fatalf("failed to get commit timestamp: %v", err)
-		}
-		if cmp.Equal(time.Time{}, ts) {
-			t.Fatalf("got zero commit timestamp: %v", ts)
+
+	// The cached primary key is cleared by DDL statements. The table is
+	// recreated with a different primary key.
+	if _, err := db.ExecContext(ctx, "DROP TABLE Albums"); err != nil {
+		t.Fatalf("failed to drop table: %v", err)
+	}
+	_ = server.TestSpanner.PutStatementResult(primaryKeyQuery, &testutil.StatementResult{
+		Type:      testutil.StatementResultResultSet,
+		ResultSet: createStringResultSet("COLUMN_NAME", "SingerId", "AlbumId"),
+	})
+	requests := execDelete()
+	if g, w := mutationCount(requests), 0; g != w {
+		t.Fatalf("mutations count mismatch after DDL\nGot: %v\nWant: %v", g, w)
+	}
+	var keyQueries int
+	for _, req := range requestsOfType(requests, reflect.TypeOf(&sppb.ExecuteSqlRequest{})) {
+		if req.(*sppb.ExecuteSqlRequest).Sql == primaryKeyQuery {
+			keyQueries++
 		}
 	}
+	if g, w := keyQueries, 1; g != w {
+		t.Fatalf("primary key query count mismatch\nGot: %v\nWant: %v", g, w)
+	}
 }
 
-func TestCommitTimestampFailsAfterRollback(t *testing.T) {
+// createStringResultSet creates a result set with one STRING column that
+// contains the given values.
+func createStringResultSet(name string, values ...string) *sppb.ResultSet {
+	rows := make([]*structpb.ListValue, len(values))
+	for i, v := range values {
+		rows[i] = &structpb.ListValue{Values: []*structpb.Value{{Kind: &structpb.Value_StringValue{StringValue: v}}}}
+	}
+	return &sppb.ResultSet{
+		Metadata: &sppb.ResultSetMetadata{
+			RowType: &sppb.StructType{Fields: []*sppb.StructType_Field{
+				{Name: name, Type: &sppb.Type{Code: sppb.TypeCode_STRING}},
+			}},
+		},
+		Rows: rows,
+	}
+}
+
+func TestCommitResponseOutParameter(t *testing.T) {
 	t.Parallel()
 
 	ctx := context.Background()
-	db, _, teardown := setupTestDBConnection(t)
+	db, server, teardown := setupTestDBConnection(t)
 	defer teardown()
 
-	conn, err := db.Conn(ctx)
-	defer conn.Close()
+	var commitTs time.Time
+	var resp spanner.CommitResponse
+	res, err := db.ExecContext(ctx, testutil.UpdateBarSetFoo, sql.Out{Dest: &commitTs}, sql.Out{Dest: &resp})
 	if err != nil {
-		t.Fatalf("failed to get a connection: %v", err)
+		t.Fatalf("failed to execute dml: %v", err)
 	}
-	tx, err := conn.BeginTx(ctx, nil)
-	if err != nil {
-		t.Fatalf("failed to start transaction: %v", err)
+	if c, _ := res.RowsAffected(); c != testutil.UpdateBarSetFooRowCount {
+		t.Fatalf("update count mismatch\nGot: %v\nWant: %v", c, testutil.UpdateBarSetFooRowCount)
 	}
-	if err := tx.Rollback(); err != nil {
-		t.Fatalf("rollback failed: %v", err)
+	if commitTs.IsZero() {
+		t.Fatal("missing commit timestamp")
 	}
-	// Try to get the commit timestamp from the connection.
-	err = conn.Raw(func(driverConn interface{}) error {
-		_, err = driverConn.(SpannerConn).CommitTimestamp()
-		return err
-	})
-	if g, w := spanner.ErrCode(err), codes.FailedPrecondition; g != w {
-		t.Fatalf("get commit timestamp error code mismatch\n Got: %v\nWant: %v", g, w)
+	if g, w := resp.CommitTs, commitTs; !g.Equal(w) {
+		t.Fatalf("commit timestamp mismatch\nGot: %v\nWant: %v", g, w)
+	}
+	if resp.CommitStats == nil || resp.CommitStats.MutationCount == 0 {
+		t.Fatalf("missing commit stats: %v", resp.CommitStats)
+	}
+	requests := drainRequestsFromServer(server.TestSpanner)
+	commitRequests := requestsOfType(requests, reflect.TypeOf(&sppb.CommitRequest{}))
+	if g, w := len(commitRequests), 1; g != w {
+		t.Fatalf("commit requests count mismatch\nGot: %v\nWant: %v", g, w)
+	}
+	if !commitRequests[0].(*sppb.CommitRequest).ReturnCommitStats {
+		t.Fatal("commit request did not request commit stats")
 	}
-}
-
-func TestCommitTimestampFailsAfterAutocommitQuery(t *testing.T) {
-	t.Parallel()
 
-	ctx := context.Background()
-	db, _, teardown := setupTestDBConnection(t)
-	defer teardown()
+	// Only *time.Time and *spanner.CommitResponse are supported.
+	var s string
+	if _, err := db.ExecContext(ctx, testutil.UpdateBarSetFoo, sql.Out{Dest: &s}); spanner.ErrCode(err) != codes.InvalidArgument {
+		t.Fatalf("error code mismatch\nGot: %v\nWant: %v", spanner.ErrCode(err), codes.InvalidArgument)
+	}
 
-	conn, err := db.Conn(ctx)
-	defer conn.Close()
+	// The commit response cannot be returned for a DML statement in a transaction.
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{})
 	if err != nil {
-		t.Fatalf("failed to get a connection: %v", err)
-	}
-	var v string
-	if err := conn.QueryRowContext(ctx, testutil.SelectFooFromBar).Scan(&v); err != nil {
-		t.Fatalf("failed to execute query: %v", err)
+		t.Fatalf("failed to begin transaction: %v", err)
 	}
-	// Try to get the commit timestamp from the connection. This should not be possible as a query in autocommit mode
-	// will not return a commit timestamp.
-	err = conn.Raw(func(driverConn interface{}) error {
-		_, err = driverConn.(SpannerConn).CommitTimestamp()
-		return err
-	})
-	if g, w := spanner.ErrCode(err), codes.FailedPrecondition; g != w {
-		t.Fatalf("get commit timestamp error code mismatch\n Got: %v\nWant: %v", g, w)
+	if _, err := tx.ExecContext(ctx, testutil.UpdateBarSetFoo, sql.Out{Dest: &commitTs}); spanner.ErrCode(err) != codes.FailedPrecondition {
+		t.Fatalf("error code mismatch\nGot: %v\nWant: %v", spanner.ErrCode(err), codes.FailedPrecondition)
 	}
+	_ = tx.Rollback()
 }
 
-func TestShowVariableCommitTimestamp(t *testing.T) {
+func TestCommitResponseInContext(t *testing.T) {
 	t.Parallel()
 
 	ctx := context.Background()
-	db, _, teardown := setupTestDBConnection(t)
+	db, server, teardown := setupTestDBConnection(t)
 	defer teardown()
 
-	conn, err := db.Conn(ctx)
-	defer conn.Close()
-	if err != nil {
-		t.Fatalf("failed to get a connection: %v", err)
+	// Autocommit DML.
+	var dmlResp spanner.CommitResponse
+	if _, err := db.ExecContext(WithCommitResponse(ctx, &dmlResp), testutil.UpdateBarSetFoo); err != nil {
+		t.Fatalf("failed to execute dml: %v", err)
 	}
-	tx, err := conn.BeginTx(ctx, nil)
-	if err != nil {
-		t.Fatalf("failed to start transaction: %v", err)
+	if dmlResp.CommitTs.IsZero() || dmlResp.CommitStats == nil {
+		t.Fatalf("missing commit response: %v", dmlResp)
+	}
+
+	// Read/write transaction. The context with the commit response is also
+	// used for the statements in the transaction, which should ignore it.
+	var txResp spanner.CommitResponse
+	txCtx := WithCommitResponse(ctx, &txResp)
+	tx, err := db.BeginTx(txCtx, &sql.TxOptions{})
+	if err != nil {
+		t.Fatalf("failed to begin transaction: %v", err)
+	}
+	if _, err := tx.ExecContext(txCtx, testutil.UpdateBarSetFoo); err != nil {
+		t.Fatalf("failed to execute dml: %v", err)
+	}
+	if !txResp.CommitTs.IsZero() {
+		t.Fatal("unexpected commit timestamp before commit")
 	}
 	if err := tx.Commit(); err != nil {
-		t.Fatalf("commit failed: %v", err)
+		t.Fatalf("failed to commit: %v", err)
 	}
-	// Get the commit timestamp from the connection using a custom SQL statement.
-	// We do this in a simple loop to verify that we can get it multiple times.
-	for i := 0; i < 2; i++ {
-		var ts time.Time
-		if err := conn.QueryRowContext(ctx, "SHOW VARIABLE COMMIT_TIMESTAMP").Scan(&ts); err != nil {
-			t.Fatalf("failed to get commit timestamp: %v", err)
-		}
-		if cmp.Equal(time.Time{}, ts) {
-			t.Fatalf("got zero commit timestamp: %v", ts)
+	if txResp.CommitTs.IsZero() {
+		t.Fatal("missing commit timestamp")
+	}
+	if txResp.CommitStats == nil || txResp.CommitStats.MutationCount == 0 {
+		t.Fatalf("missing commit stats: %v", txResp.CommitStats)
+	}
+	requests := drainRequestsFromServer(server.TestSpanner)
+	commitRequests := requestsOfType(requests, reflect.TypeOf(&sppb.CommitRequest{}))
+	if g, w := len(commitRequests), 2; g != w {
+		t.Fatalf("commit requests count mismatch\nGot: %v\nWant: %v", g, w)
+	}
+	for i, req := range commitRequests {
+		if !req.(*sppb.CommitRequest).ReturnCommitStats {
+			t.Fatalf("%d: commit request did not request commit stats", i)
 		}
 	}
 }
 
-func TestMinSessions(t *testing.T) {
+func TestApplyMutationsFailure(t *testing.T) {
 	t.Parallel()
 
-	minSessions := int32(10)
 	ctx := context.Background()
-	db, server, teardown := setupTestDBConnectionWithParams(t, fmt.Sprintf("minSessions=%v", minSessions))
+	db, _, teardown := setupTestDBConnection(t)
 	defer teardown()
 
-	conn, err := db.Conn(ctx)
+	con, err := db.Conn(ctx)
 	if err != nil {
-		t.Fatalf("failed to get a connection: %v", err)
+		t.Fatalf("failed to get connection: %v", err)
 	}
-	var res int64
-	if err := conn.QueryRowContext(ctx, "SELECT 1").Scan(&res); err != nil {
-		t.Fatalf("failed to execute query on connection: %v", err)
+	_, err = con.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		t.Fatalf("failed to begin transaction: %v", err)
 	}
-	// Wait until all sessions have been created.
-	waitFor(t, func() error {
-		created := int32(server.TestSpanner.TotalSessionsCreated())
-		if created != minSessions {
-			return fmt.Errorf("num open sessions mismatch\n Got: %d\nWant: %d", created, minSessions)
+	if g, w := spanner.ErrCode(con.Raw(func(driverConn interface{}) error {
+		spannerConn, ok := driverConn.(SpannerConn)
+		if !ok {
+			return fmt.Errorf("unexpected driver connection %v, expected SpannerConn", driverConn)
 		}
-		return nil
-	})
-	_ = conn.Close()
-	_ = db.Close()
-
-	// Verify that the connector created 10 sessions on the server.
-	reqs := drainRequestsFromServer(server.TestSpanner)
-	createReqs := requestsOfType(reqs, reflect.TypeOf(&sppb.BatchCreateSessionsRequest{}))
-	numCreated := int32(0)
-	for _, req := range createReqs {
-		numCreated += req.(*sppb.BatchCreateSessionsRequest).SessionCount
-	}
-	if g, w := numCreated, minSessions; g != w {
-		t.Errorf("session creation count mismatch\n Got: %v\nWant: %v", g, w)
+		_, err = spannerConn.Apply(ctx, []*spanner.Mutation{
+			spanner.Insert("Accounts", []string{"AccountId", "Nickname", "Balance"}, []interface{}{int64(1), "Foo", int64(50)}),
+			spanner.Insert("Accounts", []string{"AccountId", "Nickname", "Balance"}, []interface{}{int64(2), "Bar", int64(1)}),
+		})
+		return err
+	})), codes.FailedPrecondition; g != w {
+		t.Fatalf("error code mismatch for Apply during transaction\nGot:  %v\nWant: %v", g, w)
 	}
 }
 
-func TestMaxSessions(t *testing.T) {
+func TestBufferWriteMutations(t *testing.T) {
 	t.Parallel()
 
 	ctx := context.Background()
-	db, server, teardown := setupTestDBConnectionWithParams(t, "minSessions=0;maxSessions=2")
+	db, server, teardown := setupTestDBConnection(t)
 	defer teardown()
 
-	var wg sync.WaitGroup
-	for i := 0; i < 20; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			conn, err := db.Conn(ctx)
-			if err != nil {
-				t.Errorf("failed to get a connection: %v", err)
-			}
-			var res int64
-			if err := conn.QueryRowContext(ctx, "SELECT 1").Scan(&res); err != nil {
-				t.Errorf("failed to execute query on connection: %v", err)
-			}
-			_ = conn.Close()
-		}()
+	con, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("failed to get connection: %v", err)
+	}
+	tx, err := con.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		t.Fatalf("failed to begin transaction: %v", err)
+	}
+	if err := con.Raw(func(driverConn interface{}) error {
+		spannerConn, ok := driverConn.(SpannerConn)
+		if !ok {
+			return fmt.Errorf("unexpected driver connection %v, expected SpannerConn", driverConn)
+		}
+		return spannerConn.BufferWrite([]*spanner.Mutation{
+			spanner.Insert("Accounts", []string{"AccountId", "Nickname", "Balance"}, []interface{}{int64(1), "Foo", int64(50)}),
+			spanner.Insert("Accounts", []string{"AccountId", "Nickname", "Balance"}, []interface{}{int64(2), "Bar", int64(1)}),
+		})
+	}); err != nil {
+		t.Fatalf("failed to buffer mutations: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("failed to commit transaction: %v", err)
 	}
-	wg.Wait()
 
-	// Verify that the connector only created 2 sessions on the server.
-	reqs := drainRequestsFromServer(server.TestSpanner)
-	createReqs := requestsOfType(reqs, reflect.TypeOf(&sppb.BatchCreateSessionsRequest{}))
-	numCreated := int32(0)
-	for _, req := range createReqs {
-		numCreated += req.(*sppb.BatchCreateSessionsRequest).SessionCount
+	requests := drainRequestsFromServer(server.TestSpanner)
+	commitRequests := requestsOfType(requests, reflect.TypeOf(&sppb.CommitRequest{}))
+	if g, w := len(commitRequests), 1; g != w {
+		t.Fatalf("commit requests count mismatch\nGot: %v\nWant: %v", g, w)
 	}
-	if g, w := numCreated, int32(2); g != w {
-		t.Errorf("session creation count mismatch\n Got: %v\nWant: %v", g, w)
+	commitRequest := commitRequests[0].(*sppb.CommitRequest)
+	if g, w := len(commitRequest.Mutations), 2; g != w {
+		t.Fatalf("mutation count mismatch\nGot: %v\nWant: %v", g, w)
 	}
 }
 
-func TestClientReuse(t *testing.T) {
+func TestBufferWriteMutationsFails(t *testing.T) {
 	t.Parallel()
 
 	ctx := context.Background()
-	db, server, teardown := setupTestDBConnectionWithParams(t, "minSessions=2")
+	db, _, teardown := setupTestDBConnection(t)
 	defer teardown()
 
-	// Repeatedly get a connection and close it using the same DB instance. These
-	// connections should all share the same Spanner client, and only initialized
-	// one session pool.
-	for i := 0; i < 5; i++ {
-		conn, err := db.Conn(ctx)
-		if err != nil {
-			t.Fatalf("failed to get a connection: %v", err)
-		}
-		var res int64
-		if err := conn.QueryRowContext(ctx, "SELECT 1").Scan(&res); err != nil {
-			t.Fatalf("failed to execute query on connection: %v", err)
-		}
-		_ = conn.Close()
-	}
-	// Verify that the connector only created 2 sessions on the server.
-	reqs := drainRequestsFromServer(server.TestSpanner)
-	createReqs := requestsOfType(reqs, reflect.TypeOf(&sppb.BatchCreateSessionsRequest{}))
-	numCreated := int32(0)
-	for _, req := range createReqs {
-		numCreated += req.(*sppb.BatchCreateSessionsRequest).SessionCount
+	con, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("failed to get connection: %v", err)
 	}
-	if g, w := numCreated, int32(2); g != w {
-		t.Errorf("session creation count mismatch\n Got: %v\nWant: %v", g, w)
+	if g, w := spanner.ErrCode(con.Raw(func(driverConn interface{}) error {
+		spannerConn, ok := driverConn.(SpannerConn)
+		if !ok {
+			return fmt.Errorf("unexpected driver connection %v, expected SpannerConn", driverConn)
+		}
+		return spannerConn.BufferWrite([]*spanner.Mutation{
+			spanner.Insert("Accounts", []string{"AccountId", "Nickname", "Balance"}, []interface{}{int64(1), "Foo", int64(50)}),
+			spanner.Insert("Accounts", []string{"AccountId", "Nickname", "Balance"}, []interface{}{int64(2), "Bar", int64(1)}),
+		})
+	})), codes.FailedPrecondition; g != w {
+		t.Fatalf("error code mismatch for BufferWrite outside transaction\nGot:  %v\nWant: %v", g, w)
 	}
+}
 
-	// Now close the DB instance and create a new DB connection.
-	// This should cause the first Spanner client to be closed and
-	// a new one to be opened.
-	_ = db.Close()
+func TestPing(t *testing.T) {
+	t.Parallel()
 
-	db, err := sql.Open(
-		"spanner",
-		fmt.Sprintf("%s/projects/p/instances/i/databases/d?useplaintext=true;minSessions=2", server.Address))
+	db, _, teardown := setupTestDBConnection(t)
+	defer teardown()
+
+	// Ensure that the old Ping method works.
+	err := db.Ping()
 	if err != nil {
-		t.Fatalf("failed to open new DB instance: %v", err)
+		t.Fatalf("Ping failed: %v", err)
 	}
-	var res int64
-	if err := db.QueryRowContext(ctx, "SELECT 1").Scan(&res); err != nil {
-		t.Fatalf("failed to execute query on db: %v", err)
+}
+
+func TestDdlBatch(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db, server, teardown := setupTestDBConnection(t)
+	defer teardown()
+
+	var expectedResponse = &emptypb.Empty{}
+	any, _ := ptypes.MarshalAny(expectedResponse)
+	server.TestDatabaseAdmin.SetResps([]proto.Message{
+		&longrunningpb.Operation{
+			Done:   true,
+			Result: &longrunningpb.Operation_Response{Response: any},
+			Name:   "test-operation",
+		},
+	})
+
+	statements := []string{"CREATE TABLE FOO", "CREATE TABLE BAR"}
+	conn, err := db.Conn(ctx)
+	defer conn.Close()
+
+	if _, err = conn.ExecContext(ctx, "START BATCH DDL"); err != nil {
+		t.Fatalf("failed to start DDL batch: %v", err)
 	}
-	reqs = drainRequestsFromServer(server.TestSpanner)
-	createReqs = requestsOfType(reqs, reflect.TypeOf(&sppb.BatchCreateSessionsRequest{}))
-	numCreated = int32(0)
-	for _, req := range createReqs {
-		numCreated += req.(*sppb.BatchCreateSessionsRequest).SessionCount
+	for _, stmt := range statements {
+		if _, err = conn.ExecContext(ctx, stmt); err != nil {
+			t.Fatalf("failed to execute statement in DDL batch: %v", err)
+		}
 	}
-	if g, w := numCreated, int32(2); g != w {
-		t.Errorf("session creation count mismatch\n Got: %v\nWant: %v", g, w)
+	if _, err = conn.ExecContext(ctx, "RUN BATCH"); err != nil {
+		t.Fatalf("failed to run DDL batch: %v", err)
+	}
+
+	requests := server.TestDatabaseAdmin.Reqs()
+	if g, w := len(requests), 1; g != w {
+		t.Fatalf("requests count mismatch\nGot: %v\nWant: %v", g, w)
+	}
+	if req, ok := requests[0].(*databasepb.UpdateDatabaseDdlRequest); ok {
+		if g, w := len(req.Statements), len(statements); g != w {
+			t.Fatalf("statement count mismatch\nGot: %v\nWant: %v", g, w)
+		}
+		for i, stmt := range statements {
+			if g, w := req.Statements[i], stmt; g != w {
+				t.Fatalf("statement mismatch\nGot: %v\nWant: %v", g, w)
+			}
+		}
+	} else {
+		t.Fatalf("request type mismatch, got %v", requests[0])
 	}
 }
 
-func TestStressClientReuse(t *testing.T) {
+func TestAbortDdlBatch(t *testing.T) {
 	t.Parallel()
 
 	ctx := context.Background()
-	_, server, teardown := setupTestDBConnection(t)
+	db, server, teardown := setupTestDBConnection(t)
 	defer teardown()
 
-	rand.Seed(time.Now().UnixNano())
-	numSessions := 10
-	numClients := 5
-	numParallel := 50
-	var wg sync.WaitGroup
-	for clientIndex := 0; clientIndex < numClients; clientIndex++ {
-		// Open a DB using a dsn that contains a meaningless number. This will ensure that
-		// the underlying client will be different from the other connections that use a
-		// different number.
-		db, err := sql.Open("spanner",
-			fmt.Sprintf("%s/projects/p/instances/i/databases/d?useplaintext=true;minSessions=%v;maxSessions=%v;randomNumber=%v", server.Address, numSessions, numSessions, clientIndex))
-		if err != nil {
-			t.Fatalf("failed to open DB: %v", err)
+	statements := []string{"CREATE TABLE FOO", "CREATE TABLE BAR"}
+	c, err := db.Conn(ctx)
+	defer c.Close()
+
+	if _, err = c.ExecContext(ctx, "START BATCH DDL"); err != nil {
+		t.Fatalf("failed to start DDL batch: %v", err)
+	}
+	for _, stmt := range statements {
+		if _, err = c.ExecContext(ctx, stmt); err != nil {
+			t.Fatalf("failed to execute statement in DDL batch: %v", err)
+		}
+	}
+	// Check that the statements have been batched.
+	_ = c.Raw(func(driverConn interface{}) error {
+		conn := driverConn.(*conn)
+		if conn.batch == nil {
+			t.Fatalf("missing batch on connection")
+		}
+		if g, w := len(conn.batch.statements), 2; g != w {
+			t.Fatalf("batch length mismatch\nGot: %v\nWant: %v", g, w)
+		}
+		return nil
+	})
+
+	if _, err = c.ExecContext(ctx, "ABORT BATCH"); err != nil {
+		t.Fatalf("failed to abort DDL batch: %v", err)
+	}
+
+	requests := server.TestDatabaseAdmin.Reqs()
+	if g, w := len(requests), 0; g != w {
+		t.Fatalf("requests count mismatch\nGot: %v\nWant: %v", g, w)
+	}
+
+	_ = c.Raw(func(driverConn interface{}) error {
+		spannerConn := driverConn.(SpannerConn)
+		if spannerConn.InDDLBatch() {
+			t.Fatalf("connection still has an active DDL batch")
+		}
+		return nil
+	})
+}
+
+func TestShowAndSetVariableRetryAbortsInternally(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db, server, teardown := setupTestDBConnection(t)
+	defer teardown()
+
+	c, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("failed to obtain a connection: %v", err)
+	}
+	defer c.Close()
+
+	for _, tc := range []struct {
+		expected bool
+		set      bool
+	}{
+		{expected: true, set: false},
+		{expected: false, set: true},
+		{expected: true, set: true},
+	} {
+		// Get the current value.
+		rows, err := c.QueryContext(ctx, "SHOW VARIABLE RETRY_ABORTS_INTERNALLY")
+		if err != nil {
+			t.Fatalf("failed to execute get variable retry_aborts_internally: %v", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var retry bool
+			if err := rows.Scan(&retry); err != nil {
+				t.Fatalf("failed to scan value for retry_aborts_internally: %v", err)
+			}
+			if g, w := retry, tc.expected; g != w {
+				t.Fatalf("retry_aborts_internally mismatch\nGot: %v\nWant: %v", g, w)
+			}
+		}
+		if err := rows.Err(); err != nil {
+			t.Fatalf("failed to iterate over result for get variable retry_aborts_internally: %v", err)
+		}
+
+		// Check that the behavior matches the setting.
+		tx, _ := c.BeginTx(ctx, nil)
+		server.TestSpanner.PutExecutionTime(testutil.MethodCommitTransaction, testutil.SimulatedExecutionTime{
+			Errors: []error{gstatus.Error(codes.Aborted, "Aborted")},
+		})
+		err = tx.Commit()
+		if tc.expected && err != nil {
+			t.Fatalf("unexpected error for commit: %v", err)
+		} else if !tc.expected && spanner.ErrCode(err) != codes.Aborted {
+			t.Fatalf("error code mismatch\nGot: %v\nWant: %v", spanner.ErrCode(err), codes.Aborted)
+		}
+
+		// Set a new value for the variable.
+		if _, err := c.ExecContext(ctx, fmt.Sprintf("SET RETRY_ABORTS_INTERNALLY = %v", tc.set)); err != nil {
+			t.Fatalf("failed to set value for retry_aborts_internally: %v", err)
+		}
+	}
+
+	// Verify that the value cannot be set during a transaction.
+	tx, _ := c.BeginTx(ctx, nil)
+	defer tx.Rollback()
+	_, err = c.ExecContext(ctx, "SET RETRY_ABORTS_INTERNALLY = TRUE")
+	if g, w := spanner.ErrCode(err), codes.FailedPrecondition; g != w {
+		t.Fatalf("error code mismatch for setting retry_aborts_internally during a transaction\nGot: %v\nWant: %v", g, w)
+	}
+}
+
+func TestPartitionedDml(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db, server, teardown := setupTestDBConnection(t)
+	defer teardown()
+
+	c, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("failed to obtain a connection: %v", err)
+	}
+	defer c.Close()
+
+	if _, err := c.ExecContext(ctx, "set autocommit_dml_mode = 'Partitioned_Non_Atomic'"); err != nil {
+		t.Fatalf("could not set autocommit dml mode: %v", err)
+	}
+
+	server.TestSpanner.PutStatementResult("DELETE FROM Foo WHERE TRUE", &testutil.StatementResult{
+		Type:        testutil.StatementResultUpdateCount,
+		UpdateCount: 200,
+	})
+	// The following statement should be executed using PDML instead of DML.
+	res, err := c.ExecContext(ctx, "DELETE FROM Foo WHERE TRUE")
+	if err != nil {
+		t.Fatalf("could not execute DML statement: %v", err)
+	}
+	affected, _ := res.RowsAffected()
+	if affected != 200 {
+		t.Fatalf("affected rows mismatch\nGot: %v\nWant: %v", affected, 200)
+	}
+	requests := drainRequestsFromServer(server.TestSpanner)
+	beginRequests := requestsOfType(requests, reflect.TypeOf(&sppb.BeginTransactionRequest{}))
+	var beginPdml *sppb.BeginTransactionRequest
+	for _, req := range beginRequests {
+		if req.(*sppb.BeginTransactionRequest).Options.GetPartitionedDml() != nil {
+			beginPdml = req.(*sppb.BeginTransactionRequest)
+			break
+		}
+	}
+	if beginPdml == nil {
+		t.Fatal("no begin request for Partitioned DML found")
+	}
+	sqlRequests := requestsOfType(requests, reflect.TypeOf(&sppb.ExecuteSqlRequest{}))
+	if len(sqlRequests) != 1 {
+		t.Fatalf("sql requests count mismatch\nGot: %v\nWant: %v", len(sqlRequests), 1)
+	}
+	req := sqlRequests[0].(*sppb.ExecuteSqlRequest)
+	if req.Transaction == nil || req.Transaction.GetId() == nil {
+		t.Fatal("missing transaction id for sql request")
+	}
+	if !server.TestSpanner.IsPartitionedDmlTransaction(req.Transaction.GetId()) {
+		t.Fatalf("sql request did not use a PDML transaction")
+	}
+}
+
+func TestAutocommitBatchDml(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db, server, teardown := setupTestDBConnection(t)
+	defer teardown()
+
+	c, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("failed to obtain a connection: %v", err)
+	}
+	defer c.Close()
+
+	if _, err := c.ExecContext(ctx, "START BATCH DML"); err != nil {
+		t.Fatalf("could not start a DML batch: %v", err)
+	}
+	server.TestSpanner.PutStatementResult("INSERT INTO Foo (Id, Val) VALUES (1, 'One')", &testutil.StatementResult{
+		Type:        testutil.StatementResultUpdateCount,
+		UpdateCount: 1,
+	})
+	server.TestSpanner.PutStatementResult("INSERT INTO Foo (Id, Val) VALUES (2, 'Two')", &testutil.StatementResult{
+		Type:        testutil.StatementResultUpdateCount,
+		UpdateCount: 1,
+	})
+
+	// The following statements should be batched locally and only sent to Spanner once
+	// 'RUN BATCH' is executed.
+	res, err := c.ExecContext(ctx, "INSERT INTO Foo (Id, Val) VALUES (1, 'One')")
+	if err != nil {
+		t.Fatalf("could not execute DML statement: %v", err)
+	}
+	affected, _ := res.RowsAffected()
+	if affected != 0 {
+		t.Fatalf("affected rows mismatch\nGot: %v\nWant: %v", affected, 0)
+	}
+	res, err = c.ExecContext(ctx, "INSERT INTO Foo (Id, Val) VALUES (2, 'Two')")
+	if err != nil {
+		t.Fatalf("could not execute DML statement: %v", err)
+	}
+	affected, _ = res.RowsAffected()
+	if affected != 0 {
+		t.Fatalf("affected rows mismatch\nGot: %v\nWant: %v", affected, 0)
+	}
+
+	// There should be no ExecuteSqlRequest statements on the server.
+	requests := drainRequestsFromServer(server.TestSpanner)
+	sqlRequests := requestsOfType(requests, reflect.TypeOf(&sppb.ExecuteSqlRequest{}))
+	if len(sqlRequests) != 0 {
+		t.Fatalf("sql requests count mismatch\nGot: %v\nWant: %v", len(sqlRequests), 0)
+	}
+	batchRequests := requestsOfType(requests, reflect.TypeOf(&sppb.ExecuteBatchDmlRequest{}))
+	if len(batchRequests) != 0 {
+		t.Fatalf("BatchDML requests count mismatch\nGot: %v\nWant: %v", len(batchRequests), 0)
+	}
+
+	// Execute a RUN BATCH statement. This should trigger a BatchDML request followed by a Commit request.
+	res, err = c.ExecContext(ctx, "RUN BATCH")
+	if err != nil {
+		t.Fatalf("failed to execute RUN BATCH: %v", err)
+	}
+	affected, err = res.RowsAffected()
+	if err != nil {
+		t.Fatalf("could not get rows affected from batch: %v", err)
+	}
+	if affected != 2 {
+		t.Fatalf("affected rows mismatch\nGot: %v\nWant: %v", affected, 2)
+	}
+
+	requests = drainRequestsFromServer(server.TestSpanner)
+	// There should still be no ExecuteSqlRequests on the server.
+	sqlRequests = requestsOfType(requests, reflect.TypeOf(&sppb.ExecuteSqlRequest{}))
+	if len(sqlRequests) != 0 {
+		t.Fatalf("sql requests count mismatch\nGot: %v\nWant: %v", len(sqlRequests), 0)
+	}
+	batchRequests = requestsOfType(requests, reflect.TypeOf(&sppb.ExecuteBatchDmlRequest{}))
+	if len(batchRequests) != 1 {
+		t.Fatalf("BatchDML requests count mismatch\nGot: %v\nWant: %v", len(batchRequests), 1)
+	}
+	// The transaction should also have been committed.
+	commitRequests := requestsOfType(requests, reflect.TypeOf(&sppb.CommitRequest{}))
+	if len(commitRequests) != 1 {
+		t.Fatalf("Commit requests count mismatch\nGot: %v\nWant: %v", len(commitRequests), 1)
+	}
+}
+
+func TestTransactionBatchDml(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db, server, teardown := setupTestDBConnection(t)
+	defer teardown()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("failed to start transaction: %v", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, "START BATCH DML"); err != nil {
+		t.Fatalf("could not start a DML batch: %v", err)
+	}
+	server.TestSpanner.PutStatementResult("INSERT INTO Foo (Id, Val) VALUES (1, 'One')", &testutil.StatementResult{
+		Type:        testutil.StatementResultUpdateCount,
+		UpdateCount: 1,
+	})
+	server.TestSpanner.PutStatementResult("INSERT INTO Foo (Id, Val) VALUES (2, 'Two')", &testutil.StatementResult{
+		Type:        testutil.StatementResultUpdateCount,
+		UpdateCount: 1,
+	})
+
+	// The following statements should be batched locally and only sent to Spanner once
+	// 'RUN BATCH' is executed.
+	res, err := tx.ExecContext(ctx, "INSERT INTO Foo (Id, Val) VALUES (1, 'One')")
+	if err != nil {
+		t.Fatalf("could not execute DML statement: %v", err)
+	}
+	affected, _ := res.RowsAffected()
+	if affected != 0 {
+		t.Fatalf("affected rows mismatch\nGot: %v\nWant: %v", affected, 0)
+	}
+	res, err = tx.ExecContext(ctx, "INSERT INTO Foo (Id, Val) VALUES (2, 'Two')")
+	if err != nil {
+		t.Fatalf("could not execute DML statement: %v", err)
+	}
+	affected, _ = res.RowsAffected()
+	if affected != 0 {
+		t.Fatalf("affected rows mismatch\nGot: %v\nWant: %v", affected, 0)
+	}
+
+	// There should be no ExecuteSqlRequest statements on the server.
+	requests := drainRequestsFromServer(server.TestSpanner)
+	sqlRequests := requestsOfType(requests, reflect.TypeOf(&sppb.ExecuteSqlRequest{}))
+	if len(sqlRequests) != 0 {
+		t.Fatalf("sql requests count mismatch\nGot: %v\nWant: %v", len(sqlRequests), 0)
+	}
+	batchRequests := requestsOfType(requests, reflect.TypeOf(&sppb.ExecuteBatchDmlRequest{}))
+	if len(batchRequests) != 0 {
+		t.Fatalf("BatchDML requests count mismatch\nGot: %v\nWant: %v", len(batchRequests), 0)
+	}
+
+	// Execute a RUN BATCH statement. This should trigger a BatchDML request.
+	res, err = tx.ExecContext(ctx, "RUN BATCH")
+	if err != nil {
+		t.Fatalf("failed to execute RUN BATCH: %v", err)
+	}
+	affected, err = res.RowsAffected()
+	if err != nil {
+		t.Fatalf("could not get rows affected from batch: %v", err)
+	}
+	if affected != 2 {
+		t.Fatalf("affected rows mismatch\nGot: %v\nWant: %v", affected, 2)
+	}
+
+	requests = drainRequestsFromServer(server.TestSpanner)
+	// There should still be no ExecuteSqlRequests on the server.
+	sqlRequests = requestsOfType(requests, reflect.TypeOf(&sppb.ExecuteSqlRequest{}))
+	if len(sqlRequests) != 0 {
+		t.Fatalf("sql requests count mismatch\nGot: %v\nWant: %v", len(sqlRequests), 0)
+	}
+	batchRequests = requestsOfType(requests, reflect.TypeOf(&sppb.ExecuteBatchDmlRequest{}))
+	if len(batchRequests) != 1 {
+		t.Fatalf("BatchDML requests count mismatch\nGot: %v\nWant: %v", len(batchRequests), 1)
+	}
+	// The transaction should still be active.
+	commitRequests := requestsOfType(requests, reflect.TypeOf(&sppb.CommitRequest{}))
+	if len(commitRequests) != 0 {
+		t.Fatalf("Commit requests count mismatch\nGot: %v\nWant: %v", len(commitRequests), 0)
+	}
+
+	// Executing another DML statement on the same transaction now that the batch has been
+	// executed should cause the statement to be sent to Spanner.
+	server.TestSpanner.PutStatementResult("INSERT INTO Foo (Id, Val) VALUES (3, 'Three')", &testutil.StatementResult{
+		Type:        testutil.StatementResultUpdateCount,
+		UpdateCount: 1,
+	})
+	if _, err := tx.ExecContext(ctx, "INSERT INTO Foo (Id, Val) VALUES (3, 'Three')"); err != nil {
+		t.Fatalf("failed to execute DML statement after batch: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("failed to commit transaction after batch: %v", err)
+	}
+
+	requests = drainRequestsFromServer(server.TestSpanner)
+	// There should now be one ExecuteSqlRequests on the server.
+	sqlRequests = requestsOfType(requests, reflect.TypeOf(&sppb.ExecuteSqlRequest{}))
+	if len(sqlRequests) != 1 {
+		t.Fatalf("sql requests count mismatch\nGot: %v\nWant: %v", len(sqlRequests), 1)
+	}
+	// There should be no new Batch DML requests.
+	batchRequests = requestsOfType(requests, reflect.TypeOf(&sppb.ExecuteBatchDmlRequest{}))
+	if len(batchRequests) != 0 {
+		t.Fatalf("BatchDML requests count mismatch\nGot: %v\nWant: %v", len(batchRequests), 0)
+	}
+	// The transaction should now be committed.
+	commitRequests = requestsOfType(requests, reflect.TypeOf(&sppb.CommitRequest{}))
+	if len(commitRequests) != 1 {
+		t.Fatalf("Commit requests count mismatch\nGot: %v\nWant: %v", len(commitRequests), 1)
+	}
+}
+
+func TestCommitTimestamp(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db, _, teardown := setupTestDBConnection(t)
+	defer teardown()
+
+	conn, err := db.Conn(ctx)
+	defer conn.Close()
+	if err != nil {
+		t.Fatalf("failed to get a connection: %v", err)
+	}
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("failed to start transaction: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("commit failed: %v", err)
+	}
+	// Get the commit timestamp from the connection.
+	// We do this in a simple loop to verify that we can get it multiple times.
+	for i := 0; i < 2; i++ {
+		var ts time.Time
+		if err := conn.Raw(func(driverConn interface{}) error {
+			ts, err = driverConn.(SpannerConn).CommitTimestamp()
+			return err
+		}); err != nil {
+			t.Fatalf("failed to get commit timestamp: %v", err)
+		}
+		if cmp.Equal(time.Time{}, ts) {
+			t.Fatalf("got zero commit timestamp: %v", ts)
+		}
+	}
+}
+
+func TestCommitTimestampAutocommit(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db, _, teardown := setupTestDBConnection(t)
+	defer teardown()
+
+	conn, err := db.Conn(ctx)
+	defer conn.Close()
+	if err != nil {
+		t.Fatalf("failed to get a connection: %v", err)
+	}
+	if _, err := conn.ExecContext(ctx, testutil.UpdateBarSetFoo); err != nil {
+		t.Fatalf("failed to execute update: %v", err)
+	}
+	// Get the commit timestamp from the connection.
+	// We do this in a simple loop to verify that we can get it multiple times.
+	for i := 0; i < 2; i++ {
+		var ts time.Time
+		if err := conn.Raw(func(driverConn interface{}) error {
+			ts, err = driverConn.(SpannerConn).CommitTimestamp()
+			return err
+		}); err != nil {
+			t.Fatalf("failed to get commit timestamp: %v", err)
+		}
+		if cmp.Equal(time.Time{}, ts) {
+			t.Fatalf("got zero commit timestamp: %v", ts)
+		}
+	}
+}
+
+func TestCommitTimestampFailsAfterRollback(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db, _, teardown := setupTestDBConnection(t)
+	defer teardown()
+
+	conn, err := db.Conn(ctx)
+	defer conn.Close()
+	if err != nil {
+		t.Fatalf("failed to get a connection: %v", err)
+	}
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("failed to start transaction: %v", err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("rollback failed: %v", err)
+	}
+	// Try to get the commit timestamp from the connection.
+	err = conn.Raw(func(driverConn interface{}) error {
+		_, err = driverConn.(SpannerConn).CommitTimestamp()
+		return err
+	})
+	if g, w := spanner.ErrCode(err), codes.FailedPrecondition; g != w {
+		t.Fatalf("get commit timestamp error code mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestCommitTimestampFailsAfterAutocommitQuery(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db, _, teardown := setupTestDBConnection(t)
+	defer teardown()
+
+	conn, err := db.Conn(ctx)
+	defer conn.Close()
+	if err != nil {
+		t.Fatalf("failed to get a connection: %v", err)
+	}
+	var v string
+	if err := conn.QueryRowContext(ctx, testutil.SelectFooFromBar).Scan(&v); err != nil {
+		t.Fatalf("failed to execute query: %v", err)
+	}
+	// Try to get the commit timestamp from the connection. This should not be possible as a query in autocommit mode
+	// will not return a commit timestamp.
+	err = conn.Raw(func(driverConn interface{}) error {
+		_, err = driverConn.(SpannerConn).CommitTimestamp()
+		return err
+	})
+	if g, w := spanner.ErrCode(err), codes.FailedPrecondition; g != w {
+		t.Fatalf("get commit timestamp error code mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestShowVariableCommitTimestamp(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db, _, teardown := setupTestDBConnection(t)
+	defer teardown()
+
+	conn, err := db.Conn(ctx)
+	defer conn.Close()
+	if err != nil {
+		t.Fatalf("failed to get a connection: %v", err)
+	}
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("failed to start transaction: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("commit failed: %v", err)
+	}
+	// Get the commit timestamp from the connection using a custom SQL statement.
+	// We do this in a simple loop to verify that we can get it multiple times.
+	for i := 0; i < 2; i++ {
+		var ts time.Time
+		if err := conn.QueryRowContext(ctx, "SHOW VARIABLE COMMIT_TIMESTAMP").Scan(&ts); err != nil {
+			t.Fatalf("failed to get commit timestamp: %v", err)
+		}
+		if cmp.Equal(time.Time{}, ts) {
+			t.Fatalf("got zero commit timestamp: %v", ts)
+		}
+	}
+}
+
+func TestMinSessions(t *testing.T) {
+	t.Parallel()
+
+	minSessions := int32(10)
+	ctx := context.Background()
+	db, server, teardown := setupTestDBConnectionWithParams(t, fmt.Sprintf("minSessions=%v", minSessions))
+	defer teardown()
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("failed to get a connection: %v", err)
+	}
+	var res int64
+	if err := conn.QueryRowContext(ctx, "SELECT 1").Scan(&res); err != nil {
+		t.Fatalf("failed to execute query on connection: %v", err)
+	}
+	// Wait until all sessions have been created.
+	waitFor(t, func() error {
+		created := int32(server.TestSpanner.TotalSessionsCreated())
+		if created != minSessions {
+			return fmt.Errorf("num open sessions mismatch\n Got: %d\nWant: %d", created, minSessions)
+		}
+		return nil
+	})
+	_ = conn.Close()
+	_ = db.Close()
+
+	// Verify that the connector created 10 sessions on the server.
+	reqs := drainRequestsFromServer(server.TestSpanner)
+	createReqs := requestsOfType(reqs, reflect.TypeOf(&sppb.BatchCreateSessionsRequest{}))
+	numCreated := int32(0)
+	for _, req := range createReqs {
+		numCreated += req.(*sppb.BatchCreateSessionsRequest).SessionCount
+	}
+	if g, w := numCreated, minSessions; g != w {
+		t.Errorf("session creation count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestMaxSessions(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db, server, teardown := setupTestDBConnectionWithParams(t, "minSessions=0;maxSessions=2")
+	defer teardown()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn, err := db.Conn(ctx)
+			if err != nil {
+				t.Errorf("failed to get a connection: %v", err)
+			}
+			var res int64
+			if err := conn.QueryRowContext(ctx, "SELECT 1").Scan(&res); err != nil {
+				t.Errorf("failed to execute query on connection: %v", err)
+			}
+			_ = conn.Close()
+		}()
+	}
+	wg.Wait()
+
+	// Verify that the connector only created 2 sessions on the server.
+	reqs := drainRequestsFromServer(server.TestSpanner)
+	createReqs := requestsOfType(reqs, reflect.TypeOf(&sppb.BatchCreateSessionsRequest{}))
+	numCreated := int32(0)
+	for _, req := range createReqs {
+		numCreated += req.(*sppb.BatchCreateSessionsRequest).SessionCount
+	}
+	if g, w := numCreated, int32(2); g != w {
+		t.Errorf("session creation count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestClientReuse(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db, server, teardown := setupTestDBConnectionWithParams(t, "minSessions=2")
+	defer teardown()
+
+	// Repeatedly get a connection and close it using the same DB instance. These
+	// connections should all share the same Spanner client, and only initialized
+	// one session pool.
+	for i := 0; i < 5; i++ {
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			t.Fatalf("failed to get a connection: %v", err)
+		}
+		var res int64
+		if err := conn.QueryRowContext(ctx, "SELECT 1").Scan(&res); err != nil {
+			t.Fatalf("failed to execute query on connection: %v", err)
+		}
+		_ = conn.Close()
+	}
+	// Verify that the connector only created 2 sessions on the server.
+	reqs := drainRequestsFromServer(server.TestSpanner)
+	createReqs := requestsOfType(reqs, reflect.TypeOf(&sppb.BatchCreateSessionsRequest{}))
+	numCreated := int32(0)
+	for _, req := range createReqs {
+		numCreated += req.(*sppb.BatchCreateSessionsRequest).SessionCount
+	}
+	if g, w := numCreated, int32(2); g != w {
+		t.Errorf("session creation count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+
+	// Now close the DB instance and create a new DB connection.
+	// This should cause the first Spanner client to be closed and
+	// a new one to be opened.
+	_ = db.Close()
+
+	db, err := sql.Open(
+		"spanner",
+		fmt.Sprintf("%s/projects/p/instances/i/databases/d?useplaintext=true;minSessions=2", server.Address))
+	if err != nil {
+		t.Fatalf("failed to open new DB instance: %v", err)
+	}
+	var res int64
+	if err := db.QueryRowContext(ctx, "SELECT 1").Scan(&res); err != nil {
+		t.Fatalf("failed to execute query on db: %v", err)
+	}
+	reqs = drainRequestsFromServer(server.TestSpanner)
+	createReqs = requestsOfType(reqs, reflect.TypeOf(&sppb.BatchCreateSessionsRequest{}))
+	numCreated = int32(0)
+	for _, req := range createReqs {
+		numCreated += req.(*sppb.BatchCreateSessionsRequest).SessionCount
+	}
+	if g, w := numCreated, int32(2); g != w {
+		t.Errorf("session creation count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func TestStressClientReuse(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	_, server, teardown := setupTestDBConnection(t)
+	defer teardown()
+
+	rand.Seed(time.Now().UnixNano())
+	numSessions := 10
+	numClients := 5
+	numParallel := 50
+	var wg sync.WaitGroup
+	for clientIndex := 0; clientIndex < numClients; clientIndex++ {
+		// Open a DB using a dsn that contains a meaningless number. This will ensure that
+		// the underlying client will be different from the other connections that use a
+		// different number.
+		db, err := sql.Open("spanner",
+			fmt.Sprintf("%s/projects/p/instances/i/databases/d?useplaintext=true;minSessions=%v;maxSessions=%v;randomNumber=%v", server.Address, numSessions, numSessions, clientIndex))
+		if err != nil {
+			t.Fatalf("failed to open DB: %v", err)
+		}
+		// Execute random operations in parallel on the database.
+		for i := 0; i < numParallel; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				conn, err := db.Conn(ctx)
+				if err != nil {
+					t.Errorf("failed to get a connection: %v", err)
+				}
+				if rand.Int()%2 == 0 {
+					if _, err := conn.ExecContext(ctx, testutil.UpdateBarSetFoo); err != nil {
+						t.Errorf("failed to execute update on connection: %v", err)
+					}
+				} else {
+					var res int64
+					if err := conn.QueryRowContext(ctx, "SELECT 1").Scan(&res); err != nil {
+						t.Errorf("failed to execute query on connection: %v", err)
+					}
+				}
+				_ = conn.Close()
+			}()
+		}
+	}
+	wg.Wait()
+
+	// Verify that each unique connection string created numSessions (10) sessions on the server.
+	reqs := drainRequestsFromServer(server.TestSpanner)
+	createReqs := requestsOfType(reqs, reflect.TypeOf(&sppb.BatchCreateSessionsRequest{}))
+	numCreated := int32(0)
+	for _, req := range createReqs {
+		numCreated += req.(*sppb.BatchCreateSessionsRequest).SessionCount
+	}
+	if g, w := numCreated, int32(numSessions*numClients); g != w {
+		t.Errorf("session creation count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+	sqlReqs := requestsOfType(reqs, reflect.TypeOf(&sppb.ExecuteSqlRequest{}))
+	if g, w := len(sqlReqs), numClients*numParallel; g != w {
+		t.Errorf("ExecuteSql request count mismatch\n Got: %v\nWant: %v", g, w)
+	}
+}
+
+func numeric(v string) big.Rat {
+	res, _ := big.NewRat(1, 1).SetString(v)
+	return *res
+}
+
+func nullNumeric(valid bool, v string) spanner.NullNumeric {
+	if !valid {
+		return spanner.NullNumeric{}
+	}
+	return spanner.NullNumeric{Valid: true, Numeric: numeric(v)}
+}
+
+func date(v string) civil.Date {
+	res, _ := civil.ParseDate(v)
+	return res
+}
+
+func nullDate(valid bool, v string) spanner.NullDate {
+	if !valid {
+		return spanner.NullDate{}
+	}
+	return spanner.NullDate{Valid: true, Date: date(v)}
+}
+
+func nullJson(valid bool, v string) spanner.NullJSON {
+	if !valid {
+		return spanner.NullJSON{}
+	}
+	var m map[string]interface{}
+	_ = json.Unmarshal([]byte(v), &m)
+	return spanner.NullJSON{Valid: true, Value: m}
+}
+
+func TestExecScript_DdlError(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db, server, teardown := setupTestDBConnection(t)
+	defer teardown()
+	failing := "CREATE INDEX Idx_Albums_Title ON Albums (Title)"
+	server.TestDatabaseAdmin.PutDdlStatementError(failing, gstatus.Error(codes.NotFound, "Table not found: Albums"))
+
+	script := `
+		CREATE TABLE Singers (SingerId INT64, Name STRING(MAX)) PRIMARY KEY (SingerId);
+		CREATE INDEX Idx_Singers_Name ON Singers (Name);
+		` + failing + `;
+		CREATE TABLE Concerts (ConcertId INT64) PRIMARY KEY (ConcertId);
+	`
+	err := ExecScript(ctx, db, script)
+	var scriptErr *ScriptError
+	if !errors.As(err, &scriptErr) {
+		t.Fatalf("error type mismatch\nGot: %v\nWant: %T", err, scriptErr)
+	}
+	if g, w := scriptErr.Index, 2; g != w {
+		t.Fatalf("failed statement index mismatch\nGot: %v\nWant: %v", g, w)
+	}
+	if g, w := scriptErr.Statement, failing; g != w {
+		t.Fatalf("failed statement mismatch\nGot: %v\nWant: %v", g, w)
+	}
+	if g, w := spanner.ErrCode(err), codes.NotFound; g != w {
+		t.Fatalf("error code mismatch\nGot: %v\nWant: %v", g, w)
+	}
+	// The statements before the failing statement have been applied.
+	wantDdl := []string{
+		"CREATE TABLE Singers (SingerId INT64, Name STRING(MAX)) PRIMARY KEY (SingerId)",
+		"CREATE INDEX Idx_Singers_Name ON Singers (Name)",
+	}
+	if g, w := server.TestDatabaseAdmin.Ddl("projects/p/instances/i/databases/d"), wantDdl; !cmp.Equal(g, w) {
+		t.Fatalf("database DDL mismatch\nGot: %v\nWant: %v", g, w)
+	}
+}
+
+func setupTestDBConnection(t *testing.T) (db *sql.DB, server *testutil.MockedSpannerInMemTestServer, teardown func()) {
+	return setupTestDBConnectionWithParams(t, "")
+}
+
+func setupTestDBConnectionWithParams(t *testing.T, params string) (db *sql.DB, server *testutil.MockedSpannerInMemTestServer, teardown func()) {
+	server, _, serverTeardown := setupMockedTestServer(t)
+	db, err := sql.Open(
+		"spanner",
+		fmt.Sprintf("%s/projects/p/instances/i/databases/d?useplaintext=true;%s", server.Address, params))
+	if err != nil {
+		serverTeardown()
+		t.Fatal(err)
+	}
+	return db, server, func() {
+		_ = db.Close()
+		serverTeardown()
+	}
+}
+
+func setupMockedTestServer(t *testing.T) (server *testutil.MockedSpannerInMemTestServer, client *spanner.Client, teardown func()) {
+	return setupMockedTestServerWithConfig(t, spanner.ClientConfig{})
+}
+
+func setupMockedTestServerWithConfig(t *testing.T, config spanner.ClientConfig) (server *testutil.MockedSpannerInMemTestServer, client *spanner.Client, teardown func()) {
+	return setupMockedTestServerWithConfigAndClientOptions(t, config, []option.ClientOption{})
+}
+
+func setupMockedTestServerWithConfigAndClientOptions(t *testing.T, config spanner.ClientConfig, clientOptions []option.ClientOption) (server *testutil.MockedSpannerInMemTestServer, client *spanner.Client, teardown func()) {
+	server, opts, serverTeardown := testutil.NewMockedSpannerInMemTestServer(t)
+	opts = append(opts, clientOptions...)
+	ctx := context.Background()
+	formattedDatabase := fmt.Sprintf("projects/%s/instances/%s/databases/%s", "[PROJECT]", "[INSTANCE]", "[DATABASE]")
+	client, err := spanner.NewClientWithConfig(ctx, formattedDatabase, config, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server, client, func() {
+		client.Close()
+		serverTeardown()
+	}
+}
+
+func filterBeginReadOnlyRequests(requests []interface{}) []*sppb.BeginTransactionRequest {
+	res := make([]*sppb.BeginTransactionRequest, 0)
+	for _, r := range requests {
+		if req, ok := r.(*sppb.BeginTransactionRequest); ok {
+			if req.Options != nil && req.Options.GetReadOnly() != nil {
+				res = append(res, req)
+			}
+		}
+	}
+	return res
+}
+
+func requestsOfType(requests []interface{}, t reflect.Type) []interface{} {
+	res := make([]interface{}, 0)
+	for _, req := range requests {
+		if reflect.TypeOf(req) == t {
+			res = append(res, req)
+		}
+	}
+	return res
+}
+
+func drainRequestsFromServer(server testutil.InMemSpannerServer) []interface{} {
+	var reqs []interface{}
+loop:
+	for {
+		select {
+		case req := <-server.ReceivedRequests():
+			reqs = append(reqs, req)
+		default:
+			break loop
+		}
+	}
+	return reqs
+}
+
+func waitFor(t *testing.T, assert func() error) {
+	t.Helper()
+	timeout := 5 * time.Second
+	ta := time.After(timeout)
+
+	for {
+		select {
+		case <-ta:
+			if err := assert(); err != nil {
+				t.Fatalf("after %v waiting, got %v", timeout, err)
+			}
+			return
+		default:
+		}
+
+		if err := assert(); err != nil {
+			// Fail. Let's pause and retry.
+			time.Sleep(time.Millisecond)
+			continue
 		}
-		// Execute random operations in parallel on the database.
-		for i := 0; i < numParallel; i++ {
-			wg.Add(1)
-			go func() {
-				defer wg.Done()
-				conn, err := db.Conn(ctx)
-				if err != nil {
-					t.Errorf("failed to get a connection: %v", err)
-				}
-				if rand.Int()%2 == 0 {
-					if _, err := conn.ExecContext(ctx, testutil.UpdateBarSetFoo); err != nil {
-						t.Errorf("failed to execute update on connection: %v", err)
-					}
-				} else {
-					var res int64
-					if err := conn.QueryRowContext(ctx, "SELECT 1").Scan(&res); err != nil {
-						t.Errorf("failed to execute query on connection: %v", err)
-					}
-				}
-				_ = conn.Close()
-			}()
+
+		return
+	}
+}
+
+func TestDecodeMode(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db, server, teardown := setupTestDBConnectionWithParams(t, "decode_mode=native")
+	defer teardown()
+	query := "SELECT ColIntArray, ColJson FROM Test"
+	_ = server.TestSpanner.PutStatementResult(query, &testutil.StatementResult{
+		Type: testutil.StatementResultResultSet,
+		ResultSet: &sppb.ResultSet{
+			Metadata: &sppb.ResultSetMetadata{
+				RowType: &sppb.StructType{Fields: []*sppb.StructType_Field{
+					{Name: "ColIntArray", Type: &sppb.Type{Code: sppb.TypeCode_ARRAY, ArrayElementType: &sppb.Type{Code: sppb.TypeCode_INT64}}},
+					{Name: "ColJson", Type: &sppb.Type{Code: sppb.TypeCode_JSON}},
+				}},
+			},
+			Rows: []*structpb.ListValue{{Values: []*structpb.Value{
+				{Kind: &structpb.Value_ListValue{ListValue: &structpb.ListValue{Values: []*structpb.Value{
+					{Kind: &structpb.Value_StringValue{StringValue: "1"}},
+					{Kind: &structpb.Value_StringValue{StringValue: "2"}},
+				}}}},
+				{Kind: &structpb.Value_StringValue{StringValue: `{"key": "value"}`}},
+			}}},
+		},
+	})
+	c, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("failed to get connection: %v", err)
+	}
+	defer c.Close()
+
+	var ints []int64
+	var js string
+	if err := c.QueryRowContext(ctx, query).Scan(&ints, &js); err != nil {
+		t.Fatalf("failed to query with native decode mode: %v", err)
+	}
+	if g, w := ints, []int64{1, 2}; !cmp.Equal(g, w) {
+		t.Fatalf("array mismatch\nGot: %v\nWant: %v", g, w)
+	}
+	if g, w := js, `{"key": "value"}`; g != w {
+		t.Fatalf("json mismatch\nGot: %v\nWant: %v", g, w)
+	}
+
+	// NULL elements in arrays are decoded to the zero value of the element
+	// type in native mode.
+	allTypesQuery := "SELECT * FROM Test"
+	_ = server.TestSpanner.PutStatementResult(allTypesQuery, &testutil.StatementResult{
+		Type:      testutil.StatementResultResultSet,
+		ResultSet: testutil.CreateResultSetWithAllTypes(false),
+	})
+	rows, err := c.QueryContext(ctx, allTypesQuery)
+	if err != nil {
+		t.Fatalf("failed to execute query: %v", err)
+	}
+	if !rows.Next() {
+		t.Fatalf("missing row for arrays with NULL elements: %v", rows.Err())
+	}
+	values := make([]interface{}, 18)
+	for i := range values {
+		values[i] = new(interface{})
+	}
+	if err := rows.Scan(values...); err != nil {
+		t.Fatalf("failed to scan arrays with NULL elements: %v", err)
+	}
+	_ = rows.Close()
+	for i, want := range []interface{}{
+		[]bool{true, false, false},
+		[]string{"test1", "", "test2"},
+		[][]byte{[]byte("testbytes1"), nil, []byte("testbytes2")},
+		[]int64{1, 0, 2},
+		[]float64{6.626, 0, 10.01},
+		[]big.Rat{*big.NewRat(314, 100), *big.NewRat(0, 1), *big.NewRat(1001, 100)},
+		[]civil.Date{{Year: 2000, Month: 2, Day: 29}, {Year: 1, Month: 1, Day: 1}, {Year: 2021, Month: 7, Day: 27}},
+		[]time.Time{
+			time.Date(2021, 7, 21, 21, 7, 59, 339911800, time.UTC),
+			{},
+			time.Date(2021, 7, 27, 21, 7, 59, 339911800, time.UTC),
+		},
+		[]string{`{"key1": "value1", "other-key1": ["value1", "value2"]}`, "", `{"key2": "value2", "other-key2": ["value1", "value2"]}`},
+	} {
+		got := *values[i+9].(*interface{})
+		if !cmp.Equal(got, want, cmp.AllowUnexported(big.Rat{}, big.Int{})) {
+			t.Fatalf("%d: array with NULL elements mismatch\nGot: %v\nWant: %v", i+9, got, want)
+		}
+	}
+
+	if _, err := c.ExecContext(ctx, "SET DECODE_MODE = 'GENERIC'"); err != nil {
+		t.Fatalf("failed to set decode mode: %v", err)
+	}
+	var colInt, colJSON spanner.GenericColumnValue
+	if err := c.QueryRowContext(ctx, query).Scan(&colInt, &colJSON); err != nil {
+		t.Fatalf("failed to query with generic decode mode: %v", err)
+	}
+	if g, w := colInt.Type.Code, sppb.TypeCode_ARRAY; g != w {
+		t.Fatalf("type code mismatch\nGot: %v\nWant: %v", g, w)
+	}
+	if g, w := colJSON.Type.Code, sppb.TypeCode_JSON; g != w {
+		t.Fatalf("type code mismatch\nGot: %v\nWant: %v", g, w)
+	}
+}
+
+func TestColumnTypes(t *testing.T) {
+	t.Parallel()
+
+	db, server, teardown := setupTestDBConnection(t)
+	defer teardown()
+	query := "SELECT * FROM Test"
+	_ = server.TestSpanner.PutStatementResult(query, &testutil.StatementResult{
+		Type:      testutil.StatementResultResultSet,
+		ResultSet: testutil.CreateResultSetWithAllTypes(false),
+	})
+	rows, err := db.QueryContext(context.Background(), query)
+	if err != nil {
+		t.Fatalf("failed to execute query: %v", err)
+	}
+	defer rows.Close()
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		t.Fatalf("failed to get column types: %v", err)
+	}
+	wantNames := []string{
+		"BOOL", "STRING(MAX)", "BYTES(MAX)", "INT64", "FLOAT64", "NUMERIC", "DATE", "TIMESTAMP", "JSON",
+		"ARRAY<BOOL>", "ARRAY<STRING(MAX)>", "ARRAY<BYTES(MAX)>", "ARRAY<INT64>", "ARRAY<FLOAT64>",
+		"ARRAY<NUMERIC>", "ARRAY<DATE>", "ARRAY<TIMESTAMP>", "ARRAY<JSON>",
+	}
+	wantScanTypes := []reflect.Type{
+		reflect.TypeOf(false), reflect.TypeOf(""), reflect.TypeOf([]byte{}), reflect.TypeOf(int64(0)),
+		reflect.TypeOf(float64(0)), reflect.TypeOf(big.Rat{}), reflect.TypeOf(civil.Date{}),
+		reflect.TypeOf(time.Time{}), reflect.TypeOf(spanner.NullJSON{}), reflect.TypeOf([]spanner.NullBool{}),
+		reflect.TypeOf([]spanner.NullString{}), reflect.TypeOf([][]byte{}), reflect.TypeOf([]spanner.NullInt64{}),
+		reflect.TypeOf([]spanner.NullFloat64{}), reflect.TypeOf([]spanner.NullNumeric{}),
+		reflect.TypeOf([]spanner.NullDate{}), reflect.TypeOf([]spanner.NullTime{}), reflect.TypeOf([]spanner.NullJSON{}),
+	}
+	if g, w := len(types), len(wantNames); g != w {
+		t.Fatalf("column count mismatch\nGot: %v\nWant: %v", g, w)
+	}
+	for i, ct := range types {
+		if g, w := ct.DatabaseTypeName(), wantNames[i]; g != w {
+			t.Errorf("%d: type name mismatch\nGot: %v\nWant: %v", i, g, w)
+		}
+		if g, w := ct.ScanType(), wantScanTypes[i]; g != w {
+			t.Errorf("%d: scan type mismatch\nGot: %v\nWant: %v", i, g, w)
+		}
+		if _, ok := ct.Nullable(); ok {
+			t.Errorf("%d: unexpected nullable information", i)
+		}
+		length, ok := ct.Length()
+		if wantOk := wantNames[i] == "STRING(MAX)" || wantNames[i] == "BYTES(MAX)"; ok != wantOk {
+			t.Errorf("%d: length ok mismatch\nGot: %v\nWant: %v", i, ok, wantOk)
+		} else if ok && length != math.MaxInt64 {
+			t.Errorf("%d: length mismatch\nGot: %v\nWant: %v", i, length, int64(math.MaxInt64))
+		}
+		precision, scale, ok := ct.DecimalSize()
+		if wantOk := wantNames[i] == "NUMERIC"; ok != wantOk {
+			t.Errorf("%d: decimal size ok mismatch\nGot: %v\nWant: %v", i, ok, wantOk)
+		} else if ok && (precision != 38 || scale != 9) {
+			t.Errorf("%d: decimal size mismatch\nGot: %v, %v\nWant: 38, 9", i, precision, scale)
+		}
+	}
+}
+
+func TestMultipleResultSets(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db, server, teardown := setupTestDBConnection(t)
+	defer teardown()
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		t.Fatalf("failed to begin transaction: %v", err)
+	}
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("%s; %s; show variable retry_aborts_internally", testutil.UpdateBarSetFoo, testutil.SelectFooFromBar))
+	if err != nil {
+		t.Fatalf("failed to execute statements: %v", err)
+	}
+	var results [][]interface{}
+	for {
+		var values []interface{}
+		for rows.Next() {
+			var v interface{}
+			if err := rows.Scan(&v); err != nil {
+				t.Fatalf("failed to scan value: %v", err)
+			}
+			values = append(values, v)
+		}
+		results = append(results, values)
+		if !rows.NextResultSet() {
+			break
+		}
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("failed to iterate result sets: %v", err)
+	}
+	_ = rows.Close()
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+	want := [][]interface{}{{int64(testutil.UpdateBarSetFooRowCount)}, {int64(1), int64(2)}, {true}}
+	if !cmp.Equal(results, want) {
+		t.Fatalf("results mismatch\nGot: %v\nWant: %v", results, want)
+	}
+
+	requests := drainRequestsFromServer(server.TestSpanner)
+	sqlRequests := requestsOfType(requests, reflect.TypeOf(&sppb.ExecuteSqlRequest{}))
+	if g, w := len(sqlRequests), 2; g != w {
+		t.Fatalf("sql requests count mismatch\nGot: %v\nWant: %v", g, w)
+	}
+	// Both statements should use the same transaction.
+	if sqlRequests[1].(*sppb.ExecuteSqlRequest).Transaction.GetId() == nil {
+		t.Fatal("missing transaction id for query")
+	}
+
+	// Statements that the caller did not advance to are not executed when
+	// the rows are closed, for example after a scan error.
+	tx, err = db.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		t.Fatalf("failed to begin transaction: %v", err)
+	}
+	rows, err = tx.QueryContext(ctx, fmt.Sprintf("%s; %s", testutil.SelectFooFromBar, testutil.UpdateBarSetFoo))
+	if err != nil {
+		t.Fatalf("failed to execute statements: %v", err)
+	}
+	if !rows.Next() {
+		t.Fatalf("missing row: %v", rows.Err())
+	}
+	var ts time.Time
+	if err := rows.Scan(&ts); err == nil {
+		t.Fatal("missing expected scan error")
+	}
+	if err := rows.Close(); err != nil {
+		t.Fatalf("failed to close rows: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+	requests = drainRequestsFromServer(server.TestSpanner)
+	sqlRequests = requestsOfType(requests, reflect.TypeOf(&sppb.ExecuteSqlRequest{}))
+	if g, w := len(sqlRequests), 1; g != w {
+		t.Fatalf("sql requests count mismatch\nGot: %v\nWant: %v", g, w)
+	}
+	if g, w := sqlRequests[0].(*sppb.ExecuteSqlRequest).Sql, testutil.SelectFooFromBar; g != w {
+		t.Fatalf("sql mismatch\nGot: %v\nWant: %v", g, w)
+	}
+
+	// Named arguments are assigned to the parameters with the same name in
+	// all statements, and positional arguments are assigned in order.
+	update := "UPDATE Singers SET Name=@name WHERE SingerId=@id"
+	query := "SELECT Name FROM Singers WHERE SingerId=@id AND Active=@active"
+	_ = server.TestSpanner.PutStatementResult(update, &testutil.StatementResult{
+		Type:        testutil.StatementResultUpdateCount,
+		UpdateCount: 1,
+	})
+	_ = server.TestSpanner.PutStatementResult(query, &testutil.StatementResult{
+		Type:      testutil.StatementResultResultSet,
+		ResultSet: testutil.CreateSingleColumnResultSet([]int64{1}, "Name"),
+	})
+	rows, err = db.QueryContext(ctx, fmt.Sprintf("%s; %s", update, query), "foo", sql.Named("id", 1), true)
+	if err != nil {
+		t.Fatalf("failed to execute statements: %v", err)
+	}
+	for rows.NextResultSet() {
+		for rows.Next() {
+		}
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("failed to iterate result sets: %v", err)
+	}
+	_ = rows.Close()
+	requests = drainRequestsFromServer(server.TestSpanner)
+	sqlRequests = requestsOfType(requests, reflect.TypeOf(&sppb.ExecuteSqlRequest{}))
+	if g, w := len(sqlRequests), 2; g != w {
+		t.Fatalf("sql requests count mismatch\nGot: %v\nWant: %v", g, w)
+	}
+	for i, want := range []map[string]string{
+		{"name": "foo", "id": "1"},
+		{"id": "1", "active": "true"},
+	} {
+		params := sqlRequests[i].(*sppb.ExecuteSqlRequest).Params.GetFields()
+		if g, w := len(params), len(want); g != w {
+			t.Fatalf("%d: param count mismatch\nGot: %v\nWant: %v", i, g, w)
+		}
+		for name, value := range want {
+			var got string
+			switch v := params[name].GetKind().(type) {
+			case *structpb.Value_StringValue:
+				got = v.StringValue
+			case *structpb.Value_BoolValue:
+				got = fmt.Sprint(v.BoolValue)
+			}
+			if got != value {
+				t.Fatalf("%d: param %s mismatch\nGot: %v\nWant: %v", i, name, got, value)
+			}
+		}
+	}
+
+	// Positional arguments are assigned to the statements in order.
+	if _, err := db.QueryContext(ctx, "SELECT @p1; SELECT @p2", 1); err == nil {
+		t.Fatal("missing expected error for missing argument value")
+	}
+	if _, err := db.QueryContext(ctx, "SELECT 1; SELECT 2", 1); err == nil {
+		t.Fatal("missing expected error for unused argument value")
+	}
+	if _, err := db.QueryContext(ctx, "SELECT 1; SELECT 2", sql.Named("id", 1)); err == nil {
+		t.Fatal("missing expected error for unused named argument value")
+	}
+}
+
+func TestExplain(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db, server, teardown := setupTestDBConnection(t)
+	defer teardown()
+	query := "SELECT * FROM Singers"
+	resultSet := testutil.CreateSingleColumnResultSet([]int64{1, 2}, "SingerId")
+	queryStats, _ := structpb.NewStruct(map[string]interface{}{"rows_returned": "2", "elapsed_time": "1.5 msecs"})
+	executionStats, _ := structpb.NewStruct(map[string]interface{}{"rows": map[string]interface{}{"total": "2"}})
+	resultSet.Stats = &sppb.ResultSetStats{
+		QueryPlan: &sppb.QueryPlan{PlanNodes: []*sppb.PlanNode{
+			{Index: 0, Kind: sppb.PlanNode_RELATIONAL, DisplayName: "Distributed Union", ChildLinks: []*sppb.PlanNode_ChildLink{{ChildIndex: 1}, {ChildIndex: 3}}, ExecutionStats: executionStats},
+			{Index: 1, Kind: sppb.PlanNode_RELATIONAL, DisplayName: "Table Scan", ChildLinks: []*sppb.PlanNode_ChildLink{{ChildIndex: 2}}},
+			{Index: 2, Kind: sppb.PlanNode_SCALAR, DisplayName: "Reference"},
+			{Index: 3, Kind: sppb.PlanNode_SCALAR, DisplayName: "Constant"},
+		}},
+		QueryStats: queryStats,
+	}
+	_ = server.TestSpanner.PutStatementResult(query, &testutil.StatementResult{
+		Type:      testutil.StatementResultResultSet,
+		ResultSet: resultSet,
+	})
+	c, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("failed to get connection: %v", err)
+	}
+	defer c.Close()
+
+	for _, test := range []struct {
+		statement string
+		mode      sppb.ExecuteSqlRequest_QueryMode
+		want      [][]interface{}
+	}{
+		{
+			statement: "EXPLAIN " + query,
+			mode:      sppb.ExecuteSqlRequest_PLAN,
+			want:      [][]interface{}{{int64(0), "Distributed Union"}, {int64(1), "  Table Scan"}},
+		},
+		{
+			statement: "EXPLAIN ANALYZE " + query,
+			mode:      sppb.ExecuteSqlRequest_PROFILE,
+			want: [][]interface{}{
+				{int64(0), "Distributed Union", spanner.NullJSON{Value: map[string]interface{}{"rows": map[string]interface{}{"total": "2"}}, Valid: true}},
+				{int64(1), "  Table Scan", spanner.NullJSON{}},
+			},
+		},
+	} {
+		rows, err := c.QueryContext(ctx, test.statement)
+		if err != nil {
+			t.Fatalf("failed to execute %q: %v", test.statement, err)
+		}
+		cols, _ := rows.Columns()
+		var got [][]interface{}
+		for rows.Next() {
+			values := make([]interface{}, len(cols))
+			dest := make([]interface{}, len(cols))
+			for i := range values {
+				dest[i] = &values[i]
+			}
+			if err := rows.Scan(dest...); err != nil {
+				t.Fatalf("failed to scan plan row: %v", err)
+			}
+			got = append(got, values)
+		}
+		if err := rows.Err(); err != nil {
+			t.Fatalf("failed to iterate plan rows: %v", err)
+		}
+		_ = rows.Close()
+		if !cmp.Equal(got, test.want) {
+			t.Fatalf("plan mismatch for %q\nGot: %v\nWant: %v", test.statement, got, test.want)
+		}
+		requests := drainRequestsFromServer(server.TestSpanner)
+		sqlRequests := requestsOfType(requests, reflect.TypeOf(&sppb.ExecuteSqlRequest{}))
+		if g, w := len(sqlRequests), 1; g != w {
+			t.Fatalf("sql requests count mismatch\nGot: %v\nWant: %v", g, w)
+		}
+		if g, w := sqlRequests[0].(*sppb.ExecuteSqlRequest).QueryMode, test.mode; g != w {
+			t.Fatalf("query mode mismatch\nGot: %v\nWant: %v", g, w)
+		}
+
+		var stats spanner.NullJSON
+		if err := c.QueryRowContext(ctx, "SHOW VARIABLE QUERY_STATS").Scan(&stats); err != nil {
+			t.Fatalf("failed to get query stats: %v", err)
+		}
+		if g, w := stats.String(), `{"elapsed_time":"1.5 msecs","rows_returned":"2"}`; g != w {
+			t.Fatalf("query stats mismatch\nGot: %v\nWant: %v", g, w)
+		}
+	}
+
+	// The statistics are also available on the rows of a normal query.
+	if err := c.Raw(func(driverConn interface{}) error {
+		rows, err := driverConn.(driver.QueryerContext).QueryContext(ctx, query, nil)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		values := make([]driver.Value, 1)
+		for {
+			if err := rows.Next(values); err == io.EOF {
+				break
+			} else if err != nil {
+				return err
+			}
+		}
+		stats := rows.(SpannerRows).ResultSetStats()
+		if g, w := len(stats.GetQueryPlan().GetPlanNodes()), 4; g != w {
+			t.Fatalf("plan nodes count mismatch\nGot: %v\nWant: %v", g, w)
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("failed to execute query: %v", err)
+	}
+}
+
+func TestOptimizerOptions(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db, server, teardown := setupTestDBConnectionWithParams(t, "optimizer_version=3;optimizer_statistics_package=auto_1")
+	defer teardown()
+	c, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("failed to get connection: %v", err)
+	}
+	defer c.Close()
+
+	verify := func(wantVersion, wantPackage string) {
+		requests := drainRequestsFromServer(server.TestSpanner)
+		sqlRequests := requestsOfType(requests, reflect.TypeOf(&sppb.ExecuteSqlRequest{}))
+		if g, w := len(sqlRequests), 1; g != w {
+			t.Fatalf("sql requests count mismatch\nGot: %v\nWant: %v", g, w)
+		}
+		options := sqlRequests[0].(*sppb.ExecuteSqlRequest).QueryOptions
+		if g, w := options.GetOptimizerVersion(), wantVersion; g != w {
+			t.Fatalf("optimizer version mismatch\nGot: %v\nWant: %v", g, w)
+		}
+		if g, w := options.GetOptimizerStatisticsPackage(), wantPackage; g != w {
+			t.Fatalf("optimizer statistics package mismatch\nGot: %v\nWant: %v", g, w)
+		}
+	}
+	query := func(c interface {
+		QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	}) {
+		rows, err := c.QueryContext(ctx, testutil.SelectFooFromBar)
+		if err != nil {
+			t.Fatalf("failed to execute query: %v", err)
 		}
+		for rows.Next() {
+		}
+		if err := rows.Err(); err != nil {
+			t.Fatalf("failed to iterate rows: %v", err)
+		}
+		_ = rows.Close()
+	}
+
+	query(c)
+	verify("3", "auto_1")
+
+	if _, err := c.ExecContext(ctx, "SET OPTIMIZER_VERSION = 'LATEST'"); err != nil {
+		t.Fatalf("failed to set optimizer version: %v", err)
+	}
+	if _, err := c.ExecContext(ctx, "SET OPTIMIZER_STATISTICS_PACKAGE = ''"); err != nil {
+		t.Fatalf("failed to set optimizer statistics package: %v", err)
+	}
+	for _, readOnly := range []bool{true, false} {
+		tx, err := c.BeginTx(ctx, &sql.TxOptions{ReadOnly: readOnly})
+		if err != nil {
+			t.Fatalf("failed to begin transaction: %v", err)
+		}
+		query(tx)
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("failed to commit: %v", err)
+		}
+		verify("LATEST", "")
+	}
+
+	var version string
+	if err := c.QueryRowContext(ctx, "SHOW VARIABLE OPTIMIZER_VERSION").Scan(&version); err != nil {
+		t.Fatalf("failed to get optimizer version: %v", err)
+	}
+	if g, w := version, "LATEST"; g != w {
+		t.Fatalf("optimizer version mismatch\nGot: %v\nWant: %v", g, w)
+	}
+}
+
+func TestPrefetch(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db, server, teardown := setupTestDBConnectionWithParams(t, "prefetch_rows=2;prefetch_bytes=1024")
+	defer teardown()
+	query := "SELECT Value FROM Numbers"
+	values := make([]int64, 20)
+	for i := range values {
+		values[i] = int64(i)
+	}
+	_ = server.TestSpanner.PutStatementResult(query, &testutil.StatementResult{
+		Type:      testutil.StatementResultResultSet,
+		ResultSet: testutil.CreateSingleColumnResultSet(values, "Value"),
+	})
+
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		t.Fatalf("failed to execute query: %v", err)
+	}
+	var got []int64
+	for rows.Next() {
+		var v int64
+		if err := rows.Scan(&v); err != nil {
+			t.Fatalf("failed to scan value: %v", err)
+		}
+		got = append(got, v)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("failed to iterate rows: %v", err)
+	}
+	_ = rows.Close()
+	if !cmp.Equal(got, values) {
+		t.Fatalf("values mismatch\nGot: %v\nWant: %v", got, values)
 	}
-	wg.Wait()
 
-	// Verify that each unique connection string created numSessions (10) sessions on the server.
-	reqs := drainRequestsFromServer(server.TestSpanner)
-	createReqs := requestsOfType(reqs, reflect.TypeOf(&sppb.BatchCreateSessionsRequest{}))
-	numCreated := int32(0)
-	for _, req := range createReqs {
-		numCreated += req.(*sppb.BatchCreateSessionsRequest).SessionCount
+	// Closing the rows before all rows have been read should stop the stream.
+	rows, err = db.QueryContext(ctx, query)
+	if err != nil {
+		t.Fatalf("failed to execute query: %v", err)
 	}
-	if g, w := numCreated, int32(numSessions*numClients); g != w {
-		t.Errorf("session creation count mismatch\n Got: %v\nWant: %v", g, w)
+	if !rows.Next() {
+		t.Fatalf("missing first row: %v", rows.Err())
 	}
-	sqlReqs := requestsOfType(reqs, reflect.TypeOf(&sppb.ExecuteSqlRequest{}))
-	if g, w := len(sqlReqs), numClients*numParallel; g != w {
-		t.Errorf("ExecuteSql request count mismatch\n Got: %v\nWant: %v", g, w)
+	if err := rows.Close(); err != nil {
+		t.Fatalf("failed to close rows: %v", err)
 	}
 }
 
-func numeric(v string) big.Rat {
-	res, _ := big.NewRat(1, 1).SetString(v)
-	return *res
-}
+func TestPreparedStatementAnalyzeParameters(t *testing.T) {
+	t.Parallel()
 
-func nullNumeric(valid bool, v string) spanner.NullNumeric {
-	if !valid {
-		return spanner.NullNumeric{}
+	ctx := context.Background()
+	db, server, teardown := setupTestDBConnectionWithParams(t, "analyze_prepared_statements=true")
+	defer teardown()
+	query := "SELECT Name FROM Singers WHERE SingerId=@id"
+	resultSet := testutil.CreateSingleColumnResultSet([]int64{1}, "Name")
+	resultSet.Metadata.UndeclaredParameters = &sppb.StructType{Fields: []*sppb.StructType_Field{
+		{Name: "id", Type: &sppb.Type{Code: sppb.TypeCode_INT64}},
+	}}
+	_ = server.TestSpanner.PutStatementResult(query, &testutil.StatementResult{
+		Type:      testutil.StatementResultResultSet,
+		ResultSet: resultSet,
+	})
+	c, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("failed to get connection: %v", err)
 	}
-	return spanner.NullNumeric{Valid: true, Numeric: numeric(v)}
-}
+	defer c.Close()
 
-func date(v string) civil.Date {
-	res, _ := civil.ParseDate(v)
-	return res
-}
+	stmt, err := c.PrepareContext(ctx, query)
+	if err != nil {
+		t.Fatalf("failed to prepare statement: %v", err)
+	}
+	defer stmt.Close()
+	requests := drainRequestsFromServer(server.TestSpanner)
+	sqlRequests := requestsOfType(requests, reflect.TypeOf(&sppb.ExecuteSqlRequest{}))
+	if g, w := len(sqlRequests), 1; g != w {
+		t.Fatalf("sql requests count mismatch\nGot: %v\nWant: %v", g, w)
+	}
+	if g, w := sqlRequests[0].(*sppb.ExecuteSqlRequest).QueryMode, sppb.ExecuteSqlRequest_PLAN; g != w {
+		t.Fatalf("query mode mismatch\nGot: %v\nWant: %v", g, w)
+	}
 
-func nullDate(valid bool, v string) spanner.NullDate {
-	if !valid {
-		return spanner.NullDate{}
+	// An argument with a type that does not match the parameter type is
+	// rejected without sending the query to Spanner.
+	if _, err := stmt.QueryContext(ctx, "foo"); spanner.ErrCode(err) != codes.InvalidArgument {
+		t.Fatalf("error code mismatch\nGot: %v\nWant: %v", spanner.ErrCode(err), codes.InvalidArgument)
+	}
+	requests = drainRequestsFromServer(server.TestSpanner)
+	if g, w := len(requestsOfType(requests, reflect.TypeOf(&sppb.ExecuteSqlRequest{}))), 0; g != w {
+		t.Fatalf("sql requests count mismatch\nGot: %v\nWant: %v", g, w)
 	}
-	return spanner.NullDate{Valid: true, Date: date(v)}
-}
 
-func nullJson(valid bool, v string) spanner.NullJSON {
-	if !valid {
-		return spanner.NullJSON{}
+	for _, arg := range []interface{}{int64(1), 1, spanner.NullInt64{}, nil} {
+		var name int64
+		if err := stmt.QueryRowContext(ctx, arg).Scan(&name); err != nil {
+			t.Fatalf("failed to execute statement with argument %v: %v", arg, err)
+		}
+	}
+	requests = drainRequestsFromServer(server.TestSpanner)
+	sqlRequests = requestsOfType(requests, reflect.TypeOf(&sppb.ExecuteSqlRequest{}))
+	if g, w := len(sqlRequests), 4; g != w {
+		t.Fatalf("sql requests count mismatch\nGot: %v\nWant: %v", g, w)
+	}
+	if g, w := sqlRequests[0].(*sppb.ExecuteSqlRequest).QueryMode, sppb.ExecuteSqlRequest_NORMAL; g != w {
+		t.Fatalf("query mode mismatch\nGot: %v\nWant: %v", g, w)
 	}
-	var m map[string]interface{}
-	_ = json.Unmarshal([]byte(v), &m)
-	return spanner.NullJSON{Valid: true, Value: m}
 }
 
-func setupTestDBConnection(t *testing.T) (db *sql.DB, server *testutil.MockedSpannerInMemTestServer, teardown func()) {
-	return setupTestDBConnectionWithParams(t, "")
-}
+func TestPreparedStatementWithoutAnalyze(t *testing.T) {
+	t.Parallel()
 
-func setupTestDBConnectionWithParams(t *testing.T, params string) (db *sql.DB, server *testutil.MockedSpannerInMemTestServer, teardown func()) {
-	server, _, serverTeardown := setupMockedTestServer(t)
-	db, err := sql.Open(
-		"spanner",
-		fmt.Sprintf("%s/projects/p/instances/i/databases/d?useplaintext=true;%s", server.Address, params))
+	ctx := context.Background()
+	db, server, teardown := setupTestDBConnection(t)
+	defer teardown()
+
+	stmt, err := db.PrepareContext(ctx, testutil.UpdateBarSetFoo)
 	if err != nil {
-		serverTeardown()
-		t.Fatal(err)
+		t.Fatalf("failed to prepare statement: %v", err)
 	}
-	return db, server, func() {
-		_ = db.Close()
-		serverTeardown()
+	defer stmt.Close()
+	// Preparing a statement does not send any requests to Spanner, unless
+	// analyze_prepared_statements has been enabled.
+	requests := drainRequestsFromServer(server.TestSpanner)
+	if g, w := len(requestsOfType(requests, reflect.TypeOf(&sppb.ExecuteSqlRequest{}))), 0; g != w {
+		t.Fatalf("sql requests count mismatch\nGot: %v\nWant: %v", g, w)
+	}
+	for i := 0; i < 2; i++ {
+		res, err := stmt.ExecContext(ctx)
+		if err != nil {
+			t.Fatalf("failed to execute statement: %v", err)
+		}
+		if affected, _ := res.RowsAffected(); affected != testutil.UpdateBarSetFooRowCount {
+			t.Fatalf("row count mismatch\nGot: %v\nWant: %v", affected, testutil.UpdateBarSetFooRowCount)
+		}
 	}
 }
 
-func setupMockedTestServer(t *testing.T) (server *testutil.MockedSpannerInMemTestServer, client *spanner.Client, teardown func()) {
-	return setupMockedTestServerWithConfig(t, spanner.ClientConfig{})
-}
+func TestExecContextWithQuery(t *testing.T) {
+	t.Parallel()
 
-func setupMockedTestServerWithConfig(t *testing.T, config spanner.ClientConfig) (server *testutil.MockedSpannerInMemTestServer, client *spanner.Client, teardown func()) {
-	return setupMockedTestServerWithConfigAndClientOptions(t, config, []option.ClientOption{})
+	ctx := context.Background()
+	db, server, teardown := setupTestDBConnection(t)
+	defer teardown()
+
+	for _, query := range []string{testutil.SelectFooFromBar, "@{OPTIMIZER_VERSION=1} " + testutil.SelectFooFromBar} {
+		if query != testutil.SelectFooFromBar {
+			_ = server.TestSpanner.PutStatementResult(query, &testutil.StatementResult{
+				Type:      testutil.StatementResultResultSet,
+				ResultSet: testutil.CreateSingleColumnResultSet([]int64{1, 2}, "FOO"),
+			})
+		}
+		res, err := db.ExecContext(ctx, query)
+		if err != nil {
+			t.Fatalf("failed to execute %q: %v", query, err)
+		}
+		if _, err := res.RowsAffected(); err == nil {
+			t.Fatal("missing expected error for RowsAffected")
+		}
+		requests := drainRequestsFromServer(server.TestSpanner)
+		sqlRequests := requestsOfType(requests, reflect.TypeOf(&sppb.ExecuteSqlRequest{}))
+		if g, w := len(sqlRequests), 1; g != w {
+			t.Fatalf("sql requests count mismatch\nGot: %v\nWant: %v", g, w)
+		}
+		// The query is executed in a single-use read-only transaction.
+		if sqlRequests[0].(*sppb.ExecuteSqlRequest).Transaction.GetSingleUse().GetReadOnly() == nil {
+			t.Fatalf("query was not executed in a single-use read-only transaction")
+		}
+		if g, w := len(requestsOfType(requests, reflect.TypeOf(&sppb.CommitRequest{}))), 0; g != w {
+			t.Fatalf("commit requests count mismatch\nGot: %v\nWant: %v", g, w)
+		}
+	}
 }
 
-func setupMockedTestServerWithConfigAndClientOptions(t *testing.T, config spanner.ClientConfig, clientOptions []option.ClientOption) (server *testutil.MockedSpannerInMemTestServer, client *spanner.Client, teardown func()) {
-	server, opts, serverTeardown := testutil.NewMockedSpannerInMemTestServer(t)
-	opts = append(opts, clientOptions...)
+func TestQueryContextWithDml(t *testing.T) {
+	t.Parallel()
+
 	ctx := context.Background()
-	formattedDatabase := fmt.Sprintf("projects/%s/instances/%s/databases/%s", "[PROJECT]", "[INSTANCE]", "[DATABASE]")
-	client, err := spanner.NewClientWithConfig(ctx, formattedDatabase, config, opts...)
+	db, server, teardown := setupTestDBConnection(t)
+	defer teardown()
+	thenReturn := "INSERT INTO Singers (SingerId, Name) VALUES (1, 'Name') THEN RETURN SingerId"
+	resultSet := testutil.CreateSingleColumnResultSet([]int64{1}, "SingerId")
+	resultSet.Stats = &sppb.ResultSetStats{RowCount: &sppb.ResultSetStats_RowCountExact{RowCountExact: 1}}
+	_ = server.TestSpanner.PutStatementResult(thenReturn, &testutil.StatementResult{
+		Type:      testutil.StatementResultResultSet,
+		ResultSet: resultSet,
+	})
+
+	// DML without THEN RETURN returns an empty result set.
+	var resp spanner.CommitResponse
+	rows, err := db.QueryContext(WithCommitResponse(ctx, &resp), testutil.UpdateBarSetFoo)
 	if err != nil {
-		t.Fatal(err)
+		t.Fatalf("failed to execute DML: %v", err)
 	}
-	return server, client, func() {
-		client.Close()
-		serverTeardown()
+	if rows.Next() {
+		t.Fatal("unexpected row for DML without THEN RETURN")
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("failed to iterate rows: %v", err)
+	}
+	_ = rows.Close()
+	if resp.CommitTs.IsZero() {
+		t.Fatal("missing commit timestamp")
+	}
+	requests := drainRequestsFromServer(server.TestSpanner)
+	sqlRequests := requestsOfType(requests, reflect.TypeOf(&sppb.ExecuteSqlRequest{}))
+	if len(sqlRequests) == 0 {
+		t.Fatal("missing sql request")
+	}
+	for _, req := range sqlRequests {
+		if req.(*sppb.ExecuteSqlRequest).Transaction.GetSingleUse() != nil {
+			t.Fatal("DML was executed in a single-use transaction")
+		}
+	}
+	if g, w := len(requestsOfType(requests, reflect.TypeOf(&sppb.CommitRequest{}))), 1; g != w {
+		t.Fatalf("commit requests count mismatch\nGot: %v\nWant: %v", g, w)
 	}
-}
 
-func filterBeginReadOnlyRequests(requests []interface{}) []*sppb.BeginTransactionRequest {
-	res := make([]*sppb.BeginTransactionRequest, 0)
-	for _, r := range requests {
-		if req, ok := r.(*sppb.BeginTransactionRequest); ok {
-			if req.Options != nil && req.Options.GetReadOnly() != nil {
-				res = append(res, req)
-			}
+	// DML with THEN RETURN returns the rows of the statement, both in
+	// autocommit mode and in a read/write transaction.
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{})
+	if err != nil {
+		t.Fatalf("failed to begin transaction: %v", err)
+	}
+	for _, queryer := range []interface {
+		QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	}{db, tx} {
+		var id int64
+		if err := queryer.QueryRowContext(ctx, thenReturn).Scan(&id); err != nil {
+			t.Fatalf("failed to execute DML with THEN RETURN: %v", err)
+		}
+		if g, w := id, int64(1); g != w {
+			t.Fatalf("id mismatch\nGot: %v\nWant: %v", g, w)
 		}
 	}
-	return res
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+	requests = drainRequestsFromServer(server.TestSpanner)
+	if g, w := len(requestsOfType(requests, reflect.TypeOf(&sppb.CommitRequest{}))), 2; g != w {
+		t.Fatalf("commit requests count mismatch\nGot: %v\nWant: %v", g, w)
+	}
+
+	c, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("failed to get connection: %v", err)
+	}
+	defer c.Close()
+	// DML in a DML batch must be executed with ExecContext.
+	if _, err := c.ExecContext(ctx, "START BATCH DML"); err != nil {
+		t.Fatalf("failed to start DML batch: %v", err)
+	}
+	if _, err := c.QueryContext(ctx, testutil.UpdateBarSetFoo); spanner.ErrCode(err) != codes.FailedPrecondition {
+		t.Fatalf("error code mismatch\nGot: %v\nWant: %v", spanner.ErrCode(err), codes.FailedPrecondition)
+	}
+	if _, err := c.ExecContext(ctx, "ABORT BATCH"); err != nil {
+		t.Fatalf("failed to abort DML batch: %v", err)
+	}
+	// Partitioned DML returns an empty result set.
+	if _, err := c.ExecContext(ctx, "SET AUTOCOMMIT_DML_MODE='PARTITIONED_NON_ATOMIC'"); err != nil {
+		t.Fatalf("failed to set autocommit dml mode: %v", err)
+	}
+	rows, err = c.QueryContext(ctx, testutil.UpdateBarSetFoo)
+	if err != nil {
+		t.Fatalf("failed to execute partitioned DML: %v", err)
+	}
+	if rows.Next() {
+		t.Fatal("unexpected row for partitioned DML")
+	}
+	_ = rows.Close()
 }
 
-func requestsOfType(requests []interface{}, t reflect.Type) []interface{} {
-	res := make([]interface{}, 0)
-	for _, req := range requests {
-		if reflect.TypeOf(req) == t {
-			res = append(res, req)
-		}
+func TestExecScript(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db, server, teardown := setupTestDBConnection(t)
+	defer teardown()
+	any, _ := ptypes.MarshalAny(&emptypb.Empty{})
+	server.TestDatabaseAdmin.SetResps([]proto.Message{
+		&longrunningpb.Operation{
+			Done:   true,
+			Result: &longrunningpb.Operation_Response{Response: any},
+			Name:   "test-operation",
+		},
+	})
+	script := `
+		-- Create the tables.
+		CREATE TABLE Singers (SingerId INT64, Name STRING(MAX)) PRIMARY KEY (SingerId);
+		CREATE TABLE Albums (AlbumId INT64, Title STRING(MAX)) PRIMARY KEY (AlbumId);
+		/* Update some data; twice. */
+		` + testutil.UpdateBarSetFoo + `;
+		` + testutil.UpdateBarSetFoo + `;
+		` + testutil.SelectFooFromBar + `;
+		SET AUTOCOMMIT_DML_MODE = 'PARTITIONED_NON_ATOMIC';
+		` + testutil.UpdateBarSetFoo + `;
+	`
+	if err := ExecScript(ctx, db, script); err != nil {
+		t.Fatalf("failed to execute script: %v", err)
+	}
+	adminRequests := server.TestDatabaseAdmin.Reqs()
+	if g, w := len(adminRequests), 1; g != w {
+		t.Fatalf("admin requests count mismatch\nGot: %v\nWant: %v", g, w)
+	}
+	if g, w := len(adminRequests[0].(*databasepb.UpdateDatabaseDdlRequest).Statements), 2; g != w {
+		t.Fatalf("DDL statement count mismatch\nGot: %v\nWant: %v", g, w)
+	}
+	// The canned response is returned without applying the statements.
+	if g := server.TestDatabaseAdmin.Ddl("projects/p/instances/i/databases/d"); len(g) != 0 {
+		t.Fatalf("unexpected database DDL for canned response: %v", g)
+	}
+	requests := drainRequestsFromServer(server.TestSpanner)
+	batchRequests := requestsOfType(requests, reflect.TypeOf(&sppb.ExecuteBatchDmlRequest{}))
+	if g, w := len(batchRequests), 1; g != w {
+		t.Fatalf("batch DML requests count mismatch\nGot: %v\nWant: %v", g, w)
+	}
+	if g, w := len(batchRequests[0].(*sppb.ExecuteBatchDmlRequest).Statements), 2; g != w {
+		t.Fatalf("DML statement count mismatch\nGot: %v\nWant: %v", g, w)
+	}
+	// The query and the Partitioned DML statement are executed separately.
+	sqlRequests := requestsOfType(requests, reflect.TypeOf(&sppb.ExecuteSqlRequest{}))
+	if g, w := len(sqlRequests), 2; g != w {
+		t.Fatalf("sql requests count mismatch\nGot: %v\nWant: %v", g, w)
+	}
+	beginRequests := requestsOfType(requests, reflect.TypeOf(&sppb.BeginTransactionRequest{}))
+	if g, w := len(beginRequests), 1; g != w {
+		t.Fatalf("begin requests count mismatch\nGot: %v\nWant: %v", g, w)
+	}
+	if beginRequests[0].(*sppb.BeginTransactionRequest).Options.GetPartitionedDml() == nil {
+		t.Fatal("last DML statement was not executed as Partitioned DML")
 	}
-	return res
 }
 
-func drainRequestsFromServer(server testutil.InMemSpannerServer) []interface{} {
-	var reqs []interface{}
-loop:
-	for {
-		select {
-		case req := <-server.ReceivedRequests():
-			reqs = append(reqs, req)
-		default:
-			break loop
+func TestExecScript_CommitTimestamp(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	db, _, teardown := setupTestDBConnection(t)
+	defer teardown()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("failed to get connection: %v", err)
+	}
+	defer conn.Close()
+
+	// The commit timestamp of the connection is set by a script that ends
+	// with a batch of DML statements.
+	script := testutil.SelectFooFromBar + ";" + testutil.UpdateBarSetFoo + ";" + testutil.UpdateBarSetFoo
+	if err := conn.Raw(func(driverConn interface{}) error {
+		spannerConn := driverConn.(SpannerConn)
+		if err := spannerConn.ExecScript(ctx, script); err != nil {
+			return err
 		}
+		_, err := spannerConn.CommitTimestamp()
+		return err
+	}); err != nil {
+		t.Fatalf("failed to get commit timestamp of script: %v", err)
 	}
-	return reqs
 }
 
-func waitFor(t *testing.T, assert func() error) {
-	t.Helper()
-	timeout := 5 * time.Second
-	ta := time.After(timeout)
+func TestExecScript_Error(t *testing.T) {
+	t.Parallel()
 
-	for {
-		select {
-		case <-ta:
-			if err := assert(); err != nil {
-				t.Fatalf("after %v waiting, got %v", timeout, err)
-			}
-			return
-		default:
-		}
+	ctx := context.Background()
+	db, server, teardown := setupTestDBConnection(t)
+	defer teardown()
+	failing := "UPDATE Singers SET Name='Foo' WHERE SingerId=1"
+	_ = server.TestSpanner.PutStatementResult(failing, &testutil.StatementResult{
+		Type: testutil.StatementResultError,
+		Err:  gstatus.Error(codes.NotFound, "Table not found: Singers"),
+	})
 
-		if err := assert(); err != nil {
-			// Fail. Let's pause and retry.
-			time.Sleep(time.Millisecond)
-			continue
-		}
+	script := testutil.UpdateBarSetFoo + ";\n" + failing + ";\n" + testutil.UpdateBarSetFoo
+	err := ExecScript(ctx, db, script)
+	var scriptErr *ScriptError
+	if !errors.As(err, &scriptErr) {
+		t.Fatalf("error type mismatch\nGot: %v\nWant: %T", err, scriptErr)
+	}
+	if g, w := scriptErr.Index, 1; g != w {
+		t.Fatalf("failed statement index mismatch\nGot: %v\nWant: %v", g, w)
+	}
+	if g, w := scriptErr.Statement, failing; g != w {
+		t.Fatalf("failed statement mismatch\nGot: %v\nWant: %v", g, w)
+	}
+	if g, w := spanner.ErrCode(err), codes.NotFound; g != w {
+		t.Fatalf("error code mismatch\nGot: %v\nWant: %v", g, w)
+	}
 
-		return
+	// A script that cannot be parsed is not executed.
+	_ = drainRequestsFromServer(server.TestSpanner)
+	err = ExecScript(ctx, db, testutil.UpdateBarSetFoo+"; SELECT 'foo")
+	if g, w := spanner.ErrCode(err), codes.InvalidArgument; g != w {
+		t.Fatalf("error code mismatch\nGot: %v\nWant: %v", g, w)
+	}
+	requests := drainRequestsFromServer(server.TestSpanner)
+	if g, w := len(requestsOfType(requests, reflect.TypeOf(&sppb.ExecuteBatchDmlRequest{}))), 0; g != w {
+		t.Fatalf("batch DML requests count mismatch\nGot: %v\nWant: %v", g, w)
 	}
 }
@@ -0,0 +1,81 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command spanner-migrate applies the versioned migration files in a
+// directory to a Cloud Spanner database.
+//
+// Usage:
+//
+//	spanner-migrate -database projects/my-project/instances/my-instance/databases/my-database -dir migrations [-dry-run] [-history-table SchemaMigrations]
+//
+// The database flag accepts any connection string that is supported by the
+// Cloud Spanner database/sql driver. See the migrate package for the format
+// of the migration files.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+
+	_ "github.com/googleapis/go-sql-spanner"
+	"github.com/googleapis/go-sql-spanner/migrate"
+)
+
+func main() {
+	database := flag.String("database", "", "The connection string of the database, for example projects/my-project/instances/my-instance/databases/my-database")
+	dir := flag.String("dir", "migrations", "The directory that contains the migration files")
+	dryRun := flag.Bool("dry-run", false, "Print the statements that would be executed instead of executing them")
+	historyTable := flag.String("history-table", migrate.DefaultHistoryTable, "The table that records the applied migrations")
+	flag.Parse()
+
+	if *database == "" {
+		fmt.Fprintln(os.Stderr, "missing required flag -database")
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := run(context.Background(), *database, *dir, migrate.Options{
+		HistoryTable: *historyTable,
+		DryRun:       *dryRun,
+		Output:       os.Stdout,
+	}); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, database, dir string, options migrate.Options) error {
+	migrations, err := migrate.Load(os.DirFS(dir))
+	if err != nil {
+		return fmt.Errorf("failed to load migrations from %s: %v", dir, err)
+	}
+	db, err := sql.Open("spanner", database)
+	if err != nil {
+		return fmt.Errorf("failed to open database connection: %v", err)
+	}
+	defer db.Close()
+
+	applied, err := migrate.Apply(ctx, db, migrations, options)
+	if err != nil {
+		return err
+	}
+	if options.DryRun {
+		fmt.Printf("%d migration(s) would be applied\n", len(applied))
+	} else {
+		fmt.Printf("Applied %d migration(s)\n", len(applied))
+	}
+	return nil
+}
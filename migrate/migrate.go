@@ -0,0 +1,275 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package migrate applies versioned schema migrations to a Cloud Spanner
+// database using the Cloud Spanner database/sql driver.
+//
+// A migration is a sql script with one or more DDL and/or DML statements that
+// are separated by semicolons. Migrations are loaded from files with the name
+// format `<version>_<name>.sql`, for example `0001_create_singers.sql`, and are
+// applied in the order of their version. Consecutive DDL statements in a
+// migration are executed as one DDL batch. The versions of the migrations that
+// have been applied are recorded in a history table in the database, and
+// migrations that have already been applied are skipped.
+//
+// Only GoogleSQL-dialect databases are supported. Apply returns an error for
+// a PostgreSQL-dialect database.
+//
+// Example:
+//
+//	db, err := sql.Open("spanner", "projects/my-project/instances/my-instance/databases/my-database")
+//	migrations, err := migrate.Load(os.DirFS("migrations"))
+//	applied, err := migrate.Apply(ctx, db, migrations, migrate.Options{})
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	spannerdriver "github.com/googleapis/go-sql-spanner"
+)
+
+// DefaultHistoryTable is the name of the table that records the applied
+// migrations if no other table name is specified in the Options.
+const DefaultHistoryTable = "SchemaMigrations"
+
+const dialectQuery = `SELECT OPTION_VALUE FROM INFORMATION_SCHEMA.DATABASE_OPTIONS WHERE OPTION_NAME='database_dialect'`
+
+// Migration is a versioned sql script.
+type Migration struct {
+	// Version is the version of the migration. Migrations are applied in
+	// ascending order of their version.
+	Version int64
+	// Name is a descriptive name of the migration.
+	Name string
+	// SQL is the sql script of the migration.
+	SQL string
+}
+
+// Options are the options that are used to apply migrations.
+type Options struct {
+	// HistoryTable is the name of the table that records the applied
+	// migrations. The table is created if it does not exist. The default is
+	// DefaultHistoryTable.
+	HistoryTable string
+	// DryRun prints the statements that would be executed to Output instead
+	// of executing them.
+	DryRun bool
+	// Output is the writer that progress and dry-run output is written to.
+	// No output is written if Output is nil.
+	Output io.Writer
+}
+
+var fileNameRegExp = regexp.MustCompile(`^(\d+)_(.+)\.sql$`)
+
+// Load loads all migrations from the files with the extension .sql in the root
+// directory of the given file system. The files must be named
+// `<version>_<name>.sql`. The migrations are returned in ascending order of
+// their version.
+func Load(fsys fs.FS) ([]Migration, error) {
+	files, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+	migrations := make([]Migration, 0, len(files))
+	versions := make(map[int64]string, len(files))
+	for _, file := range files {
+		m := fileNameRegExp.FindStringSubmatch(path.Base(file))
+		if m == nil {
+			return nil, fmt.Errorf("invalid migration file name %q, expected <version>_<name>.sql", file)
+		}
+		version, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version in migration file name %q: %v", file, err)
+		}
+		if existing, ok := versions[version]; ok {
+			return nil, fmt.Errorf("duplicate migration version %d in %q and %q", version, existing, file)
+		}
+		versions[version] = file
+		content, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, Migration{Version: version, Name: m[2], SQL: string(content)})
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Apply applies all migrations that have not yet been applied to the given
+// database, and returns the migrations that were applied. The migrations are
+// applied in ascending order of their version. Apply stops at the first
+// migration that fails. The migrations that were applied before the failed
+// migration are returned together with the error. The statements of the
+// failed migration that were executed before the failing statement are not
+// rolled back.
+//
+// A migration is recorded in the history table in the same read/write
+// transaction as the DML statements at the end of the migration, so these
+// statements are only committed together with the record of the migration.
+// DDL statements cannot be executed in a transaction. A migration that ends
+// with DDL statements is recorded in a separate transaction after the DDL
+// statements have been applied, which means that the migration is applied
+// but not recorded if recording it fails. Apply returns an error that states
+// this, and the migration must then be recorded manually in the history
+// table. Otherwise the next call to Apply executes the DDL statements of the
+// migration again, which fails as the schema objects already exist.
+func Apply(ctx context.Context, db *sql.DB, migrations []Migration, options Options) ([]Migration, error) {
+	if options.HistoryTable == "" {
+		options.HistoryTable = DefaultHistoryTable
+	}
+	if options.Output == nil {
+		options.Output = io.Discard
+	}
+	sorted := make([]Migration, len(migrations))
+	copy(sorted, migrations)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+
+	// Use a single connection for all migrations to ensure that any session
+	// state that is set by a migration is also used by the next migrations.
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := checkDialect(ctx, conn); err != nil {
+		return nil, err
+	}
+	applied, err := appliedVersions(ctx, conn, options)
+	if err != nil {
+		return nil, err
+	}
+	var res []Migration
+	for _, migration := range sorted {
+		if applied[migration.Version] {
+			continue
+		}
+		if options.DryRun {
+			fmt.Fprintf(options.Output, "-- Migration %d: %s\n%s\n", migration.Version, migration.Name, migration.SQL)
+			res = append(res, migration)
+			continue
+		}
+		fmt.Fprintf(options.Output, "Applying migration %d: %s\n", migration.Version, migration.Name)
+		if err := applyMigration(ctx, conn, migration, options); err != nil {
+			err = recordError(err, migration, options)
+			return res, fmt.Errorf("migration %d (%s) failed: %w", migration.Version, migration.Name, err)
+		}
+		res = append(res, migration)
+	}
+	return res, nil
+}
+
+// checkDialect returns an error if the database does not use the GoogleSQL
+// dialect. The history table and the statements that record the migrations
+// use GoogleSQL syntax.
+func checkDialect(ctx context.Context, conn *sql.Conn) error {
+	var dialect string
+	if err := conn.QueryRowContext(ctx, dialectQuery).Scan(&dialect); err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("failed to read database dialect: %w", err)
+	}
+	if dialect != "" && !strings.EqualFold(dialect, "GOOGLE_STANDARD_SQL") {
+		return fmt.Errorf("database dialect %s is not supported, migrations can only be applied to GoogleSQL databases", dialect)
+	}
+	return nil
+}
+
+// appliedVersions returns the versions of the migrations that have been
+// applied to the database. The history table is created if it does not
+// exist.
+func appliedVersions(ctx context.Context, conn *sql.Conn, options Options) (map[int64]bool, error) {
+	var count int64
+	if err := conn.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_SCHEMA='' AND TABLE_NAME=@name",
+		options.HistoryTable).Scan(&count); err != nil {
+		return nil, fmt.Errorf("failed to check whether history table %s exists: %w", options.HistoryTable, err)
+	}
+	if count == 0 {
+		ddl := createHistoryTableStatement(options.HistoryTable)
+		if options.DryRun {
+			fmt.Fprintf(options.Output, "-- Create history table\n%s;\n", ddl)
+		} else {
+			fmt.Fprintf(options.Output, "Creating history table %s\n", options.HistoryTable)
+			if _, err := conn.ExecContext(ctx, ddl); err != nil {
+				return nil, fmt.Errorf("failed to create history table %s: %w", options.HistoryTable, err)
+			}
+		}
+		return map[int64]bool{}, nil
+	}
+	rows, err := conn.QueryContext(ctx, fmt.Sprintf("SELECT Version FROM %s", options.HistoryTable))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history table %s: %w", options.HistoryTable, err)
+	}
+	defer rows.Close()
+	applied := make(map[int64]bool)
+	for rows.Next() {
+		var version int64
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+	return applied, rows.Err()
+}
+
+func createHistoryTableStatement(table string) string {
+	return fmt.Sprintf("CREATE TABLE %s (Version INT64 NOT NULL, Name STRING(MAX) NOT NULL, AppliedAt TIMESTAMP NOT NULL OPTIONS (allow_commit_timestamp=true)) PRIMARY KEY (Version)", table)
+}
+
+// applyMigration executes the script of the given migration and records the
+// migration in the history table. The statement that records the migration is
+// added to the end of the script, so it is executed in the same read/write
+// transaction as the DML statements at the end of the migration.
+func applyMigration(ctx context.Context, conn *sql.Conn, migration Migration, options Options) error {
+	script := fmt.Sprintf("%s\n;\n%s", migration.SQL, historyInsertStatement(options.HistoryTable, migration))
+	return conn.Raw(func(driverConn interface{}) error {
+		spannerConn, ok := driverConn.(spannerdriver.SpannerConn)
+		if !ok {
+			return fmt.Errorf("unexpected driver connection %v, expected SpannerConn", driverConn)
+		}
+		return spannerConn.ExecScript(ctx, script)
+	})
+}
+
+// recordError returns a more descriptive error if the given error was caused
+// by the statement that records the migration in the history table. The
+// statements of the migration have then been applied if the migration ends
+// with DDL statements, as those cannot be rolled back.
+func recordError(err error, migration Migration, options Options) error {
+	var scriptErr *spannerdriver.ScriptError
+	if !errors.As(err, &scriptErr) || scriptErr.Statement != historyInsertStatement(options.HistoryTable, migration) {
+		return err
+	}
+	return fmt.Errorf("failed to record migration in history table %s, the DDL statements of the migration have been applied and must be reverted or the migration must be recorded manually: %w", options.HistoryTable, err)
+}
+
+var stringLiteralReplacer = strings.NewReplacer(`\`, `\\`, `'`, `\'`, "\n", `\n`, "\r", `\r`)
+
+// historyInsertStatement returns the statement that records the given
+// migration in the history table. The version and the name of the migration
+// are included as literals, as the statements in a script cannot use query
+// parameters.
+func historyInsertStatement(table string, migration Migration) string {
+	return fmt.Sprintf("INSERT INTO %s (Version, Name, AppliedAt) VALUES (%d, '%s', PENDING_COMMIT_TIMESTAMP())",
+		table, migration.Version, stringLiteralReplacer.Replace(migration.Name))
+}
@@ -0,0 +1,338 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"cloud.google.com/go/spanner"
+	"github.com/google/go-cmp/cmp"
+	_ "github.com/googleapis/go-sql-spanner"
+	"github.com/googleapis/go-sql-spanner/testutil"
+	databasepb "google.golang.org/genproto/googleapis/spanner/admin/database/v1"
+	sppb "google.golang.org/genproto/googleapis/spanner/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	historyTableExistsQuery = "SELECT COUNT(*) FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_SCHEMA='' AND TABLE_NAME=@name"
+	selectVersionsQuery     = "SELECT Version FROM SchemaMigrations"
+	insertHistory1Statement = "INSERT INTO SchemaMigrations (Version, Name, AppliedAt) VALUES (1, 'create_tables', PENDING_COMMIT_TIMESTAMP())"
+	insertHistory2Statement = "INSERT INTO SchemaMigrations (Version, Name, AppliedAt) VALUES (2, 'insert_singers', PENDING_COMMIT_TIMESTAMP())"
+	insertSingerStatement   = "INSERT INTO Singers (SingerId, Name) VALUES (1, 'Singer 1')"
+)
+
+var testMigrations = fstest.MapFS{
+	"0001_create_tables.sql": {Data: []byte(`
+		CREATE TABLE Singers (SingerId INT64, Name STRING(MAX)) PRIMARY KEY (SingerId);
+		CREATE INDEX Idx_Singers_Name ON Singers (Name);`)},
+	"0002_insert_singers.sql": {Data: []byte(insertSingerStatement + ";")},
+	"README.md":               {Data: []byte("Migrations")},
+}
+
+func TestLoad(t *testing.T) {
+	migrations, err := Load(testMigrations)
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+	var got []string
+	for _, m := range migrations {
+		got = append(got, fmt.Sprintf("%d %s", m.Version, m.Name))
+	}
+	if want := []string{"1 create_tables", "2 insert_singers"}; !cmp.Equal(got, want) {
+		t.Fatalf("migrations mismatch\nGot: %v\nWant: %v", got, want)
+	}
+
+	for _, fsys := range []fstest.MapFS{
+		{"create_tables.sql": {}},
+		{"1_create_tables.sql": {}, "01_insert_singers.sql": {}},
+	} {
+		if _, err := Load(fsys); err == nil {
+			t.Errorf("missing expected error for %v", fsys)
+		}
+	}
+}
+
+func setupTestDB(t *testing.T) (*sql.DB, *testutil.MockedSpannerInMemTestServer, func()) {
+	server, _, serverTeardown := testutil.NewMockedSpannerInMemTestServer(t)
+	db, err := sql.Open("spanner", fmt.Sprintf("%s/projects/p/instances/i/databases/d?useplaintext=true", server.Address))
+	if err != nil {
+		serverTeardown()
+		t.Fatal(err)
+	}
+	_ = server.TestSpanner.PutStatementResult(dialectQuery, &testutil.StatementResult{
+		Type:      testutil.StatementResultResultSet,
+		ResultSet: dialectResultSet("GOOGLE_STANDARD_SQL"),
+	})
+	for _, statement := range []string{insertHistory1Statement, insertHistory2Statement, insertSingerStatement} {
+		_ = server.TestSpanner.PutStatementResult(statement, &testutil.StatementResult{
+			Type:        testutil.StatementResultUpdateCount,
+			UpdateCount: 1,
+		})
+	}
+	return db, server, func() {
+		_ = db.Close()
+		serverTeardown()
+	}
+}
+
+func dialectResultSet(dialect string) *sppb.ResultSet {
+	return &sppb.ResultSet{
+		Metadata: &sppb.ResultSetMetadata{RowType: &sppb.StructType{Fields: []*sppb.StructType_Field{
+			{Name: "OPTION_VALUE", Type: &sppb.Type{Code: sppb.TypeCode_STRING}},
+		}}},
+		Rows: []*structpb.ListValue{{Values: []*structpb.Value{structpb.NewStringValue(dialect)}}},
+	}
+}
+
+func ddlRequests(server *testutil.MockedSpannerInMemTestServer) [][]string {
+	var res [][]string
+	for _, req := range server.TestDatabaseAdmin.Reqs() {
+		res = append(res, req.(*databasepb.UpdateDatabaseDdlRequest).Statements)
+	}
+	return res
+}
+
+func drainRequests(server *testutil.MockedSpannerInMemTestServer) []interface{} {
+	var reqs []interface{}
+	for {
+		select {
+		case req := <-server.TestSpanner.ReceivedRequests():
+			reqs = append(reqs, req)
+		default:
+			return reqs
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	ctx := context.Background()
+	db, server, teardown := setupTestDB(t)
+	defer teardown()
+	_ = server.TestSpanner.PutStatementResult(historyTableExistsQuery, &testutil.StatementResult{
+		Type:      testutil.StatementResultResultSet,
+		ResultSet: testutil.CreateSingleColumnResultSet([]int64{0}, ""),
+	})
+	migrations, err := Load(testMigrations)
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+
+	applied, err := Apply(ctx, db, migrations, Options{})
+	if err != nil {
+		t.Fatalf("failed to apply migrations: %v", err)
+	}
+	if g, w := len(applied), 2; g != w {
+		t.Fatalf("applied migrations count mismatch\nGot: %v\nWant: %v", g, w)
+	}
+	// The history table is created first, and the DDL statements of the
+	// first migration are executed as one batch.
+	want := [][]string{
+		{createHistoryTableStatement(DefaultHistoryTable)},
+		{
+			"CREATE TABLE Singers (SingerId INT64, Name STRING(MAX)) PRIMARY KEY (SingerId)",
+			"CREATE INDEX Idx_Singers_Name ON Singers (Name)",
+		},
+	}
+	if g, w := ddlRequests(server), want; !cmp.Equal(g, w) {
+		t.Fatalf("DDL requests mismatch\nGot: %v\nWant: %v", g, w)
+	}
+	if g, w := server.TestDatabaseAdmin.Ddl("projects/p/instances/i/databases/d"), append(want[0], want[1]...); !cmp.Equal(g, w) {
+		t.Fatalf("database DDL mismatch\nGot: %v\nWant: %v", g, w)
+	}
+	// The first migration ends with DDL and is recorded separately. The
+	// second migration ends with DML and is recorded in the same batch and
+	// transaction as the DML statement.
+	requests := drainRequests(server)
+	var sqls []string
+	for _, req := range requests {
+		if req, ok := req.(*sppb.ExecuteSqlRequest); ok {
+			sqls = append(sqls, req.Sql)
+		}
+	}
+	if g, w := sqls, []string{dialectQuery, historyTableExistsQuery, insertHistory1Statement}; !cmp.Equal(g, w) {
+		t.Fatalf("sql requests mismatch\nGot: %v\nWant: %v", g, w)
+	}
+	var batches [][]string
+	for _, req := range requests {
+		if req, ok := req.(*sppb.ExecuteBatchDmlRequest); ok {
+			var batch []string
+			for _, statement := range req.Statements {
+				batch = append(batch, statement.Sql)
+			}
+			batches = append(batches, batch)
+		}
+	}
+	if g, w := batches, [][]string{{insertSingerStatement, insertHistory2Statement}}; !cmp.Equal(g, w) {
+		t.Fatalf("batch DML requests mismatch\nGot: %v\nWant: %v", g, w)
+	}
+}
+
+func TestApply_RecordFailure(t *testing.T) {
+	ctx := context.Background()
+	db, server, teardown := setupTestDB(t)
+	defer teardown()
+	_ = server.TestSpanner.PutStatementResult(historyTableExistsQuery, &testutil.StatementResult{
+		Type:      testutil.StatementResultResultSet,
+		ResultSet: testutil.CreateSingleColumnResultSet([]int64{1}, ""),
+	})
+	_ = server.TestSpanner.PutStatementResult(selectVersionsQuery, &testutil.StatementResult{
+		Type:      testutil.StatementResultResultSet,
+		ResultSet: testutil.CreateSingleColumnResultSet([]int64{}, "Version"),
+	})
+	_ = server.TestSpanner.PutStatementResult(insertHistory1Statement, &testutil.StatementResult{
+		Type: testutil.StatementResultError,
+		Err:  status.Error(codes.PermissionDenied, "Permission denied"),
+	})
+	migrations, err := Load(testMigrations)
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+
+	// The first migration ends with DDL. The DDL statements are applied, but
+	// the migration is not recorded, and Apply stops.
+	applied, err := Apply(ctx, db, migrations, Options{})
+	if err == nil {
+		t.Fatal("missing expected error")
+	}
+	if g, w := spanner.ErrCode(err), codes.PermissionDenied; g != w {
+		t.Fatalf("error code mismatch\nGot: %v\nWant: %v", g, w)
+	}
+	if !strings.Contains(err.Error(), "must be recorded manually") {
+		t.Fatalf("error does not state that the migration must be recorded manually: %v", err)
+	}
+	if g, w := len(applied), 0; g != w {
+		t.Fatalf("applied migrations count mismatch\nGot: %v\nWant: %v", g, w)
+	}
+	want := []string{
+		"CREATE TABLE Singers (SingerId INT64, Name STRING(MAX)) PRIMARY KEY (SingerId)",
+		"CREATE INDEX Idx_Singers_Name ON Singers (Name)",
+	}
+	if g, w := server.TestDatabaseAdmin.Ddl("projects/p/instances/i/databases/d"), want; !cmp.Equal(g, w) {
+		t.Fatalf("database DDL mismatch\nGot: %v\nWant: %v", g, w)
+	}
+}
+
+func TestApply_PostgreSQL(t *testing.T) {
+	ctx := context.Background()
+	db, server, teardown := setupTestDB(t)
+	defer teardown()
+	_ = server.TestSpanner.PutStatementResult(dialectQuery, &testutil.StatementResult{
+		Type:      testutil.StatementResultResultSet,
+		ResultSet: dialectResultSet("POSTGRESQL"),
+	})
+	migrations, err := Load(testMigrations)
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+
+	applied, err := Apply(ctx, db, migrations, Options{})
+	if err == nil || !strings.Contains(err.Error(), "dialect POSTGRESQL is not supported") {
+		t.Fatalf("missing expected unsupported dialect error, got: %v", err)
+	}
+	if g, w := len(applied), 0; g != w {
+		t.Fatalf("applied migrations count mismatch\nGot: %v\nWant: %v", g, w)
+	}
+	if g, w := len(ddlRequests(server)), 0; g != w {
+		t.Fatalf("DDL requests count mismatch\nGot: %v\nWant: %v", g, w)
+	}
+}
+
+func TestHistoryInsertStatement(t *testing.T) {
+	got := historyInsertStatement("History", Migration{Version: 3, Name: `it's a \ test`})
+	if want := `INSERT INTO History (Version, Name, AppliedAt) VALUES (3, 'it\'s a \\ test', PENDING_COMMIT_TIMESTAMP())`; got != want {
+		t.Fatalf("statement mismatch\nGot: %v\nWant: %v", got, want)
+	}
+}
+
+func TestApply_SkipsAppliedMigrations(t *testing.T) {
+	ctx := context.Background()
+	db, server, teardown := setupTestDB(t)
+	defer teardown()
+	_ = server.TestSpanner.PutStatementResult(historyTableExistsQuery, &testutil.StatementResult{
+		Type:      testutil.StatementResultResultSet,
+		ResultSet: testutil.CreateSingleColumnResultSet([]int64{1}, ""),
+	})
+	_ = server.TestSpanner.PutStatementResult(selectVersionsQuery, &testutil.StatementResult{
+		Type:      testutil.StatementResultResultSet,
+		ResultSet: testutil.CreateSingleColumnResultSet([]int64{1}, "Version"),
+	})
+	migrations, err := Load(testMigrations)
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+
+	var out strings.Builder
+	applied, err := Apply(ctx, db, migrations, Options{Output: &out})
+	if err != nil {
+		t.Fatalf("failed to apply migrations: %v", err)
+	}
+	if g, w := len(applied), 1; g != w {
+		t.Fatalf("applied migrations count mismatch\nGot: %v\nWant: %v", g, w)
+	}
+	if g, w := applied[0].Version, int64(2); g != w {
+		t.Fatalf("applied version mismatch\nGot: %v\nWant: %v", g, w)
+	}
+	if g, w := len(ddlRequests(server)), 0; g != w {
+		t.Fatalf("DDL requests count mismatch\nGot: %v\nWant: %v", g, w)
+	}
+	if g, w := out.String(), "Applying migration 2: insert_singers\n"; g != w {
+		t.Fatalf("output mismatch\nGot: %q\nWant: %q", g, w)
+	}
+}
+
+func TestApply_DryRun(t *testing.T) {
+	ctx := context.Background()
+	db, server, teardown := setupTestDB(t)
+	defer teardown()
+	_ = server.TestSpanner.PutStatementResult(historyTableExistsQuery, &testutil.StatementResult{
+		Type:      testutil.StatementResultResultSet,
+		ResultSet: testutil.CreateSingleColumnResultSet([]int64{0}, ""),
+	})
+	migrations, err := Load(testMigrations)
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+
+	var out strings.Builder
+	applied, err := Apply(ctx, db, migrations, Options{DryRun: true, Output: &out})
+	if err != nil {
+		t.Fatalf("failed to apply migrations: %v", err)
+	}
+	if g, w := len(applied), 2; g != w {
+		t.Fatalf("applied migrations count mismatch\nGot: %v\nWant: %v", g, w)
+	}
+	if g, w := len(ddlRequests(server)), 0; g != w {
+		t.Fatalf("DDL requests count mismatch\nGot: %v\nWant: %v", g, w)
+	}
+	for _, want := range []string{
+		createHistoryTableStatement(DefaultHistoryTable),
+		"-- Migration 1: create_tables",
+		"CREATE INDEX Idx_Singers_Name ON Singers (Name)",
+		"-- Migration 2: insert_singers",
+		insertSingerStatement,
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("missing %q in dry-run output:\n%s", want, out.String())
+		}
+	}
+}
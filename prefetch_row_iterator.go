@@ -0,0 +1,223 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"sync"
+
+	"cloud.google.com/go/spanner"
+	"google.golang.org/api/iterator"
+	sppb "google.golang.org/genproto/googleapis/spanner/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+var _ rowIterator = &prefetchRowIterator{}
+
+// prefetchRowIterator reads the rows of a rowIterator in a background
+// goroutine and buffers them until they are consumed by the application. The
+// buffer is bounded by a maximum number of rows and optionally by a maximum
+// number of bytes. The goroutine pauses when the buffer is full, which means
+// that Spanner applies flow control to the stream when the application reads
+// slower than Spanner returns rows.
+//
+// Stopping the iterator cancels the context of the underlying query, which
+// promptly stops the stream, also if the goroutine is waiting for Spanner to
+// return more rows.
+type prefetchRowIterator struct {
+	it     rowIterator
+	cancel context.CancelFunc
+
+	// maxBytes is the maximum number of bytes to buffer. Zero means that the
+	// buffer is only bounded by the number of rows. The buffer always accepts
+	// at least one row, regardless of its size.
+	maxBytes int64
+
+	results  chan prefetchResult
+	stopCh   chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	buffered int64
+	stopped  bool
+
+	// metadata and stats are set by the background goroutine before it sends
+	// the first and the last result to the results channel.
+	metadataReady chan struct{}
+	metadata      *sppb.ResultSetMetadata
+	stats         *sppb.ResultSetStats
+
+	// err is the error that ended the iteration.
+	err error
+}
+
+type prefetchResult struct {
+	row  *spanner.Row
+	size int64
+	err  error
+}
+
+// newPrefetchRowIterator starts prefetching rows from the given iterator.
+// cancel must cancel the context of the query of the iterator.
+func newPrefetchRowIterator(it rowIterator, cancel context.CancelFunc, maxRows int, maxBytes int64) *prefetchRowIterator {
+	p := &prefetchRowIterator{
+		it:            it,
+		cancel:        cancel,
+		maxBytes:      maxBytes,
+		results:       make(chan prefetchResult, maxRows),
+		stopCh:        make(chan struct{}),
+		done:          make(chan struct{}),
+		metadataReady: make(chan struct{}),
+	}
+	p.cond = sync.NewCond(&p.mu)
+	go p.run()
+	return p
+}
+
+func (p *prefetchRowIterator) run() {
+	defer close(p.done)
+	first := true
+	for {
+		row, err := p.it.Next()
+		if first {
+			p.metadata = p.it.Metadata()
+			close(p.metadataReady)
+			first = false
+		}
+		if err != nil {
+			if err == iterator.Done {
+				p.stats = p.it.ResultSetStats()
+			}
+			p.send(prefetchResult{err: err})
+			return
+		}
+		var size int64
+		if p.maxBytes > 0 {
+			size = rowSize(row)
+			if !p.reserve(size) {
+				return
+			}
+		}
+		if !p.send(prefetchResult{row: row, size: size}) {
+			return
+		}
+	}
+}
+
+// send sends the result to the buffer, and returns false if the iterator
+// was stopped before the buffer had room for the result.
+func (p *prefetchRowIterator) send(r prefetchResult) bool {
+	select {
+	case p.results <- r:
+		return true
+	case <-p.stopCh:
+		return false
+	}
+}
+
+// reserve waits until the buffer has room for a row of the given size, and
+// returns false if the iterator was stopped while waiting.
+func (p *prefetchRowIterator) reserve(size int64) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for !p.stopped && p.buffered > 0 && p.buffered+size > p.maxBytes {
+		p.cond.Wait()
+	}
+	if p.stopped {
+		return false
+	}
+	p.buffered += size
+	return true
+}
+
+func (p *prefetchRowIterator) release(size int64) {
+	if size == 0 {
+		return
+	}
+	p.mu.Lock()
+	p.buffered -= size
+	p.cond.Signal()
+	p.mu.Unlock()
+}
+
+func (p *prefetchRowIterator) Next() (*spanner.Row, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	select {
+	case <-p.stopCh:
+		p.err = iterator.Done
+		return nil, p.err
+	default:
+	}
+	select {
+	case r := <-p.results:
+		if r.err != nil {
+			p.err = r.err
+			return nil, r.err
+		}
+		p.release(r.size)
+		return r.row, nil
+	case <-p.stopCh:
+		p.err = iterator.Done
+		return nil, p.err
+	}
+}
+
+func (p *prefetchRowIterator) Stop() {
+	p.stopOnce.Do(func() {
+		close(p.stopCh)
+		p.cancel()
+		p.mu.Lock()
+		p.stopped = true
+		p.cond.Broadcast()
+		p.mu.Unlock()
+		<-p.done
+		p.it.Stop()
+	})
+}
+
+func (p *prefetchRowIterator) Metadata() *sppb.ResultSetMetadata {
+	select {
+	case <-p.metadataReady:
+		return p.metadata
+	case <-p.done:
+		return p.metadata
+	}
+}
+
+func (p *prefetchRowIterator) ResultSetStats() *sppb.ResultSetStats {
+	// The stats are only set after the background goroutine has sent the
+	// last result, which is consumed before the application asks for the
+	// stats.
+	if p.err == nil {
+		return nil
+	}
+	return p.stats
+}
+
+// rowSize returns the approximate size of the given row in bytes.
+func rowSize(row *spanner.Row) int64 {
+	var size int64
+	for i := 0; i < row.Size(); i++ {
+		var col spanner.GenericColumnValue
+		if err := row.Column(i, &col); err == nil {
+			size += int64(proto.Size(col.Value))
+		}
+	}
+	return size
+}
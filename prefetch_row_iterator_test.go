@@ -0,0 +1,199 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"github.com/googleapis/go-sql-spanner/testutil"
+	"google.golang.org/api/iterator"
+	sppb "google.golang.org/genproto/googleapis/spanner/v1"
+)
+
+// countingIterator returns the given number of rows and counts the number of
+// times that Next has been called.
+type countingIterator struct {
+	row     *spanner.Row
+	rows    int64
+	count   int64
+	stopped int32
+}
+
+func (it *countingIterator) Next() (*spanner.Row, error) {
+	if atomic.AddInt64(&it.count, 1) > it.rows {
+		return nil, iterator.Done
+	}
+	return it.row, nil
+}
+
+func (it *countingIterator) Stop() {
+	atomic.StoreInt32(&it.stopped, 1)
+}
+
+func (it *countingIterator) Metadata() *sppb.ResultSetMetadata {
+	return &sppb.ResultSetMetadata{RowType: &sppb.StructType{Fields: []*sppb.StructType_Field{
+		{Name: "Value", Type: &sppb.Type{Code: sppb.TypeCode_STRING}},
+	}}}
+}
+
+func (it *countingIterator) ResultSetStats() *sppb.ResultSetStats {
+	return nil
+}
+
+// waitForCount waits until the iterator has been called the given number of
+// times, and then verifies that it is not called more often.
+func waitForCount(t *testing.T, it *countingIterator, want int64) {
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt64(&it.count) < want && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if g, w := atomic.LoadInt64(&it.count), want; g != w {
+		t.Fatalf("next count mismatch\nGot: %v\nWant: %v", g, w)
+	}
+}
+
+func TestPrefetchRowIterator_MaxRows(t *testing.T) {
+	row := newRow(t, []string{"Value"}, []interface{}{"foo"})
+	it := &countingIterator{row: row, rows: 10}
+	p := newPrefetchRowIterator(it, func() {}, 2, 0)
+	defer p.Stop()
+
+	// Two rows are buffered, and the third row waits for room in the buffer.
+	waitForCount(t, it, 3)
+	if _, err := p.Next(); err != nil {
+		t.Fatalf("failed to get row: %v", err)
+	}
+	waitForCount(t, it, 4)
+
+	var n int
+	for {
+		_, err := p.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to get row: %v", err)
+		}
+		n++
+	}
+	if g, w := n, 9; g != w {
+		t.Fatalf("row count mismatch\nGot: %v\nWant: %v", g, w)
+	}
+	if p.Metadata() == nil {
+		t.Fatal("missing metadata")
+	}
+}
+
+func TestPrefetchRowIterator_MaxBytes(t *testing.T) {
+	row := newRow(t, []string{"Value"}, []interface{}{strings.Repeat("a", 100)})
+	size := rowSize(row)
+	it := &countingIterator{row: row, rows: 10}
+	p := newPrefetchRowIterator(it, func() {}, 10, 3*size)
+	defer p.Stop()
+
+	// Three rows fit in the buffer, and the fourth row waits for room.
+	waitForCount(t, it, 4)
+	if _, err := p.Next(); err != nil {
+		t.Fatalf("failed to get row: %v", err)
+	}
+	waitForCount(t, it, 5)
+}
+
+func TestPrefetchRowIterator_Stop(t *testing.T) {
+	row := newRow(t, []string{"Value"}, []interface{}{"foo"})
+	it := &countingIterator{row: row, rows: 1000}
+	ctx, cancel := context.WithCancel(context.Background())
+	p := newPrefetchRowIterator(it, cancel, 2, 0)
+
+	if _, err := p.Next(); err != nil {
+		t.Fatalf("failed to get row: %v", err)
+	}
+	p.Stop()
+	if ctx.Err() == nil {
+		t.Fatal("query context was not cancelled")
+	}
+	if atomic.LoadInt32(&it.stopped) == 0 {
+		t.Fatal("underlying iterator was not stopped")
+	}
+	if _, err := p.Next(); err != iterator.Done {
+		t.Fatalf("error mismatch\nGot: %v\nWant: %v", err, iterator.Done)
+	}
+	if g := atomic.LoadInt64(&it.count); g > 4 {
+		t.Fatalf("too many rows fetched after stop: %v", g)
+	}
+}
+
+func BenchmarkPrefetchQueryDisabled(b *testing.B) {
+	benchmarkPrefetchQuery(b, "")
+}
+
+func BenchmarkPrefetchQueryEnabled(b *testing.B) {
+	benchmarkPrefetchQuery(b, ";prefetch_rows=100;prefetch_bytes=65536")
+}
+
+// benchmarkPrefetchQuery measures the time that is needed to execute a query
+// and read all rows from the in-memory mock server with the given connection
+// parameters.
+func benchmarkPrefetchQuery(b *testing.B, params string) {
+	server, _, teardown := testutil.NewMockedSpannerInMemTestServer(b)
+	defer teardown()
+	db, err := sql.Open("spanner", fmt.Sprintf("%s/projects/p/instances/i/databases/d?useplaintext=true%s", server.Address, params))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Close()
+	query := "SELECT Value FROM Numbers"
+	values := make([]int64, 1000)
+	for i := range values {
+		values[i] = int64(i)
+	}
+	_ = server.TestSpanner.PutStatementResult(query, &testutil.StatementResult{
+		Type:      testutil.StatementResultResultSet,
+		ResultSet: testutil.CreateSingleColumnResultSet(values, "Value"),
+	})
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		rows, err := db.QueryContext(ctx, query)
+		if err != nil {
+			b.Fatal(err)
+		}
+		var count int
+		for rows.Next() {
+			var v int64
+			if err := rows.Scan(&v); err != nil {
+				b.Fatal(err)
+			}
+			count++
+		}
+		if err := rows.Err(); err != nil {
+			b.Fatal(err)
+		}
+		_ = rows.Close()
+		if count != len(values) {
+			b.Fatalf("row count mismatch\nGot: %v\nWant: %v", count, len(values))
+		}
+	}
+}
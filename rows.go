@@ -17,21 +17,58 @@ package spannerdriver
 import (
 	"database/sql/driver"
 	"io"
+	"math"
+	"math/big"
+	"reflect"
+	"strings"
 	"sync"
+	"time"
 
+	"cloud.google.com/go/civil"
 	"cloud.google.com/go/spanner"
 	"google.golang.org/api/iterator"
 	sppb "google.golang.org/genproto/googleapis/spanner/v1"
 )
 
+// SpannerRows is the driver.Rows implementation that is returned by this
+// driver. It can be used through the QueryContext method of the connection
+// that is returned by (*sql.Conn).Raw to get the statistics of a query.
+type SpannerRows interface {
+	driver.Rows
+
+	// ResultSetStats returns the query plan and the query statistics that
+	// Spanner returned for the query, or nil if Spanner did not return any
+	// statistics. Spanner only returns statistics for queries that are
+	// executed in PLAN or PROFILE mode, for example by EXPLAIN ANALYZE. The
+	// statistics are only available after all rows have been consumed.
+	ResultSetStats() *sppb.ResultSetStats
+}
+
+var _ SpannerRows = &rows{}
+
 type rows struct {
 	it rowIterator
+	// conn is the connection that executed the query. The statistics of the
+	// query are registered on the connection when all rows have been read.
+	conn *conn
+	// decodeMode determines how the values of a row are decoded in Next.
+	decodeMode DecodeMode
 
 	colsOnce sync.Once
 	dirtyErr error
 	cols     []string
+	colTypes []*sppb.Type
+	// decoders contains the decoder for each column. The decoders are
+	// created once for each result set from the row type of the result.
+	decoders []columnDecoder
+	col      spanner.GenericColumnValue
 
 	dirtyRow *spanner.Row
+
+	// nextResultSets contains the functions that execute the remaining
+	// statements of a query string that contains multiple statements. Each
+	// function is called when the caller moves to the next result set.
+	nextResultSets []func() (rowIterator, error)
 }
 
 // Columns returns the names of the columns. The number of
@@ -43,14 +80,111 @@ func (r *rows) Columns() []string {
 	return r.cols
 }
 
-// Close closes the rows iterator.
+// ColumnTypeDatabaseTypeName returns the Spanner type name of the column,
+// for example `INT64` or `ARRAY<STRING(MAX)>`.
+func (r *rows) ColumnTypeDatabaseTypeName(index int) string {
+	r.getColumns()
+	return typeName(r.colTypes[index])
+}
+
+// ColumnTypeNullable returns ok=false, as the result set metadata that is
+// returned by Spanner does not contain any information on whether a column
+// is nullable or not.
+func (r *rows) ColumnTypeNullable(index int) (nullable, ok bool) {
+	return false, false
+}
+
+// ColumnTypeLength returns math.MaxInt64 for STRING and BYTES columns, as the
+// result set metadata that is returned by Spanner does not contain the
+// maximum length of a column.
+func (r *rows) ColumnTypeLength(index int) (length int64, ok bool) {
+	r.getColumns()
+	switch r.colTypes[index].Code {
+	case sppb.TypeCode_STRING, sppb.TypeCode_BYTES:
+		return math.MaxInt64, true
+	}
+	return 0, false
+}
+
+// ColumnTypePrecisionScale returns the precision and scale of NUMERIC columns.
+func (r *rows) ColumnTypePrecisionScale(index int) (precision, scale int64, ok bool) {
+	r.getColumns()
+	if r.colTypes[index].Code == sppb.TypeCode_NUMERIC {
+		return spanner.NumericPrecisionDigits, spanner.NumericScaleDigits, true
+	}
+	return 0, 0, false
+}
+
+// ColumnTypeScanType returns the type of the values that are returned by Next
+// for the column. The type depends on the DecodeMode of the rows.
+func (r *rows) ColumnTypeScanType(index int) reflect.Type {
+	r.getColumns()
+	return scanType(r.colTypes[index], r.decodeMode)
+}
+
+// Close closes the rows iterator. The remaining statements of a query string
+// that contains multiple statements are only executed when the caller advances
+// to their result sets, and are skipped when the rows are closed before that.
 func (r *rows) Close() error {
 	r.it.Stop()
+	r.nextResultSets = nil
+	return nil
+}
+
+// ResultSetStats returns the query plan and the query statistics that Spanner
+// returned for the current result set.
+func (r *rows) ResultSetStats() *sppb.ResultSetStats {
+	return r.it.ResultSetStats()
+}
+
+// done is called when all rows of the current result set have been read.
+func (r *rows) done() {
+	if r.conn != nil {
+		if stats := r.it.ResultSetStats(); stats != nil {
+			r.conn.queryStats = stats
+		}
+	}
+}
+
+// HasNextResultSet returns true if the query string that was executed
+// contained more statements than the one that is currently being iterated.
+func (r *rows) HasNextResultSet() bool {
+	return len(r.nextResultSets) > 0
+}
+
+// NextResultSet executes the next statement of the query string and advances
+// the rows to the result of that statement. The current result set is closed.
+func (r *rows) NextResultSet() error {
+	if len(r.nextResultSets) == 0 {
+		return io.EOF
+	}
+	r.it.Stop()
+	next := r.nextResultSets[0]
+	r.nextResultSets = r.nextResultSets[1:]
+	it, err := next()
+	if err != nil {
+		// Skip any remaining statements when one of the statements fails.
+		r.it = &clientSideIterator{}
+		r.nextResultSets = nil
+		return err
+	}
+	r.it = it
+	r.colsOnce = sync.Once{}
+	r.dirtyErr = nil
+	r.dirtyRow = nil
+	r.cols = nil
+	r.colTypes = nil
+	r.decoders = nil
 	return nil
 }
 
 func (r *rows) getColumns() {
 	r.colsOnce.Do(func() {
+		// The metadata of a query is only available after the first row has
+		// been read, as Spanner returns it together with the first rows of
+		// the result. Prefetching therefore does not reduce the time until
+		// the columns are known, but it does reduce the time that is needed
+		// to read the remaining rows.
 		row, err := r.it.Next()
 		if err == nil {
 			r.dirtyRow = row
@@ -62,9 +196,12 @@ func (r *rows) getColumns() {
 		}
 		rowType := r.it.Metadata().RowType
 		r.cols = make([]string, len(rowType.Fields))
+		r.colTypes = make([]*sppb.Type, len(rowType.Fields))
 		for i, c := range rowType.Fields {
 			r.cols[i] = c.Name
+			r.colTypes[i] = c.Type
 		}
+		r.decoders = newColumnDecoders(rowType, r.decodeMode)
 	})
 }
 
@@ -87,6 +224,7 @@ func (r *rows) Next(dest []driver.Value) error {
 		err := r.dirtyErr
 		r.dirtyErr = nil
 		if err == iterator.Done {
+			r.done()
 			return io.EOF
 		}
 		return err
@@ -94,6 +232,7 @@ func (r *rows) Next(dest []driver.Value) error {
 		var err error
 		row, err = r.it.Next() // returns io.EOF when there is no next
 		if err == iterator.Done {
+			r.done()
 			return io.EOF
 		}
 		if err != nil {
@@ -102,156 +241,95 @@ func (r *rows) Next(dest []driver.Value) error {
 	}
 
 	for i := 0; i < row.Size(); i++ {
-		var col spanner.GenericColumnValue
-		if err := row.Column(i, &col); err != nil {
+		// The column value is decoded into a GenericColumnValue that is
+		// re-used for all columns and rows, as decoding into it does not
+		// copy or allocate, and the value is then decoded by the decoder
+		// for the column.
+		if err := row.Column(i, &r.col); err != nil {
 			return err
 		}
-		switch col.Type.Code {
-		case sppb.TypeCode_INT64:
-			var v spanner.NullInt64
-			if err := col.Decode(&v); err != nil {
-				return err
-			}
-			if v.Valid {
-				dest[i] = v.Int64
+		v, err := r.decoders[i](r.col)
+		if err != nil {
+			return err
+		}
+		dest[i] = v
+	}
+	return nil
+}
+
+// typeName returns the Spanner type name for the given type.
+func typeName(t *sppb.Type) string {
+	switch t.Code {
+	case sppb.TypeCode_STRING, sppb.TypeCode_BYTES:
+		return t.Code.String() + "(MAX)"
+	case sppb.TypeCode_ARRAY:
+		return "ARRAY<" + typeName(t.ArrayElementType) + ">"
+	case sppb.TypeCode_STRUCT:
+		fields := make([]string, len(t.StructType.GetFields()))
+		for i, f := range t.StructType.GetFields() {
+			if f.Name == "" {
+				fields[i] = typeName(f.Type)
 			} else {
-				dest[i] = nil
+				fields[i] = f.Name + " " + typeName(f.Type)
 			}
+		}
+		return "STRUCT<" + strings.Join(fields, ", ") + ">"
+	}
+	return t.Code.String()
+}
+
+// scanType returns the type of the values that rows.Next returns for the
+// given Spanner type and decode mode.
+func scanType(t *sppb.Type, mode DecodeMode) reflect.Type {
+	if mode == DecodeModeGeneric {
+		return reflect.TypeOf(spanner.GenericColumnValue{})
+	}
+	switch t.Code {
+	case sppb.TypeCode_BOOL:
+		return reflect.TypeOf(false)
+	case sppb.TypeCode_INT64:
+		return reflect.TypeOf(int64(0))
+	case sppb.TypeCode_FLOAT64:
+		return reflect.TypeOf(float64(0))
+	case sppb.TypeCode_NUMERIC:
+		return reflect.TypeOf(big.Rat{})
+	case sppb.TypeCode_STRING:
+		return reflect.TypeOf("")
+	case sppb.TypeCode_JSON:
+		if mode == DecodeModeNative {
+			return reflect.TypeOf("")
+		}
+		return reflect.TypeOf(spanner.NullJSON{})
+	case sppb.TypeCode_BYTES:
+		return reflect.TypeOf([]byte{})
+	case sppb.TypeCode_DATE:
+		return reflect.TypeOf(civil.Date{})
+	case sppb.TypeCode_TIMESTAMP:
+		return reflect.TypeOf(time.Time{})
+	case sppb.TypeCode_ARRAY:
+		if mode == DecodeModeNative {
+			return reflect.SliceOf(scanType(t.ArrayElementType, mode))
+		}
+		switch t.ArrayElementType.Code {
+		case sppb.TypeCode_BOOL:
+			return reflect.TypeOf([]spanner.NullBool{})
+		case sppb.TypeCode_INT64:
+			return reflect.TypeOf([]spanner.NullInt64{})
 		case sppb.TypeCode_FLOAT64:
-			var v spanner.NullFloat64
-			if err := col.Decode(&v); err != nil {
-				return err
-			}
-			if v.Valid {
-				dest[i] = v.Float64
-			} else {
-				dest[i] = nil
-			}
+			return reflect.TypeOf([]spanner.NullFloat64{})
 		case sppb.TypeCode_NUMERIC:
-			var v spanner.NullNumeric
-			if err := col.Decode(&v); err != nil {
-				return err
-			}
-			if v.Valid {
-				dest[i] = v.Numeric
-			} else {
-				dest[i] = nil
-			}
+			return reflect.TypeOf([]spanner.NullNumeric{})
 		case sppb.TypeCode_STRING:
-			var v spanner.NullString
-			if err := col.Decode(&v); err != nil {
-				return err
-			}
-			if v.Valid {
-				dest[i] = v.StringVal
-			} else {
-				dest[i] = nil
-			}
+			return reflect.TypeOf([]spanner.NullString{})
 		case sppb.TypeCode_JSON:
-			var v spanner.NullJSON
-			if err := col.Decode(&v); err != nil {
-				return err
-			}
-			// We always assign `v` to dest[i] here because there is no native type
-			// for JSON in the Go sql package. That means that instead of returning
-			// nil we should return a NullJSON with valid=false.
-			dest[i] = v
+			return reflect.TypeOf([]spanner.NullJSON{})
 		case sppb.TypeCode_BYTES:
-			// The column value is a base64 encoded string.
-			var v []byte
-			if err := col.Decode(&v); err != nil {
-				return err
-			}
-			dest[i] = v
-		case sppb.TypeCode_BOOL:
-			var v spanner.NullBool
-			if err := col.Decode(&v); err != nil {
-				return err
-			}
-			if v.Valid {
-				dest[i] = v.Bool
-			} else {
-				dest[i] = nil
-			}
+			return reflect.TypeOf([][]byte{})
 		case sppb.TypeCode_DATE:
-			var v spanner.NullDate
-			if err := col.Decode(&v); err != nil {
-				return err
-			}
-			if v.Valid {
-				dest[i] = v.Date
-			} else {
-				dest[i] = nil
-			}
+			return reflect.TypeOf([]spanner.NullDate{})
 		case sppb.TypeCode_TIMESTAMP:
-			var v spanner.NullTime
-			if err := col.Decode(&v); err != nil {
-				return err
-			}
-			if v.Valid {
-				dest[i] = v.Time
-			} else {
-				dest[i] = nil
-			}
-		case sppb.TypeCode_ARRAY:
-			switch col.Type.ArrayElementType.Code {
-			case sppb.TypeCode_INT64:
-				var v []spanner.NullInt64
-				if err := col.Decode(&v); err != nil {
-					return err
-				}
-				dest[i] = v
-			case sppb.TypeCode_FLOAT64:
-				var v []spanner.NullFloat64
-				if err := col.Decode(&v); err != nil {
-					return err
-				}
-				dest[i] = v
-			case sppb.TypeCode_NUMERIC:
-				var v []spanner.NullNumeric
-				if err := col.Decode(&v); err != nil {
-					return err
-				}
-				dest[i] = v
-			case sppb.TypeCode_STRING:
-				var v []spanner.NullString
-				if err := col.Decode(&v); err != nil {
-					return err
-				}
-				dest[i] = v
-			case sppb.TypeCode_JSON:
-				var v []spanner.NullJSON
-				if err := col.Decode(&v); err != nil {
-					return err
-				}
-				dest[i] = v
-			case sppb.TypeCode_BYTES:
-				var v [][]byte
-				if err := col.Decode(&v); err != nil {
-					return err
-				}
-				dest[i] = v
-			case sppb.TypeCode_BOOL:
-				var v []spanner.NullBool
-				if err := col.Decode(&v); err != nil {
-					return err
-				}
-				dest[i] = v
-			case sppb.TypeCode_DATE:
-				var v []spanner.NullDate
-				if err := col.Decode(&v); err != nil {
-					return err
-				}
-				dest[i] = v
-			case sppb.TypeCode_TIMESTAMP:
-				var v []spanner.NullTime
-				if err := col.Decode(&v); err != nil {
-					return err
-				}
-				dest[i] = v
-			}
+			return reflect.TypeOf([]spanner.NullTime{})
 		}
-		// TODO: Implement struct
 	}
-	return nil
+	return reflect.TypeOf(new(interface{})).Elem()
 }
@@ -18,10 +18,16 @@ import (
 	"database/sql/driver"
 	"fmt"
 	"io"
+	"math"
+	"math/big"
 	"testing"
+	"time"
 
+	"cloud.google.com/go/civil"
 	"cloud.google.com/go/spanner"
+	"github.com/google/go-cmp/cmp"
 	sppb "google.golang.org/genproto/googleapis/spanner/v1"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
 type testIterator struct {
@@ -46,7 +52,11 @@ func (t *testIterator) Metadata() *sppb.ResultSetMetadata {
 	return t.metadata
 }
 
-func newRow(t *testing.T, cols []string, vals []interface{}) *spanner.Row {
+func (t *testIterator) ResultSetStats() *sppb.ResultSetStats {
+	return nil
+}
+
+func newRow(t testing.TB, cols []string, vals []interface{}) *spanner.Row {
 	row, err := spanner.NewRow(cols, vals)
 	if err != nil {
 		t.Fatalf("failed to create test row: %v", err)
@@ -109,3 +119,125 @@ func TestRows_Next(t *testing.T) {
 		}
 	}
 }
+
+func TestColumnDecoders(t *testing.T) {
+	for i, test := range []struct {
+		typ     *sppb.Type
+		value   *structpb.Value
+		want    driver.Value
+		wantErr bool
+	}{
+		{&sppb.Type{Code: sppb.TypeCode_INT64}, structpb.NewStringValue("-100"), int64(-100), false},
+		{&sppb.Type{Code: sppb.TypeCode_INT64}, structpb.NewNullValue(), nil, false},
+		{&sppb.Type{Code: sppb.TypeCode_INT64}, structpb.NewStringValue("foo"), nil, true},
+		{&sppb.Type{Code: sppb.TypeCode_INT64}, structpb.NewNumberValue(1), nil, true},
+		{&sppb.Type{Code: sppb.TypeCode_FLOAT64}, structpb.NewNumberValue(3.14), 3.14, false},
+		{&sppb.Type{Code: sppb.TypeCode_FLOAT64}, structpb.NewStringValue("Infinity"), math.Inf(1), false},
+		{&sppb.Type{Code: sppb.TypeCode_FLOAT64}, structpb.NewStringValue("-Infinity"), math.Inf(-1), false},
+		{&sppb.Type{Code: sppb.TypeCode_FLOAT64}, structpb.NewStringValue("1.0"), nil, true},
+		{&sppb.Type{Code: sppb.TypeCode_BOOL}, structpb.NewBoolValue(true), true, false},
+		{&sppb.Type{Code: sppb.TypeCode_BOOL}, structpb.NewStringValue("true"), nil, true},
+		{&sppb.Type{Code: sppb.TypeCode_STRING}, structpb.NewStringValue("foo"), "foo", false},
+		{&sppb.Type{Code: sppb.TypeCode_BYTES}, structpb.NewStringValue("Zm9v"), []byte("foo"), false},
+		{&sppb.Type{Code: sppb.TypeCode_BYTES}, structpb.NewNullValue(), []byte(nil), false},
+		{&sppb.Type{Code: sppb.TypeCode_BYTES}, structpb.NewStringValue("@@"), nil, true},
+		{&sppb.Type{Code: sppb.TypeCode_NUMERIC}, structpb.NewStringValue("3.14"), *big.NewRat(314, 100), false},
+		{&sppb.Type{Code: sppb.TypeCode_DATE}, structpb.NewStringValue("2021-07-21"), civil.Date{Year: 2021, Month: 7, Day: 21}, false},
+		{&sppb.Type{Code: sppb.TypeCode_DATE}, structpb.NewStringValue("2021-07-32"), nil, true},
+		{&sppb.Type{Code: sppb.TypeCode_TIMESTAMP}, structpb.NewStringValue("2021-07-21T21:07:59.3399118Z"), time.Date(2021, 7, 21, 21, 7, 59, 339911800, time.UTC), false},
+		{&sppb.Type{Code: sppb.TypeCode_JSON}, structpb.NewNullValue(), spanner.NullJSON{}, false},
+	} {
+		got, err := newColumnDecoder(test.typ, DecodeModeSpanner)(spanner.GenericColumnValue{Type: test.typ, Value: test.value})
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%d: missing expected error for %v", i, test.value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%d: failed to decode %v: %v", i, test.value, err)
+			continue
+		}
+		if !cmp.Equal(got, test.want, cmp.AllowUnexported(big.Rat{}, big.Int{})) {
+			t.Errorf("%d: value mismatch\nGot: %v\nWant: %v", i, got, test.want)
+		}
+	}
+	nan, err := decodeFloat64(spanner.GenericColumnValue{Type: &sppb.Type{Code: sppb.TypeCode_FLOAT64}, Value: structpb.NewStringValue("NaN")})
+	if err != nil {
+		t.Fatalf("failed to decode NaN: %v", err)
+	}
+	if !math.IsNaN(nan.(float64)) {
+		t.Fatalf("value mismatch\nGot: %v\nWant: NaN", nan)
+	}
+}
+
+var benchmarkColumns = []string{"Id", "Name", "Score", "Active", "Birthdate", "LastUpdated"}
+
+func createBenchmarkIterator(b *testing.B, rowCount int) *testIterator {
+	it := &testIterator{
+		metadata: &sppb.ResultSetMetadata{
+			RowType: &sppb.StructType{
+				Fields: []*sppb.StructType_Field{
+					{Name: "Id", Type: &sppb.Type{Code: sppb.TypeCode_INT64}},
+					{Name: "Name", Type: &sppb.Type{Code: sppb.TypeCode_STRING}},
+					{Name: "Score", Type: &sppb.Type{Code: sppb.TypeCode_FLOAT64}},
+					{Name: "Active", Type: &sppb.Type{Code: sppb.TypeCode_BOOL}},
+					{Name: "Birthdate", Type: &sppb.Type{Code: sppb.TypeCode_DATE}},
+					{Name: "LastUpdated", Type: &sppb.Type{Code: sppb.TypeCode_TIMESTAMP}},
+				},
+			},
+		},
+	}
+	for i := 0; i < rowCount; i++ {
+		it.rows = append(it.rows, newRow(b, benchmarkColumns, []interface{}{
+			int64(i) * 1000, fmt.Sprintf("Name %d", i), float64(i) * 1.5, i%2 == 0,
+			civil.Date{Year: 2000, Month: 1, Day: 1 + i%28}, time.Unix(int64(i), 0).UTC(),
+		}))
+	}
+	return it
+}
+
+// BenchmarkRowsNext measures the time and allocations that are needed to
+// decode rows through the driver.
+func BenchmarkRowsNext(b *testing.B) {
+	it := createBenchmarkIterator(b, 100)
+	dest := make([]driver.Value, len(benchmarkColumns))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		it.index = 0
+		r := &rows{it: it}
+		for {
+			if err := r.Next(dest); err == io.EOF {
+				break
+			} else if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// BenchmarkRowColumns measures the time and allocations that are needed to
+// decode the same rows directly with the Spanner client library.
+func BenchmarkRowColumns(b *testing.B) {
+	it := createBenchmarkIterator(b, 100)
+	var (
+		id          spanner.NullInt64
+		name        spanner.NullString
+		score       spanner.NullFloat64
+		active      spanner.NullBool
+		birthdate   spanner.NullDate
+		lastUpdated spanner.NullTime
+	)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		for _, row := range it.rows {
+			if err := row.Columns(&id, &name, &score, &active, &birthdate, &lastUpdated); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
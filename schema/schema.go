@@ -0,0 +1,515 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package schema reads the schema of a Cloud Spanner database from the
+// INFORMATION_SCHEMA of the database using the Cloud Spanner database/sql
+// driver. Both GoogleSQL and PostgreSQL-dialect databases are supported.
+//
+// Example:
+//
+//	db, err := sql.Open("spanner", "projects/my-project/instances/my-instance/databases/my-database")
+//	s, err := schema.Load(ctx, db)
+//	for _, table := range s.Tables {
+//		fmt.Printf("%s: %v\n", table.Name, table.PrimaryKey)
+//	}
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	_ "github.com/googleapis/go-sql-spanner"
+	databasepb "google.golang.org/genproto/googleapis/spanner/admin/database/v1"
+)
+
+// Schema is the schema of a Cloud Spanner database. System schemas like
+// INFORMATION_SCHEMA and SPANNER_SYS are not included.
+type Schema struct {
+	// Dialect is the SQL dialect of the database.
+	Dialect databasepb.DatabaseDialect
+	// Tables are the tables in the database ordered by schema and name.
+	Tables []*Table
+	// ChangeStreams are the change streams in the database ordered by schema
+	// and name.
+	ChangeStreams []*ChangeStream
+}
+
+// Table returns the table with the given name, or nil if the schema does not
+// contain a table with the given name. Tables that are not in the default
+// schema must be qualified with the name of their schema, e.g. `sch1.Singers`.
+func (s *Schema) Table(name string) *Table {
+	for _, table := range s.Tables {
+		if table.QualifiedName() == name {
+			return table
+		}
+	}
+	return nil
+}
+
+// Table describes a table in a Cloud Spanner database.
+type Table struct {
+	// Schema is the name of the schema of the table. It is empty for tables
+	// in the default schema of a GoogleSQL database, and `public` for tables
+	// in the default schema of a PostgreSQL database.
+	Schema string
+	// Name is the name of the table.
+	Name string
+	// Columns are the columns of the table in ordinal order.
+	Columns []*Column
+	// PrimaryKey contains the primary key columns of the table in key order.
+	PrimaryKey []*KeyColumn
+	// ParentTable is the name of the table that this table is interleaved
+	// in. It is empty if the table is not interleaved.
+	ParentTable string
+	// OnDeleteAction is the action that is taken for this table when a row in
+	// the parent table is deleted. It is either `CASCADE` or `NO ACTION`, and
+	// is empty if the table is not interleaved.
+	OnDeleteAction string
+	// Indexes are the secondary indexes on the table ordered by name.
+	Indexes []*Index
+	// ForeignKeys are the foreign keys that are defined on the table ordered
+	// by name.
+	ForeignKeys []*ForeignKey
+}
+
+// QualifiedName returns the name of the table qualified with the name of its
+// schema, unless the table is in the default schema.
+func (t *Table) QualifiedName() string {
+	return qualifiedName(t.Schema, t.Name)
+}
+
+// Column returns the column with the given name, or nil if the table does not
+// contain a column with the given name.
+func (t *Table) Column(name string) *Column {
+	for _, column := range t.Columns {
+		if column.Name == name {
+			return column
+		}
+	}
+	return nil
+}
+
+// Column describes a column of a table.
+type Column struct {
+	// Name is the name of the column.
+	Name string
+	// OrdinalPosition is the one-based position of the column in the table.
+	OrdinalPosition int64
+	// Type is the Spanner type of the column, e.g. `STRING(MAX)` for a
+	// GoogleSQL database and `character varying` for a PostgreSQL database.
+	Type string
+	// Nullable indicates whether the column can contain NULL values.
+	Nullable bool
+	// Default is the default value expression of the column. It is empty if
+	// the column does not have a default value.
+	Default string
+	// Generated indicates whether the column is a generated column.
+	Generated bool
+	// GenerationExpression is the expression of a generated column.
+	GenerationExpression string
+}
+
+// KeyColumn is a column in a primary key or in an index.
+type KeyColumn struct {
+	// Name is the name of the column.
+	Name string
+	// Descending indicates whether the column is sorted in descending order.
+	Descending bool
+}
+
+// Index describes a secondary index on a table.
+type Index struct {
+	// Name is the name of the index.
+	Name string
+	// Unique indicates whether the index is a unique index.
+	Unique bool
+	// NullFiltered indicates whether rows that contain a NULL value in one of
+	// the index columns are excluded from the index.
+	NullFiltered bool
+	// ParentTable is the name of the table that the index is interleaved in.
+	// It is empty if the index is not interleaved.
+	ParentTable string
+	// Columns are the key columns of the index in key order.
+	Columns []*KeyColumn
+	// Storing are the names of the non-key columns that are stored in the
+	// index.
+	Storing []string
+}
+
+// ForeignKey describes a foreign key constraint on a table.
+type ForeignKey struct {
+	// Name is the name of the foreign key constraint.
+	Name string
+	// Columns are the names of the referencing columns in the table.
+	Columns []string
+	// ReferencedTable is the name of the referenced table. It is qualified
+	// with the name of its schema, unless it is in the default schema.
+	ReferencedTable string
+	// ReferencedColumns are the names of the referenced columns in the same
+	// order as Columns.
+	ReferencedColumns []string
+	// OnDelete is the action that is taken when a referenced row is deleted.
+	// It is either `CASCADE` or `NO ACTION`.
+	OnDelete string
+}
+
+// ChangeStream describes a change stream in a Cloud Spanner database.
+type ChangeStream struct {
+	// Schema is the name of the schema of the change stream.
+	Schema string
+	// Name is the name of the change stream.
+	Name string
+	// All indicates whether the change stream watches all tables in the
+	// database. Tables is empty if All is true.
+	All bool
+	// Tables are the tables that are watched by the change stream ordered by
+	// name.
+	Tables []*ChangeStreamTable
+}
+
+// ChangeStreamTable is a table that is watched by a change stream.
+type ChangeStreamTable struct {
+	// Name is the name of the table.
+	Name string
+	// AllColumns indicates whether the change stream watches all columns of
+	// the table. Columns is empty if AllColumns is true.
+	AllColumns bool
+	// Columns are the names of the columns that are watched by the change
+	// stream.
+	Columns []string
+}
+
+const (
+	dialectQuery = `SELECT OPTION_VALUE FROM INFORMATION_SCHEMA.DATABASE_OPTIONS WHERE OPTION_NAME='database_dialect'`
+	tablesQuery  = `SELECT TABLE_SCHEMA, TABLE_NAME, PARENT_TABLE_NAME, ON_DELETE_ACTION
+FROM INFORMATION_SCHEMA.TABLES
+WHERE TABLE_TYPE='BASE TABLE'
+ORDER BY TABLE_SCHEMA, TABLE_NAME`
+	columnsQuery = `SELECT TABLE_SCHEMA, TABLE_NAME, COLUMN_NAME, ORDINAL_POSITION, SPANNER_TYPE, IS_NULLABLE, COLUMN_DEFAULT, IS_GENERATED, GENERATION_EXPRESSION
+FROM INFORMATION_SCHEMA.COLUMNS
+ORDER BY TABLE_SCHEMA, TABLE_NAME, ORDINAL_POSITION`
+	indexesQuery = `SELECT TABLE_SCHEMA, TABLE_NAME, INDEX_NAME, PARENT_TABLE_NAME, IS_UNIQUE, IS_NULL_FILTERED
+FROM INFORMATION_SCHEMA.INDEXES
+WHERE INDEX_TYPE='INDEX' AND SPANNER_IS_MANAGED=%s
+ORDER BY TABLE_SCHEMA, TABLE_NAME, INDEX_NAME`
+	indexColumnsQuery = `SELECT TABLE_SCHEMA, TABLE_NAME, INDEX_NAME, INDEX_TYPE, COLUMN_NAME, ORDINAL_POSITION, COLUMN_ORDERING
+FROM INFORMATION_SCHEMA.INDEX_COLUMNS
+ORDER BY TABLE_SCHEMA, TABLE_NAME, INDEX_NAME, ORDINAL_POSITION, COLUMN_NAME`
+	foreignKeysQuery = `SELECT KCU.TABLE_SCHEMA, KCU.TABLE_NAME, KCU.CONSTRAINT_NAME, KCU.COLUMN_NAME, REF.TABLE_SCHEMA, REF.TABLE_NAME, REF.COLUMN_NAME, RC.DELETE_RULE
+FROM INFORMATION_SCHEMA.REFERENTIAL_CONSTRAINTS RC
+INNER JOIN INFORMATION_SCHEMA.KEY_COLUMN_USAGE KCU
+  ON KCU.CONSTRAINT_SCHEMA=RC.CONSTRAINT_SCHEMA AND KCU.CONSTRAINT_NAME=RC.CONSTRAINT_NAME
+INNER JOIN INFORMATION_SCHEMA.KEY_COLUMN_USAGE REF
+  ON REF.CONSTRAINT_SCHEMA=RC.UNIQUE_CONSTRAINT_SCHEMA AND REF.CONSTRAINT_NAME=RC.UNIQUE_CONSTRAINT_NAME
+  AND REF.ORDINAL_POSITION=KCU.POSITION_IN_UNIQUE_CONSTRAINT
+ORDER BY KCU.TABLE_SCHEMA, KCU.TABLE_NAME, KCU.CONSTRAINT_NAME, KCU.ORDINAL_POSITION`
+	// ALL is a reserved keyword in both dialects, but the quote character is
+	// different for each dialect.
+	changeStreamsQuery = `SELECT CHANGE_STREAM_SCHEMA, CHANGE_STREAM_NAME, %s
+FROM INFORMATION_SCHEMA.CHANGE_STREAMS
+ORDER BY CHANGE_STREAM_SCHEMA, CHANGE_STREAM_NAME`
+	changeStreamTablesQuery = `SELECT CHANGE_STREAM_SCHEMA, CHANGE_STREAM_NAME, TABLE_SCHEMA, TABLE_NAME, ALL_COLUMNS
+FROM INFORMATION_SCHEMA.CHANGE_STREAM_TABLES
+ORDER BY CHANGE_STREAM_SCHEMA, CHANGE_STREAM_NAME, TABLE_SCHEMA, TABLE_NAME`
+	changeStreamColumnsQuery = `SELECT CHANGE_STREAM_SCHEMA, CHANGE_STREAM_NAME, TABLE_SCHEMA, TABLE_NAME, COLUMN_NAME
+FROM INFORMATION_SCHEMA.CHANGE_STREAM_COLUMNS
+ORDER BY CHANGE_STREAM_SCHEMA, CHANGE_STREAM_NAME, TABLE_SCHEMA, TABLE_NAME, COLUMN_NAME`
+)
+
+// Load reads the schema of the given database. All queries are executed in
+// one read-only transaction, so the returned schema is a consistent snapshot
+// of the database schema.
+func Load(ctx context.Context, db *sql.DB) (*Schema, error) {
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	// The transaction is read-only, so there is nothing to commit.
+	defer tx.Rollback()
+
+	l := &loader{tx: tx, tables: make(map[string]*Table), changeStreams: make(map[string]*ChangeStream)}
+	if err := l.loadDialect(ctx); err != nil {
+		return nil, err
+	}
+	for _, load := range []func(context.Context) error{
+		l.loadTables,
+		l.loadColumns,
+		l.loadIndexes,
+		l.loadIndexColumns,
+		l.loadForeignKeys,
+		l.loadChangeStreams,
+		l.loadChangeStreamTables,
+		l.loadChangeStreamColumns,
+	} {
+		if err := load(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return l.schema, nil
+}
+
+// loader reads the different parts of a schema and assembles them into one
+// Schema.
+type loader struct {
+	tx            *sql.Tx
+	schema        *Schema
+	tables        map[string]*Table
+	indexes       map[string]*Index
+	changeStreams map[string]*ChangeStream
+}
+
+func (l *loader) loadDialect(ctx context.Context) error {
+	var dialect string
+	if err := l.tx.QueryRowContext(ctx, dialectQuery).Scan(&dialect); err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("failed to read database dialect: %w", err)
+	}
+	l.schema = &Schema{Dialect: databasepb.DatabaseDialect_GOOGLE_STANDARD_SQL}
+	if value, ok := databasepb.DatabaseDialect_value[strings.ToUpper(dialect)]; ok {
+		l.schema.Dialect = databasepb.DatabaseDialect(value)
+	}
+	return nil
+}
+
+func (l *loader) isPostgreSQL() bool {
+	return l.schema.Dialect == databasepb.DatabaseDialect_POSTGRESQL
+}
+
+// query executes the given query and calls f for each row. Rows that belong
+// to a system schema are skipped.
+func (l *loader) query(ctx context.Context, name, query string, dest []interface{}, f func() error) error {
+	rows, err := l.tx.QueryContext(ctx, query)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		// The schema is always the first column.
+		if isSystemSchema(*dest[0].(*string)) {
+			continue
+		}
+		if err := f(); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	return nil
+}
+
+func (l *loader) loadTables(ctx context.Context) error {
+	var schema, name string
+	var parent, onDelete sql.NullString
+	return l.query(ctx, "tables", tablesQuery, []interface{}{&schema, &name, &parent, &onDelete}, func() error {
+		table := &Table{Schema: schema, Name: name, ParentTable: parent.String}
+		if table.ParentTable != "" {
+			table.OnDeleteAction = onDelete.String
+		}
+		l.schema.Tables = append(l.schema.Tables, table)
+		l.tables[qualifiedName(schema, name)] = table
+		return nil
+	})
+}
+
+func (l *loader) loadColumns(ctx context.Context) error {
+	var schema, table, name, spannerType, nullable, generated string
+	var position int64
+	var def, expression sql.NullString
+	dest := []interface{}{&schema, &table, &name, &position, &spannerType, &nullable, &def, &generated, &expression}
+	return l.query(ctx, "columns", columnsQuery, dest, func() error {
+		// INFORMATION_SCHEMA.COLUMNS also contains the columns of views.
+		t, ok := l.tables[qualifiedName(schema, table)]
+		if !ok {
+			return nil
+		}
+		t.Columns = append(t.Columns, &Column{
+			Name:                 name,
+			OrdinalPosition:      position,
+			Type:                 spannerType,
+			Nullable:             toBool(nullable),
+			Default:              def.String,
+			Generated:            strings.EqualFold(generated, "ALWAYS"),
+			GenerationExpression: expression.String,
+		})
+		return nil
+	})
+}
+
+func (l *loader) loadIndexes(ctx context.Context) error {
+	// The indexes that back foreign keys are managed by Spanner.
+	managed := "FALSE"
+	if l.isPostgreSQL() {
+		managed = "'NO'"
+	}
+	l.indexes = make(map[string]*Index)
+	var schema, table, name string
+	var parent sql.NullString
+	var unique, nullFiltered interface{}
+	dest := []interface{}{&schema, &table, &name, &parent, &unique, &nullFiltered}
+	return l.query(ctx, "indexes", fmt.Sprintf(indexesQuery, managed), dest, func() error {
+		t, ok := l.tables[qualifiedName(schema, table)]
+		if !ok {
+			return nil
+		}
+		index := &Index{
+			Name:         name,
+			Unique:       toBool(unique),
+			NullFiltered: toBool(nullFiltered),
+			ParentTable:  parent.String,
+		}
+		t.Indexes = append(t.Indexes, index)
+		l.indexes[qualifiedName(schema, table)+"."+name] = index
+		return nil
+	})
+}
+
+func (l *loader) loadIndexColumns(ctx context.Context) error {
+	var schema, table, index, indexType, column string
+	var position sql.NullInt64
+	var ordering sql.NullString
+	dest := []interface{}{&schema, &table, &index, &indexType, &column, &position, &ordering}
+	return l.query(ctx, "index columns", indexColumnsQuery, dest, func() error {
+		if indexType == "PRIMARY_KEY" {
+			if t, ok := l.tables[qualifiedName(schema, table)]; ok {
+				t.PrimaryKey = append(t.PrimaryKey, &KeyColumn{Name: column, Descending: isDescending(ordering)})
+			}
+			return nil
+		}
+		i, ok := l.indexes[qualifiedName(schema, table)+"."+index]
+		if !ok {
+			return nil
+		}
+		// Stored columns do not have an ordinal position in the index.
+		if !position.Valid {
+			i.Storing = append(i.Storing, column)
+		} else {
+			i.Columns = append(i.Columns, &KeyColumn{Name: column, Descending: isDescending(ordering)})
+		}
+		return nil
+	})
+}
+
+func (l *loader) loadForeignKeys(ctx context.Context) error {
+	var schema, table, name, column, refSchema, refTable, refColumn string
+	var onDelete sql.NullString
+	dest := []interface{}{&schema, &table, &name, &column, &refSchema, &refTable, &refColumn, &onDelete}
+	return l.query(ctx, "foreign keys", foreignKeysQuery, dest, func() error {
+		t, ok := l.tables[qualifiedName(schema, table)]
+		if !ok {
+			return nil
+		}
+		var fk *ForeignKey
+		if n := len(t.ForeignKeys); n > 0 && t.ForeignKeys[n-1].Name == name {
+			fk = t.ForeignKeys[n-1]
+		} else {
+			fk = &ForeignKey{Name: name, ReferencedTable: qualifiedName(refSchema, refTable), OnDelete: onDelete.String}
+			t.ForeignKeys = append(t.ForeignKeys, fk)
+		}
+		fk.Columns = append(fk.Columns, column)
+		fk.ReferencedColumns = append(fk.ReferencedColumns, refColumn)
+		return nil
+	})
+}
+
+func (l *loader) loadChangeStreams(ctx context.Context) error {
+	all := "`ALL`"
+	if l.isPostgreSQL() {
+		all = `"all"`
+	}
+	var schema, name string
+	var allTables interface{}
+	dest := []interface{}{&schema, &name, &allTables}
+	return l.query(ctx, "change streams", fmt.Sprintf(changeStreamsQuery, all), dest, func() error {
+		changeStream := &ChangeStream{Schema: schema, Name: name, All: toBool(allTables)}
+		l.schema.ChangeStreams = append(l.schema.ChangeStreams, changeStream)
+		l.changeStreams[qualifiedName(schema, name)] = changeStream
+		return nil
+	})
+}
+
+func (l *loader) loadChangeStreamTables(ctx context.Context) error {
+	var schema, name, tableSchema, table string
+	var allColumns interface{}
+	dest := []interface{}{&schema, &name, &tableSchema, &table, &allColumns}
+	return l.query(ctx, "change stream tables", changeStreamTablesQuery, dest, func() error {
+		if changeStream, ok := l.changeStreams[qualifiedName(schema, name)]; ok {
+			changeStream.Tables = append(changeStream.Tables, &ChangeStreamTable{
+				Name:       qualifiedName(tableSchema, table),
+				AllColumns: toBool(allColumns),
+			})
+		}
+		return nil
+	})
+}
+
+func (l *loader) loadChangeStreamColumns(ctx context.Context) error {
+	var schema, name, tableSchema, table, column string
+	dest := []interface{}{&schema, &name, &tableSchema, &table, &column}
+	return l.query(ctx, "change stream columns", changeStreamColumnsQuery, dest, func() error {
+		changeStream, ok := l.changeStreams[qualifiedName(schema, name)]
+		if !ok {
+			return nil
+		}
+		for _, t := range changeStream.Tables {
+			if t.Name == qualifiedName(tableSchema, table) {
+				t.Columns = append(t.Columns, column)
+			}
+		}
+		return nil
+	})
+}
+
+// isSystemSchema returns true if the given schema is one of the system schemas
+// of a GoogleSQL or PostgreSQL database.
+func isSystemSchema(schema string) bool {
+	switch strings.ToUpper(schema) {
+	case "INFORMATION_SCHEMA", "SPANNER_SYS", "PG_CATALOG":
+		return true
+	}
+	return false
+}
+
+// qualifiedName returns the given name qualified with the given schema, unless
+// the schema is the default schema.
+func qualifiedName(schema, name string) string {
+	if schema == "" || schema == "public" {
+		return name
+	}
+	return schema + "." + name
+}
+
+// toBool converts a boolean INFORMATION_SCHEMA value to a bool. GoogleSQL
+// databases return BOOL values for most of these columns, while PostgreSQL
+// databases and a couple of GoogleSQL columns, like IS_NULLABLE, return 'YES'
+// or 'NO'.
+func toBool(v interface{}) bool {
+	switch b := v.(type) {
+	case bool:
+		return b
+	case string:
+		return strings.EqualFold(b, "YES") || strings.EqualFold(b, "TRUE")
+	case []byte:
+		return strings.EqualFold(string(b), "YES") || strings.EqualFold(string(b), "TRUE")
+	}
+	return false
+}
+
+func isDescending(ordering sql.NullString) bool {
+	return strings.EqualFold(ordering.String, "DESC")
+}
@@ -0,0 +1,307 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/googleapis/go-sql-spanner/testutil"
+	databasepb "google.golang.org/genproto/googleapis/spanner/admin/database/v1"
+	sppb "google.golang.org/genproto/googleapis/spanner/v1"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestLoad(t *testing.T) {
+	ctx := context.Background()
+	db, server, teardown := setupTestDB(t)
+	defer teardown()
+
+	putResults(t, server, map[string]*sppb.ResultSet{
+		dialectQuery: resultSet([]string{"OPTION_VALUE"}, [][]interface{}{{"GOOGLE_STANDARD_SQL"}}),
+		tablesQuery: resultSet([]string{"TABLE_SCHEMA", "TABLE_NAME", "PARENT_TABLE_NAME", "ON_DELETE_ACTION"}, [][]interface{}{
+			{"", "Albums", "Singers", "CASCADE"},
+			{"", "Singers", nil, nil},
+			{"INFORMATION_SCHEMA", "TABLES", nil, nil},
+		}),
+		columnsQuery: resultSet([]string{"TABLE_SCHEMA", "TABLE_NAME", "COLUMN_NAME", "ORDINAL_POSITION", "SPANNER_TYPE", "IS_NULLABLE", "COLUMN_DEFAULT", "IS_GENERATED", "GENERATION_EXPRESSION"}, [][]interface{}{
+			{"", "Albums", "SingerId", int64(1), "INT64", "NO", nil, "NEVER", nil},
+			{"", "Albums", "AlbumId", int64(2), "INT64", "NO", nil, "NEVER", nil},
+			{"", "Albums", "Title", int64(3), "STRING(MAX)", "YES", "'Untitled'", "NEVER", nil},
+			{"", "Singers", "SingerId", int64(1), "INT64", "NO", nil, "NEVER", nil},
+			{"", "Singers", "FirstName", int64(2), "STRING(200)", "YES", nil, "NEVER", nil},
+			{"", "Singers", "LastName", int64(3), "STRING(200)", "YES", nil, "NEVER", nil},
+			{"", "Singers", "FullName", int64(4), "STRING(400)", "YES", nil, "ALWAYS", "CONCAT(FirstName, ' ', LastName)"},
+			{"INFORMATION_SCHEMA", "TABLES", "TABLE_NAME", int64(1), "STRING(MAX)", "NO", nil, "NEVER", nil},
+		}),
+		fmt.Sprintf(indexesQuery, "FALSE"): resultSet([]string{"TABLE_SCHEMA", "TABLE_NAME", "INDEX_NAME", "PARENT_TABLE_NAME", "IS_UNIQUE", "IS_NULL_FILTERED"}, [][]interface{}{
+			{"", "Albums", "Idx_Albums_Title", "Singers", true, false},
+			{"", "Singers", "Idx_Singers_LastName", "", false, true},
+		}),
+		indexColumnsQuery: resultSet([]string{"TABLE_SCHEMA", "TABLE_NAME", "INDEX_NAME", "INDEX_TYPE", "COLUMN_NAME", "ORDINAL_POSITION", "COLUMN_ORDERING"}, [][]interface{}{
+			{"", "Albums", "Idx_Albums_Title", "INDEX", "SingerId", int64(1), "ASC"},
+			{"", "Albums", "Idx_Albums_Title", "INDEX", "Title", int64(2), "DESC"},
+			{"", "Albums", "PRIMARY_KEY", "PRIMARY_KEY", "SingerId", int64(1), "ASC"},
+			{"", "Albums", "PRIMARY_KEY", "PRIMARY_KEY", "AlbumId", int64(2), "DESC"},
+			{"", "Singers", "Idx_Singers_LastName", "INDEX", "FirstName", nil, nil},
+			{"", "Singers", "Idx_Singers_LastName", "INDEX", "LastName", int64(1), "ASC"},
+			{"", "Singers", "PRIMARY_KEY", "PRIMARY_KEY", "SingerId", int64(1), "ASC"},
+		}),
+		foreignKeysQuery: resultSet([]string{"TABLE_SCHEMA", "TABLE_NAME", "CONSTRAINT_NAME", "COLUMN_NAME", "TABLE_SCHEMA", "TABLE_NAME", "COLUMN_NAME", "DELETE_RULE"}, [][]interface{}{
+			{"", "Albums", "FK_Albums_Singers", "SingerId", "", "Singers", "SingerId", "NO ACTION"},
+		}),
+		fmt.Sprintf(changeStreamsQuery, "`ALL`"): resultSet([]string{"CHANGE_STREAM_SCHEMA", "CHANGE_STREAM_NAME", "ALL"}, [][]interface{}{
+			{"", "AllChanges", true},
+			{"", "SingerChanges", false},
+		}),
+		changeStreamTablesQuery: resultSet([]string{"CHANGE_STREAM_SCHEMA", "CHANGE_STREAM_NAME", "TABLE_SCHEMA", "TABLE_NAME", "ALL_COLUMNS"}, [][]interface{}{
+			{"", "SingerChanges", "", "Albums", true},
+			{"", "SingerChanges", "", "Singers", false},
+		}),
+		changeStreamColumnsQuery: resultSet([]string{"CHANGE_STREAM_SCHEMA", "CHANGE_STREAM_NAME", "TABLE_SCHEMA", "TABLE_NAME", "COLUMN_NAME"}, [][]interface{}{
+			{"", "SingerChanges", "", "Singers", "FirstName"},
+			{"", "SingerChanges", "", "Singers", "LastName"},
+		}),
+	})
+
+	s, err := Load(ctx, db)
+	if err != nil {
+		t.Fatalf("failed to load schema: %v", err)
+	}
+	want := &Schema{
+		Dialect: databasepb.DatabaseDialect_GOOGLE_STANDARD_SQL,
+		Tables: []*Table{
+			{
+				Name: "Albums",
+				Columns: []*Column{
+					{Name: "SingerId", OrdinalPosition: 1, Type: "INT64"},
+					{Name: "AlbumId", OrdinalPosition: 2, Type: "INT64"},
+					{Name: "Title", OrdinalPosition: 3, Type: "STRING(MAX)", Nullable: true, Default: "'Untitled'"},
+				},
+				PrimaryKey:     []*KeyColumn{{Name: "SingerId"}, {Name: "AlbumId", Descending: true}},
+				ParentTable:    "Singers",
+				OnDeleteAction: "CASCADE",
+				Indexes: []*Index{
+					{
+						Name:        "Idx_Albums_Title",
+						Unique:      true,
+						ParentTable: "Singers",
+						Columns:     []*KeyColumn{{Name: "SingerId"}, {Name: "Title", Descending: true}},
+					},
+				},
+				ForeignKeys: []*ForeignKey{
+					{
+						Name:              "FK_Albums_Singers",
+						Columns:           []string{"SingerId"},
+						ReferencedTable:   "Singers",
+						ReferencedColumns: []string{"SingerId"},
+						OnDelete:          "NO ACTION",
+					},
+				},
+			},
+			{
+				Name: "Singers",
+				Columns: []*Column{
+					{Name: "SingerId", OrdinalPosition: 1, Type: "INT64"},
+					{Name: "FirstName", OrdinalPosition: 2, Type: "STRING(200)", Nullable: true},
+					{Name: "LastName", OrdinalPosition: 3, Type: "STRING(200)", Nullable: true},
+					{Name: "FullName", OrdinalPosition: 4, Type: "STRING(400)", Nullable: true, Generated: true, GenerationExpression: "CONCAT(FirstName, ' ', LastName)"},
+				},
+				PrimaryKey: []*KeyColumn{{Name: "SingerId"}},
+				Indexes: []*Index{
+					{
+						Name:         "Idx_Singers_LastName",
+						NullFiltered: true,
+						Columns:      []*KeyColumn{{Name: "LastName"}},
+						Storing:      []string{"FirstName"},
+					},
+				},
+			},
+		},
+		ChangeStreams: []*ChangeStream{
+			{Name: "AllChanges", All: true},
+			{
+				Name: "SingerChanges",
+				Tables: []*ChangeStreamTable{
+					{Name: "Albums", AllColumns: true},
+					{Name: "Singers", Columns: []string{"FirstName", "LastName"}},
+				},
+			},
+		},
+	}
+	if diff := cmp.Diff(want, s); diff != "" {
+		t.Fatalf("schema mismatch (-want +got):\n%s", diff)
+	}
+	if g, w := s.Table("Singers").Column("FullName").Generated, true; g != w {
+		t.Fatalf("generated mismatch\nGot: %v\nWant: %v", g, w)
+	}
+	if s.Table("TABLES") != nil {
+		t.Fatal("unexpected system table in schema")
+	}
+}
+
+func TestLoad_PostgreSQL(t *testing.T) {
+	ctx := context.Background()
+	db, server, teardown := setupTestDB(t)
+	defer teardown()
+
+	putResults(t, server, map[string]*sppb.ResultSet{
+		dialectQuery: resultSet([]string{"option_value"}, [][]interface{}{{"POSTGRESQL"}}),
+		tablesQuery: resultSet([]string{"table_schema", "table_name", "parent_table_name", "on_delete_action"}, [][]interface{}{
+			{"public", "singers", nil, nil},
+			{"sch1", "singers", nil, nil},
+			{"pg_catalog", "pg_type", nil, nil},
+		}),
+		columnsQuery: resultSet([]string{"table_schema", "table_name", "column_name", "ordinal_position", "spanner_type", "is_nullable", "column_default", "is_generated", "generation_expression"}, [][]interface{}{
+			{"public", "singers", "id", int64(1), "bigint", "NO", nil, "NEVER", nil},
+			{"public", "singers", "name", int64(2), "character varying", "YES", nil, "NEVER", nil},
+			{"sch1", "singers", "id", int64(1), "bigint", "NO", nil, "NEVER", nil},
+		}),
+		fmt.Sprintf(indexesQuery, "'NO'"): resultSet([]string{"table_schema", "table_name", "index_name", "parent_table_name", "is_unique", "is_null_filtered"}, [][]interface{}{
+			{"public", "singers", "idx_singers_name", nil, "YES", "NO"},
+		}),
+		indexColumnsQuery: resultSet([]string{"table_schema", "table_name", "index_name", "index_type", "column_name", "ordinal_position", "column_ordering"}, [][]interface{}{
+			{"public", "singers", "PRIMARY_KEY", "PRIMARY_KEY", "id", int64(1), "ASC"},
+			{"public", "singers", "idx_singers_name", "INDEX", "name", int64(1), "ASC"},
+			{"sch1", "singers", "PRIMARY_KEY", "PRIMARY_KEY", "id", int64(1), "ASC"},
+		}),
+		foreignKeysQuery: resultSet([]string{"table_schema", "table_name", "constraint_name", "column_name", "table_schema", "table_name", "column_name", "delete_rule"}, [][]interface{}{
+			{"sch1", "singers", "fk_singers", "id", "public", "singers", "id", "CASCADE"},
+		}),
+		fmt.Sprintf(changeStreamsQuery, `"all"`): resultSet([]string{"change_stream_schema", "change_stream_name", "all"}, [][]interface{}{
+			{"public", "singer_changes", "NO"},
+		}),
+		changeStreamTablesQuery: resultSet([]string{"change_stream_schema", "change_stream_name", "table_schema", "table_name", "all_columns"}, [][]interface{}{
+			{"public", "singer_changes", "sch1", "singers", "YES"},
+		}),
+		changeStreamColumnsQuery: resultSet([]string{"change_stream_schema", "change_stream_name", "table_schema", "table_name", "column_name"}, nil),
+	})
+
+	s, err := Load(ctx, db)
+	if err != nil {
+		t.Fatalf("failed to load schema: %v", err)
+	}
+	want := &Schema{
+		Dialect: databasepb.DatabaseDialect_POSTGRESQL,
+		Tables: []*Table{
+			{
+				Schema: "public",
+				Name:   "singers",
+				Columns: []*Column{
+					{Name: "id", OrdinalPosition: 1, Type: "bigint"},
+					{Name: "name", OrdinalPosition: 2, Type: "character varying", Nullable: true},
+				},
+				PrimaryKey: []*KeyColumn{{Name: "id"}},
+				Indexes: []*Index{
+					{Name: "idx_singers_name", Unique: true, Columns: []*KeyColumn{{Name: "name"}}},
+				},
+			},
+			{
+				Schema: "sch1",
+				Name:   "singers",
+				Columns: []*Column{
+					{Name: "id", OrdinalPosition: 1, Type: "bigint"},
+				},
+				PrimaryKey: []*KeyColumn{{Name: "id"}},
+				ForeignKeys: []*ForeignKey{
+					{
+						Name:              "fk_singers",
+						Columns:           []string{"id"},
+						ReferencedTable:   "singers",
+						ReferencedColumns: []string{"id"},
+						OnDelete:          "CASCADE",
+					},
+				},
+			},
+		},
+		ChangeStreams: []*ChangeStream{
+			{
+				Schema: "public",
+				Name:   "singer_changes",
+				Tables: []*ChangeStreamTable{{Name: "sch1.singers", AllColumns: true}},
+			},
+		},
+	}
+	if diff := cmp.Diff(want, s); diff != "" {
+		t.Fatalf("schema mismatch (-want +got):\n%s", diff)
+	}
+	if g, w := s.Table("sch1.singers").QualifiedName(), "sch1.singers"; g != w {
+		t.Fatalf("qualified name mismatch\nGot: %v\nWant: %v", g, w)
+	}
+}
+
+func setupTestDB(t *testing.T) (*sql.DB, *testutil.MockedSpannerInMemTestServer, func()) {
+	server, _, serverTeardown := testutil.NewMockedSpannerInMemTestServer(t)
+	db, err := sql.Open("spanner", fmt.Sprintf("%s/projects/p/instances/i/databases/d?useplaintext=true", server.Address))
+	if err != nil {
+		serverTeardown()
+		t.Fatal(err)
+	}
+	return db, server, func() {
+		_ = db.Close()
+		serverTeardown()
+	}
+}
+
+func putResults(t *testing.T, server *testutil.MockedSpannerInMemTestServer, results map[string]*sppb.ResultSet) {
+	for query, resultSet := range results {
+		if err := server.TestSpanner.PutStatementResult(query, &testutil.StatementResult{
+			Type:      testutil.StatementResultResultSet,
+			ResultSet: resultSet,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// resultSet creates a result set with the given columns and rows. The type of
+// each column is derived from the first non-null value in the column.
+func resultSet(columns []string, rows [][]interface{}) *sppb.ResultSet {
+	fields := make([]*sppb.StructType_Field, len(columns))
+	for i, column := range columns {
+		code := sppb.TypeCode_STRING
+		for _, row := range rows {
+			switch row[i].(type) {
+			case int64:
+				code = sppb.TypeCode_INT64
+			case bool:
+				code = sppb.TypeCode_BOOL
+			}
+			if row[i] != nil {
+				break
+			}
+		}
+		fields[i] = &sppb.StructType_Field{Name: column, Type: &sppb.Type{Code: code}}
+	}
+	res := &sppb.ResultSet{Metadata: &sppb.ResultSetMetadata{RowType: &sppb.StructType{Fields: fields}}}
+	for _, row := range rows {
+		values := make([]*structpb.Value, len(row))
+		for i, v := range row {
+			switch v := v.(type) {
+			case nil:
+				values[i] = structpb.NewNullValue()
+			case bool:
+				values[i] = structpb.NewBoolValue(v)
+			default:
+				values[i] = structpb.NewStringValue(fmt.Sprint(v))
+			}
+		}
+		res.Rows = append(res.Rows, &structpb.ListValue{Values: values})
+	}
+	return res
+}
@@ -0,0 +1,164 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"cloud.google.com/go/spanner"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ScriptError is returned by ExecScript if one of the statements in a script
+// fails. Index is the zero-based index of the failed statement in the script.
+type ScriptError struct {
+	Index     int
+	Statement string
+	Err       error
+}
+
+func (e *ScriptError) Error() string {
+	return fmt.Sprintf("statement %d failed: %v\n%s", e.Index+1, e.Err, e.Statement)
+}
+
+func (e *ScriptError) Unwrap() error {
+	return e.Err
+}
+
+// ExecScript executes all statements in the given sql script on a connection
+// of the given database. See SpannerConn.ExecScript for more information.
+//
+// Example:
+//
+//	err := spannerdriver.ExecScript(ctx, db, `
+//		CREATE TABLE Singers (SingerId INT64, Name STRING(MAX)) PRIMARY KEY (SingerId);
+//		CREATE INDEX Idx_Singers_Name ON Singers (Name);
+//		INSERT INTO Singers (SingerId, Name) VALUES (1, 'Singer 1');
+//		INSERT INTO Singers (SingerId, Name) VALUES (2, 'Singer 2');
+//	`)
+func ExecScript(ctx context.Context, db *sql.DB, script string) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Raw(func(driverConn interface{}) error {
+		spannerConn, ok := driverConn.(SpannerConn)
+		if !ok {
+			return spanner.ToSpannerError(status.Errorf(codes.InvalidArgument, "unexpected driver connection %v, expected SpannerConn", driverConn))
+		}
+		return spannerConn.ExecScript(ctx, script)
+	})
+}
+
+func (c *conn) ExecScript(ctx context.Context, script string) error {
+	if c.batch != nil {
+		return spanner.ToSpannerError(status.Errorf(codes.FailedPrecondition, "This connection has an active batch. Scripts cannot be executed in a batch."))
+	}
+	sqls, err := splitStatements(script)
+	if err != nil {
+		return err
+	}
+	statements := make([]*parsedStatement, len(sqls))
+	for i, sql := range sqls {
+		if statements[i], err = parseStatement(c, sql); err != nil {
+			return &ScriptError{Index: i, Statement: sql, Err: err}
+		}
+	}
+	for start := 0; start < len(statements); {
+		end := start + 1
+		if isScriptBatchStatement(c, statements[start]) {
+			for end < len(statements) && statements[end].statementType == statements[start].statementType {
+				end++
+			}
+		}
+		var n int
+		switch {
+		case end-start > 1 && statements[start].statementType == statementTypeDdl:
+			n, err = c.execScriptDDL(ctx, statements[start:end])
+		case end-start > 1 && statements[start].statementType == statementTypeDml:
+			n, err = c.execScriptDML(ctx, statements[start:end])
+		default:
+			_, err = c.execStatement(ctx, statements[start], nil)
+		}
+		if err != nil {
+			return &ScriptError{Index: start + n, Statement: statements[start+n].query, Err: err}
+		}
+		start = end
+	}
+	return nil
+}
+
+// isScriptBatchStatement returns true if the given statement can be batched
+// together with subsequent statements of the same type in a script. DML
+// statements are only batched if they would be executed as transactional DML.
+func isScriptBatchStatement(c *conn, statement *parsedStatement) bool {
+	switch statement.statementType {
+	case statementTypeDdl:
+		return true
+	case statementTypeDml:
+		return c.tx != nil || c.autocommitDMLMode == Transactional
+	}
+	return false
+}
+
+// execScriptDDL executes the given DDL statements as one batch. It returns the
+// number of statements that were executed successfully if the batch fails.
+func (c *conn) execScriptDDL(ctx context.Context, statements []*parsedStatement) (int, error) {
+	if c.inTransaction() {
+		return 0, spanner.ToSpannerError(status.Errorf(codes.FailedPrecondition, "cannot execute DDL as part of a transaction"))
+	}
+	c.commitTs = nil
+	ddl := make([]string, len(statements))
+	for i, statement := range statements {
+		ddl[i] = statement.query
+	}
+	stmtCtx, cancel := c.statementContext(ctx)
+	defer cancel()
+	if executed, err := c.execDDLBatch(stmtCtx, ddl); err != nil {
+		return executed, statementTimeoutErr(ctx, stmtCtx, err)
+	}
+	return 0, nil
+}
+
+// execScriptDML executes the given DML statements as one batch. It returns the
+// number of statements that were executed successfully if the batch fails.
+// The commit timestamp of the connection is set to the commit timestamp of
+// the batch if the batch is not executed in a transaction.
+func (c *conn) execScriptDML(ctx context.Context, statements []*parsedStatement) (int, error) {
+	c.commitTs = nil
+	dml := make([]spanner.Statement, len(statements))
+	for i, statement := range statements {
+		ss, err := prepareSpannerStmt(statement, nil)
+		if err != nil {
+			return i, err
+		}
+		dml[i] = ss
+	}
+	stmtCtx, cancel := c.statementContext(ctx)
+	defer cancel()
+	affected, err := c.batchUpdate(stmtCtx, dml)
+	if err != nil {
+		executed := len(affected)
+		if executed >= len(statements) {
+			executed = len(statements) - 1
+		}
+		return executed, statementTimeoutErr(ctx, stmtCtx, err)
+	}
+	return 0, nil
+}
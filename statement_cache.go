@@ -0,0 +1,131 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+)
+
+// defaultStatementCacheSize is the maximum number of sql strings in the
+// statement cache that is shared by all connections.
+const defaultStatementCacheSize = 1000
+
+// statementsCache is the statement cache that is shared by all connections.
+var statementsCache = newStatementCache(defaultStatementCacheSize)
+
+// StatementCacheStats contains the statistics of the cache of parsed sql
+// strings that is shared by all connections of the driver.
+type StatementCacheStats struct {
+	// Size is the number of sql strings in the cache.
+	Size int
+	// Hits is the number of times that a sql string was found in the cache.
+	Hits uint64
+	// Misses is the number of times that a sql string had to be parsed,
+	// because it was not in the cache.
+	Misses uint64
+}
+
+// HitRatio returns the fraction of lookups that were served from the cache.
+// It returns 0 if the cache has not been used.
+func (s StatementCacheStats) HitRatio() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// GetStatementCacheStats returns the current statistics of the cache of
+// parsed sql strings that is shared by all connections of the driver.
+func GetStatementCacheStats() StatementCacheStats {
+	return statementsCache.stats()
+}
+
+// statementCache is a size-bounded LRU cache of parsed sql strings. The
+// cached statements are independent of any connection, and must not be
+// modified by the caller.
+type statementCache struct {
+	mu      sync.Mutex
+	maxSize int
+	entries map[string]*list.Element
+	lru     *list.List
+
+	hits   uint64
+	misses uint64
+}
+
+func newStatementCache(maxSize int) *statementCache {
+	return &statementCache{
+		maxSize: maxSize,
+		entries: make(map[string]*list.Element, maxSize),
+		lru:     list.New(),
+	}
+}
+
+// parse returns the parsed statement for the given sql string from the cache,
+// or parses the sql string and adds it to the cache if it is not in the
+// cache. Sql strings that cannot be parsed are not cached.
+func (c *statementCache) parse(query string) (*parsedStatement, error) {
+	if parsed, ok := c.get(query); ok {
+		atomic.AddUint64(&c.hits, 1)
+		return parsed, nil
+	}
+	atomic.AddUint64(&c.misses, 1)
+	parsed, err := parseSQL(query)
+	if err != nil {
+		return nil, err
+	}
+	c.put(parsed)
+	return parsed, nil
+}
+
+func (c *statementCache) get(query string) (*parsedStatement, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[query]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	return elem.Value.(*parsedStatement), true
+}
+
+func (c *statementCache) put(parsed *parsedStatement) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[parsed.query]; ok {
+		// Another goroutine added the same sql string in the meantime.
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.entries[parsed.query] = c.lru.PushFront(parsed)
+	for c.lru.Len() > c.maxSize {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*parsedStatement).query)
+	}
+}
+
+func (c *statementCache) stats() StatementCacheStats {
+	c.mu.Lock()
+	size := c.lru.Len()
+	c.mu.Unlock()
+	return StatementCacheStats{
+		Size:   size,
+		Hits:   atomic.LoadUint64(&c.hits),
+		Misses: atomic.LoadUint64(&c.misses),
+	}
+}
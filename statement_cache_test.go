@@ -0,0 +1,126 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestStatementCache(t *testing.T) {
+	cache := newStatementCache(2)
+	for _, query := range []string{"SELECT 1", "SELECT 2", "SELECT 1", "SELECT 3", "SELECT 1", "SELECT 2"} {
+		if _, err := cache.parse(query); err != nil {
+			t.Fatalf("failed to parse %q: %v", query, err)
+		}
+	}
+	// SELECT 2 was evicted when SELECT 3 was added, as SELECT 1 had been used
+	// more recently. SELECT 3 was evicted when SELECT 2 was added again.
+	want := StatementCacheStats{Size: 2, Hits: 2, Misses: 4}
+	if g, w := cache.stats(), want; g != w {
+		t.Fatalf("stats mismatch\nGot: %+v\nWant: %+v", g, w)
+	}
+	if g, w := cache.stats().HitRatio(), 2.0/6.0; g != w {
+		t.Fatalf("hit ratio mismatch\nGot: %v\nWant: %v", g, w)
+	}
+	for query, want := range map[string]bool{"SELECT 1": true, "SELECT 2": true, "SELECT 3": false} {
+		if _, ok := cache.get(query); ok != want {
+			t.Errorf("cache entry mismatch for %q\nGot: %v\nWant: %v", query, ok, want)
+		}
+	}
+}
+
+func TestStatementCache_Errors(t *testing.T) {
+	cache := newStatementCache(10)
+	for i := 0; i < 2; i++ {
+		if _, err := cache.parse("SELECT 'foo"); err == nil {
+			t.Fatal("missing expected parse error")
+		}
+	}
+	if g, w := cache.stats(), (StatementCacheStats{Misses: 2}); g != w {
+		t.Fatalf("stats mismatch\nGot: %+v\nWant: %+v", g, w)
+	}
+	if g, w := (StatementCacheStats{}).HitRatio(), 0.0; g != w {
+		t.Fatalf("hit ratio mismatch\nGot: %v\nWant: %v", g, w)
+	}
+}
+
+func TestParseStatement_ClientSide(t *testing.T) {
+	c1, c2 := &conn{}, &conn{}
+	query := "SET AUTOCOMMIT_DML_MODE = 'PARTITIONED_NON_ATOMIC'"
+	p1, err := parseStatement(c1, query)
+	if err != nil {
+		t.Fatalf("failed to parse %q: %v", query, err)
+	}
+	p2, err := parseStatement(c2, query)
+	if err != nil {
+		t.Fatalf("failed to parse %q: %v", query, err)
+	}
+	// Cached client-side statements are bound to the connection that they
+	// are parsed for.
+	if p1.clientSide.conn != c1 || p2.clientSide.conn != c2 {
+		t.Fatal("client-side statement is bound to the wrong connection")
+	}
+	if g, w := p2.clientSide.params, "'PARTITIONED_NON_ATOMIC'"; g != w {
+		t.Fatalf("params mismatch\nGot: %v\nWant: %v", g, w)
+	}
+}
+
+var benchmarkQuery = `-- Select the albums of a singer
+SELECT a.AlbumId, a.Title, s.FirstName, s.LastName
+FROM Albums a
+INNER JOIN Singers s ON a.SingerId = s.SingerId /* join on the primary key */
+WHERE s.SingerId = @singerId AND a.Title LIKE @title AND a.ReleaseDate > @releaseDate
+ORDER BY a.Title`
+
+// BenchmarkParseStatement measures the time that is needed to parse a sql
+// string that is in the statement cache.
+func BenchmarkParseStatement(b *testing.B) {
+	c := &conn{}
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		if _, err := parseStatement(c, benchmarkQuery); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkParseStatementUncached measures the time that is needed to parse
+// a sql string without the statement cache.
+func BenchmarkParseStatementUncached(b *testing.B) {
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		if _, err := parseSQL(benchmarkQuery); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkStatementCacheEviction measures the time that is needed to parse
+// sql strings when the statement cache is too small to hold all of them.
+func BenchmarkStatementCacheEviction(b *testing.B) {
+	cache := newStatementCache(100)
+	queries := make([]string, 200)
+	for i := range queries {
+		queries[i] = fmt.Sprintf("SELECT * FROM Singers WHERE SingerId = %d", i)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if _, err := cache.parse(queries[n%len(queries)]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -25,11 +25,12 @@ import (
 	"unicode"
 
 	"cloud.google.com/go/spanner"
+	sppb "google.golang.org/genproto/googleapis/spanner/v1"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
-var ddlStatements = map[string]bool{"CREATE": true, "DROP": true, "ALTER": true}
+var ddlStatements = map[string]bool{"CREATE": true, "DROP": true, "ALTER": true, "GRANT": true, "REVOKE": true, "RENAME": true, "ANALYZE": true}
 var selectStatements = map[string]bool{"SELECT": true, "WITH": true}
 var dmlStatements = map[string]bool{"INSERT": true, "UPDATE": true, "DELETE": true}
 var selectAndDmlStatements = union(selectStatements, dmlStatements)
@@ -265,19 +266,471 @@ func findParams(sql string) ([]string, error) {
 
 // isDDL returns true if the given sql string is a DDL statement.
 func isDDL(query string) (bool, error) {
-	query, err := removeCommentsAndTrim(query)
+	statementType, err := detectStatementType(query)
+	if err != nil {
+		return false, err
+	}
+	return statementType == statementTypeDdl, nil
+}
+
+// isQuery returns true if the given sql string is a query.
+func isQuery(query string) (bool, error) {
+	statementType, err := detectStatementType(query)
 	if err != nil {
 		return false, err
 	}
-	// We can safely check if the string starts with a specific string, as we
-	// have already removed all leading spaces, and there are no keywords that
-	// start with the same substring as one of the DDL keywords.
-	for ddl := range ddlStatements {
-		if strings.EqualFold(query[:len(ddl)], ddl) {
-			return true, nil
+	return statementType == statementTypeQuery, nil
+}
+
+// statementType is the type of a sql statement.
+type statementType int
+
+const (
+	statementTypeUnknown statementType = iota
+	statementTypeQuery
+	statementTypeDml
+	statementTypeDdl
+	statementTypeClientSide
+)
+
+// detectStatementType returns the type of the given sql string based on the
+// first keyword of the statement. Client-side statements are not detected by
+// this function, see parseStatement.
+func detectStatementType(query string) (statementType, error) {
+	query, err := removeCommentsAndTrim(query)
+	if err != nil {
+		return statementTypeUnknown, err
+	}
+	return statementTypeOf(query), nil
+}
+
+// statementTypeOf returns the type of the given sql string that does not
+// contain any comments.
+func statementTypeOf(sql string) statementType {
+	keyword := firstKeyword(sql)
+	switch {
+	case selectStatements[keyword]:
+		return statementTypeQuery
+	case dmlStatements[keyword]:
+		return statementTypeDml
+	case ddlStatements[keyword]:
+		return statementTypeDdl
+	}
+	return statementTypeUnknown
+}
+
+// firstKeyword returns the first keyword of the given sql string in upper
+// case, or an empty string if the statement does not start with a keyword.
+// The sql string must not contain any comments. Whitespace, opening
+// parentheses and statement hints before the first keyword are skipped, so
+// for example `(SELECT 1)` and `@{OPTIMIZER_VERSION=1} WITH ...` are
+// recognized as queries.
+func firstKeyword(sql string) string {
+	index := 0
+	for index < len(sql) {
+		c := sql[index]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '(':
+			index++
+		case c == '@':
+			// Skip a statement hint in the form @{KEY=VALUE, ...}. Statement
+			// hints do not contain any nested curly braces.
+			hint := strings.TrimLeft(sql[index+1:], " \t\n\r")
+			if !strings.HasPrefix(hint, "{") {
+				return ""
+			}
+			end := strings.IndexByte(hint, '}')
+			if end == -1 {
+				return ""
+			}
+			index = len(sql) - len(hint) + end + 1
+		default:
+			start := index
+			for index < len(sql) && isASCIILetter(sql[index]) {
+				index++
+			}
+			return strings.ToUpper(sql[start:index])
+		}
+	}
+	return ""
+}
+
+func isASCIILetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// parsedStatement is a sql string together with the information that the
+// driver needs to execute it. Prepared statements keep the parsedStatement
+// of their sql string, so the sql string is only parsed once, regardless of
+// how many times the statement is executed.
+type parsedStatement struct {
+	query         string
+	statementType statementType
+	// strippedQuery is the sql string without comments and statement hints.
+	// It is empty for client-side statements.
+	strippedQuery string
+	// params are the named parameters in the sql string in the order in
+	// which they appear.
+	params []string
+	// statements are the statements in the sql string if it contains more
+	// than one statement.
+	statements []string
+	// clientSideStatement and clientSideParams are the client-side statement
+	// that corresponds with the sql string and the parameters that were
+	// included in the statement.
+	clientSideStatement *clientSideStatement
+	clientSideParams    string
+	// clientSide is the client-side statement bound to the connection that
+	// the statement was parsed for.
+	clientSide *executableClientSideStatement
+	// paramTypes are the types of the parameters in the sql string as
+	// returned by Spanner when the statement was analyzed in PLAN mode. It is
+	// nil if the statement has not been analyzed.
+	paramTypes map[string]*sppb.Type
+}
+
+// parseStatement parses the given sql string for execution on the given
+// connection. The parse result is cached in the statement cache that is
+// shared by all connections, so a sql string is normally only parsed once.
+func parseStatement(c *conn, query string) (*parsedStatement, error) {
+	cached, err := statementsCache.parse(query)
+	if err != nil {
+		return nil, err
+	}
+	// Return a copy of the cached statement, as the connection and prepared
+	// statements add connection specific information to the statement.
+	parsed := *cached
+	if parsed.clientSideStatement != nil {
+		parsed.clientSide = &executableClientSideStatement{parsed.clientSideStatement, c, query, parsed.clientSideParams}
+	}
+	return &parsed, nil
+}
+
+// parseSQL parses the given sql string without using the statement cache.
+// The result is independent of any connection.
+func parseSQL(query string) (*parsedStatement, error) {
+	clientStmt, params, err := findClientSideStatement(query)
+	if err != nil {
+		return nil, err
+	}
+	if clientStmt != nil {
+		// Client-side statements that contain a statement, such as EXPLAIN,
+		// can contain query parameters. Other client-side statements do not
+		// have to be valid SQL, so parse errors are ignored.
+		names, _ := parseNamedParameters(query)
+		return &parsedStatement{
+			query:               query,
+			statementType:       statementTypeClientSide,
+			params:              names,
+			clientSideStatement: clientStmt,
+			clientSideParams:    params,
+		}, nil
+	}
+	stripped, err := removeCommentsAndTrim(query)
+	if err != nil {
+		return nil, err
+	}
+	stripped = removeStatementHint(stripped)
+	names, err := findParams(stripped)
+	if err != nil {
+		return nil, err
+	}
+	parsed := &parsedStatement{
+		query:         query,
+		statementType: statementTypeOf(stripped),
+		strippedQuery: stripped,
+		params:        names,
+	}
+	if strings.ContainsRune(stripped, ';') {
+		statements, err := splitStatements(query)
+		if err != nil {
+			return nil, err
+		}
+		if len(statements) > 1 {
+			parsed.statements = statements
 		}
 	}
-	return false, nil
+	return parsed, nil
+}
+
+// splitStatements splits the given sql string into the statements that it
+// contains. Statements are separated by semicolons that are not part of a
+// literal or a quoted identifier. Comments and empty statements are removed
+// from the result.
+func splitStatements(sql string) ([]string, error) {
+	const separator = ';'
+	const singleQuote = '\''
+	const doubleQuote = '"'
+	const backtick = '`'
+	sql, err := removeCommentsAndTrim(sql)
+	if err != nil {
+		return nil, err
+	}
+	isInQuoted := false
+	var startQuote rune
+	lastCharWasEscapeChar := false
+	isTripleQuoted := false
+	res := make([]string, 0, 1)
+	appendStatement := func(statement string) {
+		if statement = strings.TrimSpace(statement); statement != "" {
+			res = append(res, statement)
+		}
+	}
+	start := 0
+	index := 0
+	runes := []rune(sql)
+	for index < len(runes) {
+		c := runes[index]
+		if isInQuoted {
+			if c == startQuote {
+				if lastCharWasEscapeChar {
+					lastCharWasEscapeChar = false
+				} else if isTripleQuoted {
+					if len(runes) > index+2 && runes[index+1] == startQuote && runes[index+2] == startQuote {
+						isInQuoted = false
+						startQuote = 0
+						isTripleQuoted = false
+						index += 2
+					}
+				} else {
+					isInQuoted = false
+					startQuote = 0
+				}
+			} else if c == '\\' {
+				lastCharWasEscapeChar = !lastCharWasEscapeChar
+			} else {
+				lastCharWasEscapeChar = false
+			}
+		} else if c == separator {
+			appendStatement(string(runes[start:index]))
+			start = index + 1
+		} else if c == singleQuote || c == doubleQuote || c == backtick {
+			isInQuoted = true
+			startQuote = c
+			// Check whether it is a triple-quote.
+			if len(runes) > index+2 && runes[index+1] == startQuote && runes[index+2] == startQuote {
+				isTripleQuoted = true
+				index += 2
+			}
+		}
+		index++
+	}
+	appendStatement(string(runes[start:]))
+	return res, nil
+}
+
+// identifierPattern matches a simple or a backtick-quoted identifier.
+const identifierPattern = "([A-Za-z_][A-Za-z0-9_]*|`[^`]+`)"
+
+// tableNamePattern matches a table name that is optionally qualified with the
+// name of a named schema.
+const tableNamePattern = "((?:[A-Za-z_][A-Za-z0-9_]*|`[^`]+`)(?:\\.(?:[A-Za-z_][A-Za-z0-9_]*|`[^`]+`))?)"
+
+var insertMutationRegexp = regexp.MustCompile(`(?is)^INSERT\s+(?:INTO\s+)?` + tableNamePattern + `\s*\(([^()]*)\)\s*VALUES\s*\(([^()]*)\)$`)
+var updateMutationRegexp = regexp.MustCompile(`(?is)^UPDATE\s+` + tableNamePattern + `\s+SET\s+(.+?)\s+WHERE\s+(.+)$`)
+var deleteMutationRegexp = regexp.MustCompile(`(?is)^DELETE\s+(?:FROM\s+)?` + tableNamePattern + `\s+WHERE\s+(.+)$`)
+var tableNameRegexp = regexp.MustCompile("^" + identifierPattern + `(?:\.` + identifierPattern + ")?$")
+var identifierRegexp = regexp.MustCompile("^" + identifierPattern + "$")
+var mutationParamRegexp = regexp.MustCompile(`^@([A-Za-z_][A-Za-z0-9_]*)$`)
+var mutationAssignmentRegexp = regexp.MustCompile("^" + identifierPattern + `\s*=\s*@([A-Za-z_][A-Za-z0-9_]*)$`)
+var andRegexp = regexp.MustCompile(`(?i)\s+AND\s+`)
+
+type dmlMutationOp int
+
+const (
+	insertMutation dmlMutationOp = iota
+	updateMutation
+	deleteMutation
+)
+
+// dmlMutation is a simple single-row DML statement that can be executed as a
+// mutation instead of as a DML statement.
+type dmlMutation struct {
+	op    dmlMutationOp
+	table string
+	// columns are the columns that are written by an insert or update.
+	columns []string
+	// params are the names of the query parameters that contain the values
+	// for the columns.
+	params []string
+	// whereColumns are the columns in the WHERE clause of an update or
+	// delete. The statement can only be executed as a mutation if these are
+	// exactly the primary key columns of the table.
+	whereColumns []string
+	// whereParams are the names of the query parameters that contain the
+	// values for the whereColumns.
+	whereParams []string
+}
+
+// parseDMLMutation parses the given DML statement and returns a dmlMutation if
+// the statement is a simple INSERT, UPDATE or DELETE statement that only uses
+// query parameters for all values, and that only uses equality conditions in
+// the WHERE clause. It returns nil if the statement cannot be converted to a
+// mutation. The caller must verify that the WHERE clause of an UPDATE or
+// DELETE statement contains exactly the primary key columns of the table
+// before executing it as a mutation.
+func parseDMLMutation(sql string) (*dmlMutation, error) {
+	sql, err := removeCommentsAndTrim(sql)
+	if err != nil {
+		return nil, err
+	}
+	if m := insertMutationRegexp.FindStringSubmatch(sql); m != nil {
+		columns, ok := parseIdentifierList(m[2])
+		if !ok {
+			return nil, nil
+		}
+		params, ok := parseParamList(m[3])
+		if !ok || len(params) != len(columns) {
+			return nil, nil
+		}
+		return &dmlMutation{op: insertMutation, table: unquoteTableName(m[1]), columns: columns, params: params}, nil
+	}
+	if m := updateMutationRegexp.FindStringSubmatch(sql); m != nil {
+		columns, params, ok := parseAssignments(strings.Split(m[2], ","))
+		if !ok {
+			return nil, nil
+		}
+		whereColumns, whereParams, ok := parseAssignments(andRegexp.Split(m[3], -1))
+		if !ok {
+			return nil, nil
+		}
+		return &dmlMutation{
+			op:           updateMutation,
+			table:        unquoteTableName(m[1]),
+			columns:      columns,
+			params:       params,
+			whereColumns: whereColumns,
+			whereParams:  whereParams,
+		}, nil
+	}
+	if m := deleteMutationRegexp.FindStringSubmatch(sql); m != nil {
+		whereColumns, whereParams, ok := parseAssignments(andRegexp.Split(m[2], -1))
+		if !ok {
+			return nil, nil
+		}
+		return &dmlMutation{op: deleteMutation, table: unquoteTableName(m[1]), whereColumns: whereColumns, whereParams: whereParams}, nil
+	}
+	return nil, nil
+}
+
+// keyParams returns the names of the query parameters in the WHERE clause of
+// an update or delete in the order of the given primary key columns. It
+// returns false if the WHERE clause does not contain exactly one equality
+// condition for each primary key column, or if an update also writes one of
+// the primary key columns.
+func (d *dmlMutation) keyParams(primaryKey []string) ([]string, bool) {
+	if len(primaryKey) == 0 || len(d.whereColumns) != len(primaryKey) {
+		return nil, false
+	}
+	res := make([]string, len(primaryKey))
+	for i, keyColumn := range primaryKey {
+		found := false
+		for j, column := range d.whereColumns {
+			if strings.EqualFold(column, keyColumn) {
+				if found {
+					return nil, false
+				}
+				res[i] = d.whereParams[j]
+				found = true
+			}
+		}
+		if !found {
+			return nil, false
+		}
+		for _, column := range d.columns {
+			if strings.EqualFold(column, keyColumn) {
+				return nil, false
+			}
+		}
+	}
+	return res, true
+}
+
+// mutation creates a spanner.Mutation for the statement using the given
+// parameter values. primaryKey must contain the primary key columns of the
+// table in key order for an update or delete. It returns nil if the WHERE
+// clause of an update or delete does not match the primary key.
+func (d *dmlMutation) mutation(primaryKey []string, params map[string]interface{}) (*spanner.Mutation, error) {
+	columns, names := d.columns, d.params
+	if d.op != insertMutation {
+		keyParams, ok := d.keyParams(primaryKey)
+		if !ok {
+			return nil, nil
+		}
+		columns = append(append([]string{}, primaryKey...), d.columns...)
+		names = append(keyParams, d.params...)
+	}
+	values := make([]interface{}, len(names))
+	for i, name := range names {
+		v, ok := params[name]
+		if !ok {
+			return nil, spanner.ToSpannerError(status.Errorf(codes.InvalidArgument, "missing value for parameter %s", name))
+		}
+		values[i] = v
+	}
+	switch d.op {
+	case insertMutation:
+		return spanner.Insert(d.table, columns, values), nil
+	case updateMutation:
+		return spanner.Update(d.table, columns, values), nil
+	default:
+		return spanner.Delete(d.table, spanner.Key(values)), nil
+	}
+}
+
+func parseIdentifierList(s string) ([]string, bool) {
+	parts := strings.Split(s, ",")
+	res := make([]string, len(parts))
+	for i, part := range parts {
+		part = strings.TrimSpace(part)
+		if !identifierRegexp.MatchString(part) {
+			return nil, false
+		}
+		res[i] = unquoteIdentifier(part)
+	}
+	return res, true
+}
+
+func parseParamList(s string) ([]string, bool) {
+	parts := strings.Split(s, ",")
+	res := make([]string, len(parts))
+	for i, part := range parts {
+		m := mutationParamRegexp.FindStringSubmatch(strings.TrimSpace(part))
+		if m == nil {
+			return nil, false
+		}
+		res[i] = m[1]
+	}
+	return res, true
+}
+
+// parseAssignments parses a list of expressions in the form `column = @param`.
+func parseAssignments(parts []string) ([]string, []string, bool) {
+	columns := make([]string, len(parts))
+	params := make([]string, len(parts))
+	for i, part := range parts {
+		m := mutationAssignmentRegexp.FindStringSubmatch(strings.TrimSpace(part))
+		if m == nil {
+			return nil, nil, false
+		}
+		columns[i] = unquoteIdentifier(m[1])
+		params[i] = m[2]
+	}
+	return columns, params, true
+}
+
+func unquoteIdentifier(identifier string) string {
+	return strings.Trim(identifier, "`")
+}
+
+// unquoteTableName removes the quotes from the parts of a table name that is
+// optionally qualified with a schema name.
+func unquoteTableName(table string) string {
+	m := tableNameRegexp.FindStringSubmatch(table)
+	if m == nil || m[2] == "" {
+		return unquoteIdentifier(table)
+	}
+	return unquoteIdentifier(m[1]) + "." + unquoteIdentifier(m[2])
 }
 
 // clientSideStatements are loaded from the client_side_statements.json file.
@@ -370,13 +823,24 @@ func (c *executableClientSideStatement) QueryContext(ctx context.Context, args [
 // corresponds with the given query string, or nil if it is not a valid client
 // side statement.
 func parseClientSideStatement(c *conn, query string) (*executableClientSideStatement, error) {
+	stmt, params, err := findClientSideStatement(query)
+	if err != nil || stmt == nil {
+		return nil, err
+	}
+	return &executableClientSideStatement{stmt, c, query, params}, nil
+}
+
+// findClientSideStatement returns the pre-defined client-side statement that
+// matches the given query string and the parameters that are included in the
+// query string, or nil if it is not a valid client side statement.
+func findClientSideStatement(query string) (*clientSideStatement, string, error) {
 	statementsInit.Do(func() {
 		if err := compileStatements(); err != nil {
 			statementsCompileErr = err
 		}
 	})
 	if statementsCompileErr != nil {
-		return nil, statementsCompileErr
+		return nil, "", statementsCompileErr
 	}
 	for _, stmt := range statements.Statements {
 		if stmt.regexp.MatchString(query) {
@@ -386,9 +850,13 @@ func parseClientSideStatement(c *conn, query string) (*executableClientSideState
 				if len(p) == 2 {
 					params = strings.TrimSpace(p[1])
 				}
+			} else if m := stmt.regexp.FindStringSubmatch(query); len(m) > 1 {
+				// Statements that take a statement as a parameter, such as
+				// EXPLAIN, capture the statement in the regular expression.
+				params = strings.TrimSpace(m[1])
 			}
-			return &executableClientSideStatement{stmt, c, query, params}, nil
+			return stmt, params, nil
 		}
 	}
-	return nil, nil
+	return nil, "", nil
 }
@@ -19,6 +19,7 @@ import (
 
 	"cloud.google.com/go/spanner"
 	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
 	"google.golang.org/grpc/codes"
 )
 
@@ -671,6 +672,336 @@ func TestIsDdl(t *testing.T) {
 	}
 }
 
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    []string
+		wantErr bool
+	}{
+		{
+			input: `SELECT 1`,
+			want:  []string{`SELECT 1`},
+		},
+		{
+			input: `SELECT 1;`,
+			want:  []string{`SELECT 1`},
+		},
+		{
+			input: `SELECT 1; SELECT 2`,
+			want:  []string{`SELECT 1`, `SELECT 2`},
+		},
+		{
+			input: `SELECT 1;; ;SELECT 2;`,
+			want:  []string{`SELECT 1`, `SELECT 2`},
+		},
+		{
+			input: `UPDATE Foo SET Bar='a;b' WHERE Id=1; -- comment;
+SELECT "c;d", ` + "`e;f`" + ` FROM Foo`,
+			want: []string{`UPDATE Foo SET Bar='a;b' WHERE Id=1`, `SELECT "c;d", ` + "`e;f`" + ` FROM Foo`},
+		},
+		{
+			input: `SELECT 'a\';b'; SELECT """x;
+y"""`,
+			want: []string{`SELECT 'a\';b'`, `SELECT """x;
+y"""`},
+		},
+		{
+			input: `/* ; */`,
+			want:  []string{},
+		},
+		{
+			input:   `SELECT 'a; SELECT 2`,
+			wantErr: true,
+		},
+	}
+	for _, tc := range tests {
+		got, err := splitStatements(tc.input)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("missing expected error for %q", tc.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("failed to split %q: %v", tc.input, err)
+			continue
+		}
+		if !cmp.Equal(got, tc.want) {
+			t.Errorf("split statements mismatch for %q\nGot: %v\nWant: %v", tc.input, got, tc.want)
+		}
+	}
+}
+
+func TestIsQuery(t *testing.T) {
+	for input, want := range map[string]bool{
+		"SELECT 1":                             true,
+		"  select * from foo":                  true,
+		"WITH t AS (SELECT 1) SELECT * FROM t": true,
+		"(SELECT 1) UNION ALL (SELECT 2)":      true,
+		"@{OPTIMIZER_VERSION=1} SELECT 1":      true,
+		"/* comment */ SELECT 1":               true,
+		"UPDATE Foo SET Bar=1 WHERE TRUE":      false,
+		"SELECTED":                             false,
+		"CREATE TABLE Foo":                     false,
+		"":                                     false,
+	} {
+		got, err := isQuery(input)
+		if err != nil {
+			t.Fatalf("isQuery failed for %q: %v", input, err)
+		}
+		if got != want {
+			t.Errorf("isQuery mismatch for %q\nGot: %v\nWant: %v", input, got, want)
+		}
+	}
+}
+
+func TestDetectStatementType(t *testing.T) {
+	for input, want := range map[string]statementType{
+		"SELECT 1":                        statementTypeQuery,
+		"(SELECT 1) UNION ALL (SELECT 2)": statementTypeQuery,
+		"@{OPTIMIZER_VERSION=1} WITH t AS (SELECT 1) SELECT * FROM t":      statementTypeQuery,
+		"insert into Foo (Id) values (1)":                                  statementTypeDml,
+		"/* comment */ UPDATE Foo SET Bar=1 WHERE TRUE":                    statementTypeDml,
+		"DELETE FROM Foo WHERE TRUE":                                       statementTypeDml,
+		"CREATE TABLE Foo (Id INT64) PRIMARY KEY (Id)":                     statementTypeDdl,
+		"-- comment\nDROP TABLE Foo":                                       statementTypeDdl,
+		"alter table Foo add column Bar STRING(MAX)":                       statementTypeDdl,
+		"GRANT SELECT ON TABLE Singers TO ROLE analyst":                    statementTypeDdl,
+		"revoke SELECT ON TABLE Singers FROM ROLE analyst":                 statementTypeDdl,
+		"RENAME TABLE Singers TO Artists":                                  statementTypeDdl,
+		"ANALYZE":                                                          statementTypeDdl,
+		"@{LOCK_SCANNED_RANGES=exclusive} UPDATE Foo SET Bar=1 WHERE TRUE": statementTypeDml,
+		"@ {OPTIMIZER_VERSION=1} (SELECT 1)":                               statementTypeQuery,
+		"((WITH t AS (SELECT 1) SELECT * FROM t))":                         statementTypeQuery,
+		"@{OPTIMIZER_VERSION=1 SELECT 1":                                   statementTypeUnknown,
+		"@OPTIMIZER_VERSION SELECT 1":                                      statementTypeUnknown,
+		"0CREATE TABLE Foo":                                                statementTypeUnknown,
+		"SELECTED":                                                         statementTypeUnknown,
+		"":                                                                 statementTypeUnknown,
+	} {
+		got, err := detectStatementType(input)
+		if err != nil {
+			t.Fatalf("detectStatementType failed for %q: %v", input, err)
+		}
+		if got != want {
+			t.Errorf("statement type mismatch for %q\nGot: %v\nWant: %v", input, got, want)
+		}
+	}
+}
+
+func TestParseStatement(t *testing.T) {
+	for _, test := range []struct {
+		input          string
+		wantType       statementType
+		wantParams     []string
+		wantStatements []string
+		wantErr        bool
+	}{
+		{input: "SELECT * FROM Foo WHERE Id=@id AND Name=@name", wantType: statementTypeQuery, wantParams: []string{"id", "name"}},
+		{input: "UPDATE Foo SET Name=@name WHERE Id=@id", wantType: statementTypeDml, wantParams: []string{"name", "id"}},
+		{input: "CREATE TABLE Foo (Id INT64) PRIMARY KEY (Id)", wantType: statementTypeDdl},
+		{input: "SHOW VARIABLE AUTOCOMMIT_DML_MODE", wantType: statementTypeClientSide},
+		{input: "EXPLAIN SELECT * FROM Foo WHERE Id=@id", wantType: statementTypeClientSide, wantParams: []string{"id"}},
+		{input: "SELECT 1; SELECT @p", wantType: statementTypeQuery, wantParams: []string{"p"}, wantStatements: []string{"SELECT 1", "SELECT @p"}},
+		{input: "SELECT 'a;b'", wantType: statementTypeQuery},
+		{input: "SELECT 'foo", wantErr: true},
+	} {
+		parsed, err := parseStatement(&conn{}, test.input)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("missing expected error for %q", test.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("failed to parse %q: %v", test.input, err)
+		}
+		if g, w := parsed.statementType, test.wantType; g != w {
+			t.Errorf("statement type mismatch for %q\nGot: %v\nWant: %v", test.input, g, w)
+		}
+		if g, w := parsed.params, test.wantParams; !cmp.Equal(g, w, cmpopts.EquateEmpty()) {
+			t.Errorf("params mismatch for %q\nGot: %v\nWant: %v", test.input, g, w)
+		}
+		if g, w := parsed.statements, test.wantStatements; !cmp.Equal(g, w) {
+			t.Errorf("statements mismatch for %q\nGot: %v\nWant: %v", test.input, g, w)
+		}
+		if g, w := parsed.clientSide != nil, test.wantType == statementTypeClientSide; g != w {
+			t.Errorf("client-side statement mismatch for %q\nGot: %v\nWant: %v", test.input, g, w)
+		}
+	}
+}
+
+func TestParseDMLMutation(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  *dmlMutation
+	}{
+		{
+			name:  "insert",
+			input: "INSERT INTO Singers (SingerId, Name) VALUES (@id, @name)",
+			want:  &dmlMutation{op: insertMutation, table: "Singers", columns: []string{"SingerId", "Name"}, params: []string{"id", "name"}},
+		},
+		{
+			name:  "insert without into and with quoted identifiers",
+			input: "insert `Singers`(`SingerId`,Name)values(@id,@name);",
+			want:  &dmlMutation{op: insertMutation, table: "Singers", columns: []string{"SingerId", "Name"}, params: []string{"id", "name"}},
+		},
+		{
+			name:  "insert with comment",
+			input: "/* insert a singer */ INSERT INTO Singers (SingerId, Name) -- columns\nVALUES (@id, @name)",
+			want:  &dmlMutation{op: insertMutation, table: "Singers", columns: []string{"SingerId", "Name"}, params: []string{"id", "name"}},
+		},
+		{
+			name:  "update",
+			input: "UPDATE Singers SET FirstName = @first, LastName = @last WHERE SingerId = @id",
+			want:  &dmlMutation{op: updateMutation, table: "Singers", columns: []string{"FirstName", "LastName"}, params: []string{"first", "last"}, whereColumns: []string{"SingerId"}, whereParams: []string{"id"}},
+		},
+		{
+			name:  "update with composite key",
+			input: "update Albums set Title=@title where SingerId=@singer and AlbumId=@album",
+			want:  &dmlMutation{op: updateMutation, table: "Albums", columns: []string{"Title"}, params: []string{"title"}, whereColumns: []string{"SingerId", "AlbumId"}, whereParams: []string{"singer", "album"}},
+		},
+		{
+			name:  "delete",
+			input: "DELETE FROM Albums WHERE SingerId = @singer AND AlbumId = @album",
+			want:  &dmlMutation{op: deleteMutation, table: "Albums", whereColumns: []string{"SingerId", "AlbumId"}, whereParams: []string{"singer", "album"}},
+		},
+		{
+			name:  "delete from table in named schema",
+			input: "DELETE FROM music.`Albums` WHERE AlbumId=@album",
+			want:  &dmlMutation{op: deleteMutation, table: "music.Albums", whereColumns: []string{"AlbumId"}, whereParams: []string{"album"}},
+		},
+		{
+			name:  "delete without from",
+			input: "DELETE Singers WHERE SingerId=@id",
+			want:  &dmlMutation{op: deleteMutation, table: "Singers", whereColumns: []string{"SingerId"}, whereParams: []string{"id"}},
+		},
+		{
+			name:  "insert with literal",
+			input: "INSERT INTO Singers (SingerId, Name) VALUES (1, @name)",
+		},
+		{
+			name:  "insert with multiple rows",
+			input: "INSERT INTO Singers (SingerId, Name) VALUES (@id1, @name1), (@id2, @name2)",
+		},
+		{
+			name:  "insert with select",
+			input: "INSERT INTO Singers (SingerId, Name) SELECT SingerId, Name FROM OtherSingers",
+		},
+		{
+			name:  "insert with column count mismatch",
+			input: "INSERT INTO Singers (SingerId, Name) VALUES (@id)",
+		},
+		{
+			name:  "update with expression",
+			input: "UPDATE Singers SET Likes = Likes + 1 WHERE SingerId = @id",
+		},
+		{
+			name:  "update with range condition",
+			input: "UPDATE Singers SET Name = @name WHERE SingerId > @id",
+		},
+		{
+			name:  "update with or condition",
+			input: "UPDATE Singers SET Name = @name WHERE SingerId = @id1 OR SingerId = @id2",
+		},
+		{
+			name:  "update with then return",
+			input: "UPDATE Singers SET Name = @name WHERE SingerId = @id THEN RETURN *",
+		},
+		{
+			name:  "delete without where",
+			input: "DELETE FROM Singers",
+		},
+		{
+			name:  "delete with literal",
+			input: "DELETE FROM Singers WHERE SingerId = 1",
+		},
+		{
+			name:  "query",
+			input: "SELECT * FROM Singers WHERE SingerId = @id",
+		},
+	}
+
+	for _, tc := range tests {
+		got, err := parseDMLMutation(tc.input)
+		if err != nil {
+			t.Fatalf("%s: failed to parse statement: %v", tc.name, err)
+		}
+		if !cmp.Equal(got, tc.want, cmp.AllowUnexported(dmlMutation{})) {
+			t.Errorf("%s: dml mutation mismatch\nGot: %v\nWant: %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestDMLMutationKeyParams(t *testing.T) {
+	primaryKey := []string{"SingerId", "AlbumId"}
+	tests := []struct {
+		name   string
+		input  string
+		want   []string
+		wantOk bool
+	}{
+		{
+			name:   "primary key in key order",
+			input:  "DELETE FROM Albums WHERE SingerId=@singer AND AlbumId=@album",
+			want:   []string{"singer", "album"},
+			wantOk: true,
+		},
+		{
+			name:   "primary key out of key order",
+			input:  "DELETE FROM Albums WHERE AlbumId=@album AND SingerId=@singer",
+			want:   []string{"singer", "album"},
+			wantOk: true,
+		},
+		{
+			name:   "primary key with different case",
+			input:  "UPDATE Albums SET Title=@title WHERE albumid=@album AND SINGERID=@singer",
+			want:   []string{"singer", "album"},
+			wantOk: true,
+		},
+		{
+			name:  "partial primary key",
+			input: "DELETE FROM Albums WHERE SingerId=@singer",
+		},
+		{
+			name:  "non-key column",
+			input: "DELETE FROM Albums WHERE Title=@title",
+		},
+		{
+			name:  "non-key column in addition to primary key",
+			input: "UPDATE Albums SET Title=@title WHERE SingerId=@singer AND AlbumId=@album AND Active=@active",
+		},
+		{
+			name:  "duplicate key column",
+			input: "DELETE FROM Albums WHERE SingerId=@singer AND SingerId=@album",
+		},
+		{
+			name:  "update of key column",
+			input: "UPDATE Albums SET AlbumId=@new WHERE SingerId=@singer AND AlbumId=@album",
+		},
+	}
+
+	for _, tc := range tests {
+		dml, err := parseDMLMutation(tc.input)
+		if err != nil || dml == nil {
+			t.Fatalf("%s: failed to parse statement: %v", tc.name, err)
+		}
+		got, ok := dml.keyParams(primaryKey)
+		if ok != tc.wantOk {
+			t.Fatalf("%s: ok mismatch\nGot: %v\nWant: %v", tc.name, ok, tc.wantOk)
+		}
+		if !cmp.Equal(got, tc.want) {
+			t.Errorf("%s: key params mismatch\nGot: %v\nWant: %v", tc.name, got, tc.want)
+		}
+	}
+	// A table without a known primary key is never converted.
+	dml, _ := parseDMLMutation("DELETE FROM Albums WHERE SingerId=@singer AND AlbumId=@album")
+	if _, ok := dml.keyParams(nil); ok {
+		t.Error("unexpected key params for unknown primary key")
+	}
+}
+
 func TestParseClientSideStatement(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -735,6 +1066,98 @@ func TestParseClientSideStatement(t *testing.T) {
 			wantParams: "false",
 			exec:       true,
 		},
+		{
+			name:  "Show variable Statement_Timeout",
+			input: "show variable statement_timeout",
+			want:  "SHOW VARIABLE STATEMENT_TIMEOUT",
+			query: true,
+		},
+		{
+			name:       "SET Statement_Timeout",
+			input:      "set statement_timeout = '10s'",
+			want:       "SET STATEMENT_TIMEOUT = '<duration>'|NULL",
+			wantParams: "'10s'",
+			exec:       true,
+		},
+		{
+			name:  "Show variable Directed_Read",
+			input: "show variable directed_read",
+			want:  "SHOW VARIABLE DIRECTED_READ",
+			query: true,
+		},
+		{
+			name:       "SET Directed_Read",
+			input:      `set directed_read = '{"excludeReplicas":{"replicaSelections":[{"location":"eu-west1"}]}}'`,
+			want:       "SET DIRECTED_READ = '<json>'|NULL",
+			wantParams: `'{"excludeReplicas":{"replicaSelections":[{"location":"eu-west1"}]}}'`,
+			exec:       true,
+		},
+		{
+			name:       "SET Dml_As_Mutations",
+			input:      "set dml_as_mutations = true",
+			want:       "SET DML_AS_MUTATIONS = TRUE|FALSE",
+			wantParams: "true",
+			exec:       true,
+		},
+		{
+			name:  "SHOW VARIABLE DECODE_MODE",
+			input: "show variable decode_mode",
+			want:  "SHOW VARIABLE DECODE_MODE",
+			query: true,
+		},
+		{
+			name:       "SET DECODE_MODE",
+			input:      "set decode_mode = 'native'",
+			want:       "SET DECODE_MODE = 'SPANNER'|'NATIVE'|'GENERIC'",
+			wantParams: "'native'",
+			exec:       true,
+		},
+		{
+			name:  "SHOW VARIABLE OPTIMIZER_VERSION",
+			input: "show variable optimizer_version",
+			want:  "SHOW VARIABLE OPTIMIZER_VERSION",
+			query: true,
+		},
+		{
+			name:       "SET OPTIMIZER_VERSION",
+			input:      "set optimizer_version = '3'",
+			want:       "SET OPTIMIZER_VERSION = '<version>'|'LATEST'|''",
+			wantParams: "'3'",
+			exec:       true,
+		},
+		{
+			name:  "SHOW VARIABLE OPTIMIZER_STATISTICS_PACKAGE",
+			input: "show variable optimizer_statistics_package",
+			want:  "SHOW VARIABLE OPTIMIZER_STATISTICS_PACKAGE",
+			query: true,
+		},
+		{
+			name:       "SET OPTIMIZER_STATISTICS_PACKAGE",
+			input:      "set optimizer_statistics_package='auto_1'",
+			want:       "SET OPTIMIZER_STATISTICS_PACKAGE = '<package>'|''",
+			wantParams: "'auto_1'",
+			exec:       true,
+		},
+		{
+			name:  "SHOW VARIABLE QUERY_STATS",
+			input: "show variable query_stats",
+			want:  "SHOW VARIABLE QUERY_STATS",
+			query: true,
+		},
+		{
+			name:       "EXPLAIN",
+			input:      "explain select * from foo",
+			want:       "EXPLAIN <sql>",
+			wantParams: "select * from foo",
+			query:      true,
+		},
+		{
+			name:       "EXPLAIN ANALYZE",
+			input:      "EXPLAIN ANALYZE\nselect * from foo ",
+			want:       "EXPLAIN ANALYZE <sql>",
+			wantParams: "select * from foo",
+			query:      true,
+		},
 	}
 
 	for _, tc := range tests {
@@ -17,16 +17,22 @@ package spannerdriver
 import (
 	"context"
 	"database/sql/driver"
+	"math/big"
+	"time"
 
+	"cloud.google.com/go/civil"
 	"cloud.google.com/go/spanner"
+	sppb "google.golang.org/genproto/googleapis/spanner/v1"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
+// stmt is a prepared statement. The sql string of the statement is parsed
+// when the statement is prepared, and the parsed statement is re-used for
+// each execution of the statement.
 type stmt struct {
-	conn    *conn
-	numArgs int
-	query   string
+	conn   *conn
+	parsed *parsedStatement
 }
 
 func (s *stmt) Close() error {
@@ -34,7 +40,7 @@ func (s *stmt) Close() error {
 }
 
 func (s *stmt) NumInput() int {
-	return s.numArgs
+	return len(s.parsed.params)
 }
 
 func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
@@ -42,7 +48,7 @@ func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
 }
 
 func (s *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
-	return s.conn.ExecContext(ctx, s.query, args)
+	return s.conn.execStatement(ctx, s.parsed, args)
 }
 
 func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
@@ -50,39 +56,93 @@ func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
 }
 
 func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
-	ss, err := prepareSpannerStmt(s.query, args)
-	if err != nil {
-		return nil, err
-	}
-
-	var it rowIterator
-	if s.conn.tx != nil {
-		it = s.conn.tx.Query(ctx, ss)
-	} else {
-		it = &readOnlyRowIterator{s.conn.client.Single().WithTimestampBound(s.conn.readOnlyStaleness).Query(ctx, ss)}
-	}
-	return &rows{it: it}, nil
+	return s.conn.queryStatement(ctx, s.parsed, args)
 }
 
-func prepareSpannerStmt(q string, args []driver.NamedValue) (spanner.Statement, error) {
-	names, err := parseNamedParameters(q)
-	if err != nil {
-		return spanner.Statement{}, err
-	}
-	if len(names) != len(args) {
-		return spanner.Statement{}, spanner.ToSpannerError(status.Errorf(codes.InvalidArgument, "got %v argument values, but found %v parameters in the sql string", len(args), len(names)))
+func prepareSpannerStmt(parsed *parsedStatement, args []driver.NamedValue) (spanner.Statement, error) {
+	if len(parsed.params) != len(args) {
+		return spanner.Statement{}, spanner.ToSpannerError(status.Errorf(codes.InvalidArgument, "got %v argument values, but found %v parameters in the sql string", len(args), len(parsed.params)))
 	}
-	ss := spanner.NewStatement(q)
+	ss := spanner.NewStatement(parsed.query)
 	for i, v := range args {
 		name := args[i].Name
 		if name == "" {
-			name = names[i]
+			name = parsed.params[i]
+		}
+		if err := checkParamType(parsed.paramTypes[name], name, v.Value); err != nil {
+			return spanner.Statement{}, err
 		}
 		ss.Params[name] = v.Value
 	}
 	return ss, nil
 }
 
+// checkParamType returns an error if the given value cannot be used for a
+// parameter of the given type. Values of unknown types and parameters
+// without a type are not checked, and are left to Spanner to verify.
+func checkParamType(paramType *sppb.Type, name string, value interface{}) error {
+	if paramType == nil {
+		return nil
+	}
+	code, ok := valueTypeCode(value)
+	if !ok || code == paramType.Code {
+		return nil
+	}
+	switch paramType.Code {
+	case sppb.TypeCode_FLOAT64:
+		// Spanner coerces INT64 values to FLOAT64.
+		if code == sppb.TypeCode_INT64 {
+			return nil
+		}
+	case sppb.TypeCode_DATE, sppb.TypeCode_TIMESTAMP, sppb.TypeCode_NUMERIC, sppb.TypeCode_JSON:
+		// Spanner accepts string representations of these types.
+		if code == sppb.TypeCode_STRING {
+			return nil
+		}
+	}
+	return spanner.ToSpannerError(status.Errorf(codes.InvalidArgument, "parameter %s has type %s, but the argument value %v has type %s", name, paramType.Code, value, code))
+}
+
+// valueTypeCode returns the Spanner type code of the given argument value. It
+// returns false if the value is null or if the type cannot be determined.
+func valueTypeCode(value interface{}) (sppb.TypeCode, bool) {
+	switch v := value.(type) {
+	case string:
+		return sppb.TypeCode_STRING, true
+	case spanner.NullString:
+		return sppb.TypeCode_STRING, v.Valid
+	case int64, int, int32, int16, int8, uint32, uint16, uint8:
+		return sppb.TypeCode_INT64, true
+	case spanner.NullInt64:
+		return sppb.TypeCode_INT64, v.Valid
+	case float64, float32:
+		return sppb.TypeCode_FLOAT64, true
+	case spanner.NullFloat64:
+		return sppb.TypeCode_FLOAT64, v.Valid
+	case bool:
+		return sppb.TypeCode_BOOL, true
+	case spanner.NullBool:
+		return sppb.TypeCode_BOOL, v.Valid
+	case []byte:
+		return sppb.TypeCode_BYTES, v != nil
+	case time.Time:
+		return sppb.TypeCode_TIMESTAMP, true
+	case spanner.NullTime:
+		return sppb.TypeCode_TIMESTAMP, v.Valid
+	case civil.Date:
+		return sppb.TypeCode_DATE, true
+	case spanner.NullDate:
+		return sppb.TypeCode_DATE, v.Valid
+	case big.Rat:
+		return sppb.TypeCode_NUMERIC, true
+	case spanner.NullNumeric:
+		return sppb.TypeCode_NUMERIC, v.Valid
+	case spanner.NullJSON:
+		return sppb.TypeCode_JSON, v.Valid
+	}
+	return sppb.TypeCode_TYPE_CODE_UNSPECIFIED, false
+}
+
 type result struct {
 	rowsAffected int64
 }
@@ -17,15 +17,31 @@ package testutil
 import (
 	"context"
 	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
 	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	emptypb "github.com/golang/protobuf/ptypes/empty"
 	longrunningpb "google.golang.org/genproto/googleapis/longrunning"
+	statuspb "google.golang.org/genproto/googleapis/rpc/status"
 	databasepb "google.golang.org/genproto/googleapis/spanner/admin/database/v1"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
-	"strings"
+	gstatus "google.golang.org/grpc/status"
 )
 
 // InMemDatabaseAdminServer contains the DatabaseAdminServer interface plus a couple
 // of specific methods for setting mocked results.
+//
+// The server keeps track of the databases that are created and dropped and of
+// the DDL statements that are applied to each database. UpdateDatabaseDdl
+// returns the first response that has been set with SetResps if any has been
+// set without applying the statements, and otherwise a completed long-running
+// operation with the metadata of the applied statements. UpdateDatabaseDdl
+// returns NotFound for a database that has not been created with
+// CreateDatabase or PutDatabase.
 type InMemDatabaseAdminServer interface {
 	databasepb.DatabaseAdminServer
 	Stop()
@@ -34,23 +50,41 @@ type InMemDatabaseAdminServer interface {
 	Reqs() []proto.Message
 	SetReqs([]proto.Message)
 	SetErr(error)
+	// Ddl returns the DDL statements that have been applied to the given
+	// database, or nil if the database does not exist.
+	Ddl(database string) []string
+	// PutDatabase creates an empty database with the given name if it does
+	// not already exist.
+	PutDatabase(database string)
+	// PutDdlStatementError registers an error for the given DDL statement.
+	// UpdateDatabaseDdl applies all statements before the failing statement,
+	// and returns a failed long-running operation for the statement.
+	PutDdlStatementError(statement string, err error)
 }
 
-// inMemDatabaseAdminServer implements InMemDatabaseAdminServer interface. Note that
-// there is no mutex protecting the data structures, so it is not safe for
-// concurrent use.
+// inMemDatabaseAdminServer implements InMemDatabaseAdminServer interface.
 type inMemDatabaseAdminServer struct {
 	databasepb.DatabaseAdminServer
+	mu   sync.Mutex
 	reqs []proto.Message
 	// If set, all calls return this error
 	err error
 	// responses to return if err == nil
 	resps []proto.Message
+	// databases contains the DDL statements of each database.
+	databases map[string][]string
+	// ddlErrors contains the errors that should be returned for specific
+	// DDL statements.
+	ddlErrors map[string]error
+	opCount   int
 }
 
 // NewInMemDatabaseAdminServer creates a new in-mem test server.
 func NewInMemDatabaseAdminServer() InMemDatabaseAdminServer {
-	res := &inMemDatabaseAdminServer{}
+	res := &inMemDatabaseAdminServer{
+		databases: make(map[string][]string),
+		ddlErrors: make(map[string]error),
+	}
 	return res
 }
 
@@ -59,11 +93,123 @@ func (s *inMemDatabaseAdminServer) UpdateDatabaseDdl(ctx context.Context, req *d
 	if xg := md["x-goog-api-client"]; len(xg) == 0 || !strings.Contains(xg[0], "gl-go/") {
 		return nil, fmt.Errorf("x-goog-api-client = %v, expected gl-go key", xg)
 	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reqs = append(s.reqs, req)
+	if s.err != nil {
+		return nil, s.err
+	}
+	// A canned response is returned as-is, without applying the statements
+	// to the database.
+	if len(s.resps) > 0 {
+		return s.resps[0].(*longrunningpb.Operation), nil
+	}
+	if _, ok := s.databases[req.Database]; !ok {
+		return nil, gstatus.Errorf(codes.NotFound, "Database not found: %s", req.Database)
+	}
+	if len(req.Statements) == 0 {
+		return nil, gstatus.Error(codes.InvalidArgument, "No statements in request")
+	}
+	operationMetadata := &databasepb.UpdateDatabaseDdlMetadata{
+		Database:   req.Database,
+		Statements: req.Statements,
+	}
+	var opErr error
+	for _, statement := range req.Statements {
+		if err, ok := s.ddlErrors[statement]; ok {
+			opErr = err
+			break
+		}
+		s.databases[req.Database] = append(s.databases[req.Database], statement)
+		operationMetadata.CommitTimestamps = append(operationMetadata.CommitTimestamps, ptypes.TimestampNow())
+	}
+	return s.newOperation(operationMetadata, &emptypb.Empty{}, opErr)
+}
+
+// databaseIDPattern matches a valid database ID. A database ID must start with
+// a lower-case letter, end with a lower-case letter or a digit, contain only
+// lower-case letters, digits, underscores and hyphens, and be between 2 and 30
+// characters long.
+const databaseIDPattern = `[a-z][a-z0-9_\-]{0,28}[a-z0-9]`
+
+// createDatabaseRegExp matches a CREATE DATABASE statement. The database ID
+// may be quoted with backticks (GoogleSQL) or double quotes (PostgreSQL).
+var createDatabaseRegExp = regexp.MustCompile("^\\s*(?i:CREATE\\s+DATABASE)\\s+(?:`(" + databaseIDPattern + ")`|\"(" + databaseIDPattern + ")\"|(" + databaseIDPattern + "))\\s*$")
+
+func (s *inMemDatabaseAdminServer) CreateDatabase(ctx context.Context, req *databasepb.CreateDatabaseRequest) (*longrunningpb.Operation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reqs = append(s.reqs, req)
+	if s.err != nil {
+		return nil, s.err
+	}
+	m := createDatabaseRegExp.FindStringSubmatch(req.CreateStatement)
+	if m == nil {
+		return nil, gstatus.Errorf(codes.InvalidArgument, "Invalid create statement: %s", req.CreateStatement)
+	}
+	name := fmt.Sprintf("%s/databases/%s", req.Parent, m[1]+m[2]+m[3])
+	if _, ok := s.databases[name]; ok {
+		return nil, gstatus.Errorf(codes.AlreadyExists, "Database already exists: %s", name)
+	}
+	s.databases[name] = append([]string{}, req.ExtraStatements...)
+	return s.newOperation(
+		&databasepb.CreateDatabaseMetadata{Database: name},
+		&databasepb.Database{Name: name, State: databasepb.Database_READY, DatabaseDialect: req.DatabaseDialect},
+		nil)
+}
+
+func (s *inMemDatabaseAdminServer) DropDatabase(ctx context.Context, req *databasepb.DropDatabaseRequest) (*emptypb.Empty, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reqs = append(s.reqs, req)
+	if s.err != nil {
+		return nil, s.err
+	}
+	if _, ok := s.databases[req.Database]; !ok {
+		return nil, gstatus.Errorf(codes.NotFound, "Database not found: %s", req.Database)
+	}
+	delete(s.databases, req.Database)
+	return &emptypb.Empty{}, nil
+}
+
+func (s *inMemDatabaseAdminServer) GetDatabaseDdl(ctx context.Context, req *databasepb.GetDatabaseDdlRequest) (*databasepb.GetDatabaseDdlResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.reqs = append(s.reqs, req)
 	if s.err != nil {
 		return nil, s.err
 	}
-	return s.resps[0].(*longrunningpb.Operation), nil
+	statements, ok := s.databases[req.Database]
+	if !ok {
+		return nil, gstatus.Errorf(codes.NotFound, "Database not found: %s", req.Database)
+	}
+	return &databasepb.GetDatabaseDdlResponse{Statements: append([]string{}, statements...)}, nil
+}
+
+// newOperation returns a completed long-running operation with the given
+// metadata and response, or with the given error if err is not nil.
+func (s *inMemDatabaseAdminServer) newOperation(operationMetadata, response proto.Message, err error) (*longrunningpb.Operation, error) {
+	s.opCount++
+	op := &longrunningpb.Operation{
+		Name: fmt.Sprintf("operations/%d", s.opCount),
+		Done: true,
+	}
+	md, mdErr := ptypes.MarshalAny(operationMetadata)
+	if mdErr != nil {
+		return nil, mdErr
+	}
+	op.Metadata = md
+	if err != nil {
+		st := gstatus.Convert(err)
+		op.Result = &longrunningpb.Operation_Error{Error: &statuspb.Status{Code: int32(st.Code()), Message: st.Message()}}
+		return op, nil
+	}
+	resp, respErr := ptypes.MarshalAny(response)
+	if respErr != nil {
+		return nil, respErr
+	}
+	op.Result = &longrunningpb.Operation_Response{Response: resp}
+	return op, nil
 }
 
 func (s *inMemDatabaseAdminServer) Stop() {
@@ -71,21 +217,55 @@ func (s *inMemDatabaseAdminServer) Stop() {
 }
 
 func (s *inMemDatabaseAdminServer) Resps() []proto.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	return s.resps
 }
 
 func (s *inMemDatabaseAdminServer) SetResps(resps []proto.Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.resps = resps
 }
 
 func (s *inMemDatabaseAdminServer) Reqs() []proto.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	return s.reqs
 }
 
 func (s *inMemDatabaseAdminServer) SetReqs(reqs []proto.Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.reqs = reqs
 }
 
 func (s *inMemDatabaseAdminServer) SetErr(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.err = err
 }
+
+func (s *inMemDatabaseAdminServer) Ddl(database string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	statements, ok := s.databases[database]
+	if !ok {
+		return nil
+	}
+	return append([]string{}, statements...)
+}
+
+func (s *inMemDatabaseAdminServer) PutDdlStatementError(statement string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ddlErrors[statement] = err
+}
+
+func (s *inMemDatabaseAdminServer) PutDatabase(database string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.databases[database]; !ok {
+		s.databases[database] = []string{}
+	}
+}
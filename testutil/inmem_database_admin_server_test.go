@@ -0,0 +1,135 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testutil
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	databasepb "google.golang.org/genproto/googleapis/spanner/admin/database/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	gstatus "google.golang.org/grpc/status"
+)
+
+func TestInMemDatabaseAdminServer_CreateAndDropDatabase(t *testing.T) {
+	ctx := context.Background()
+	server := NewInMemDatabaseAdminServer()
+	const name = "projects/p/instances/i/databases/my-db"
+
+	if _, err := server.CreateDatabase(ctx, &databasepb.CreateDatabaseRequest{
+		Parent:          "projects/p/instances/i",
+		CreateStatement: "CREATE DATABASE `my-db`",
+		ExtraStatements: []string{"CREATE TABLE Foo (Id INT64) PRIMARY KEY (Id)"},
+	}); err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	resp, err := server.GetDatabaseDdl(ctx, &databasepb.GetDatabaseDdlRequest{Database: name})
+	if err != nil {
+		t.Fatalf("failed to get database DDL: %v", err)
+	}
+	if g, w := resp.Statements, []string{"CREATE TABLE Foo (Id INT64) PRIMARY KEY (Id)"}; !cmp.Equal(g, w) {
+		t.Fatalf("DDL mismatch\nGot: %v\nWant: %v", g, w)
+	}
+	_, err = server.CreateDatabase(ctx, &databasepb.CreateDatabaseRequest{
+		Parent:          "projects/p/instances/i",
+		CreateStatement: "CREATE DATABASE `my-db`",
+	})
+	if g, w := gstatus.Code(err), codes.AlreadyExists; g != w {
+		t.Fatalf("error code mismatch\nGot: %v\nWant: %v", g, w)
+	}
+
+	if _, err := server.DropDatabase(ctx, &databasepb.DropDatabaseRequest{Database: name}); err != nil {
+		t.Fatalf("failed to drop database: %v", err)
+	}
+	_, err = server.DropDatabase(ctx, &databasepb.DropDatabaseRequest{Database: name})
+	if g, w := gstatus.Code(err), codes.NotFound; g != w {
+		t.Fatalf("error code mismatch\nGot: %v\nWant: %v", g, w)
+	}
+	_, err = server.GetDatabaseDdl(ctx, &databasepb.GetDatabaseDdlRequest{Database: name})
+	if g, w := gstatus.Code(err), codes.NotFound; g != w {
+		t.Fatalf("error code mismatch\nGot: %v\nWant: %v", g, w)
+	}
+	if server.Ddl(name) != nil {
+		t.Fatalf("unexpected DDL for dropped database: %v", server.Ddl(name))
+	}
+}
+
+func TestInMemDatabaseAdminServer_CreateDatabaseStatement(t *testing.T) {
+	ctx := context.Background()
+	for _, test := range []struct {
+		statement string
+		database  string
+		code      codes.Code
+	}{
+		{statement: "CREATE DATABASE my_db", database: "my_db"},
+		{statement: "create database `my-db1`", database: "my-db1"},
+		{statement: `CREATE DATABASE "pg-db"`, database: "pg-db"},
+		{statement: "CREATE DATABASE ab", database: "ab"},
+		{statement: "CREATE DATABASE abcdefghijklmnopqrstuvwxyz0123", database: "abcdefghijklmnopqrstuvwxyz0123"},
+		{statement: "CREATE DATABASE MyDb", code: codes.InvalidArgument},
+		{statement: "CREATE DATABASE a", code: codes.InvalidArgument},
+		{statement: "CREATE DATABASE abcdefghijklmnopqrstuvwxyz01234", code: codes.InvalidArgument},
+		{statement: "CREATE DATABASE 1db", code: codes.InvalidArgument},
+		{statement: "CREATE DATABASE my-db-", code: codes.InvalidArgument},
+		{statement: "CREATE DATABASE my_db_", code: codes.InvalidArgument},
+		{statement: "CREATE DATABASE `my-db\"", code: codes.InvalidArgument},
+	} {
+		server := NewInMemDatabaseAdminServer()
+		_, err := server.CreateDatabase(ctx, &databasepb.CreateDatabaseRequest{
+			Parent:          "projects/p/instances/i",
+			CreateStatement: test.statement,
+		})
+		if g, w := gstatus.Code(err), test.code; g != w {
+			t.Errorf("%s: error code mismatch\nGot: %v\nWant: %v", test.statement, g, w)
+			continue
+		}
+		if test.code == codes.OK && server.Ddl("projects/p/instances/i/databases/"+test.database) == nil {
+			t.Errorf("%s: database %s not created", test.statement, test.database)
+		}
+	}
+}
+
+func TestInMemDatabaseAdminServer_UpdateDatabaseDdl(t *testing.T) {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-goog-api-client", "gl-go/1.17"))
+	server := NewInMemDatabaseAdminServer()
+	const name = "projects/p/instances/i/databases/d"
+	req := &databasepb.UpdateDatabaseDdlRequest{
+		Database:   name,
+		Statements: []string{"CREATE TABLE Foo (Id INT64) PRIMARY KEY (Id)"},
+	}
+
+	// Databases are not implicitly created.
+	_, err := server.UpdateDatabaseDdl(ctx, req)
+	if g, w := gstatus.Code(err), codes.NotFound; g != w {
+		t.Fatalf("error code mismatch\nGot: %v\nWant: %v", g, w)
+	}
+	if server.Ddl(name) != nil {
+		t.Fatalf("unexpected DDL for unknown database: %v", server.Ddl(name))
+	}
+
+	server.PutDatabase(name)
+	op, err := server.UpdateDatabaseDdl(ctx, req)
+	if err != nil {
+		t.Fatalf("failed to update database DDL: %v", err)
+	}
+	if !op.Done || op.GetError() != nil {
+		t.Fatalf("unexpected operation result: %v", op)
+	}
+	if g, w := server.Ddl(name), req.Statements; !cmp.Equal(g, w) {
+		t.Fatalf("DDL mismatch\nGot: %v\nWant: %v", g, w)
+	}
+}
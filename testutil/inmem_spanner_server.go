@@ -25,13 +25,14 @@ import (
 	"sync"
 	"time"
 
+	"cloud.google.com/go/spanner/apiv1/spannerpb"
+	"github.com/golang/protobuf/proto"
 	"github.com/golang/protobuf/ptypes"
 	emptypb "github.com/golang/protobuf/ptypes/empty"
 	structpb "github.com/golang/protobuf/ptypes/struct"
 	"github.com/golang/protobuf/ptypes/timestamp"
 	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/genproto/googleapis/rpc/status"
-	spannerpb "google.golang.org/genproto/googleapis/spanner/v1"
 	"google.golang.org/grpc/codes"
 	gstatus "google.golang.org/grpc/status"
 )
@@ -85,6 +86,7 @@ const (
 	MethodExecuteStreamingSql string = "EXECUTE_STREAMING_SQL"
 	MethodExecuteBatchDml     string = "EXECUTE_BATCH_DML"
 	MethodStreamingRead       string = "EXECUTE_STREAMING_READ"
+	MethodBatchWrite          string = "BATCH_WRITE"
 )
 
 // StatementResult represents a mocked result on the test server. The result is
@@ -153,6 +155,8 @@ func (s *StatementResult) ToPartialResultSets(resumeToken []byte) (result []*spa
 			Metadata: s.ResultSet.Metadata,
 		})
 	}
+	// The statistics are returned with the last part of the result.
+	result[len(result)-1].Stats = s.ResultSet.Stats
 	return result, nil
 }
 
@@ -172,8 +176,15 @@ func (s *StatementResult) updateCountToPartialResultSet(exact bool) *spannerpb.P
 // Converts an update count to a ResultSet, as DML statements also return the
 // update count as the statistics of a ResultSet.
 func (s *StatementResult) convertUpdateCountToResultSet(exact bool) *spannerpb.ResultSet {
+	rs := &spannerpb.ResultSet{
+		Stats: &spannerpb.ResultSetStats{
+			RowCount: &spannerpb.ResultSetStats_RowCountLowerBound{
+				RowCountLowerBound: s.UpdateCount,
+			},
+		},
+	}
 	if exact {
-		return &spannerpb.ResultSet{
+		rs = &spannerpb.ResultSet{
 			Stats: &spannerpb.ResultSetStats{
 				RowCount: &spannerpb.ResultSetStats_RowCountExact{
 					RowCountExact: s.UpdateCount,
@@ -181,13 +192,37 @@ func (s *StatementResult) convertUpdateCountToResultSet(exact bool) *spannerpb.R
 			},
 		}
 	}
-	return &spannerpb.ResultSet{
-		Stats: &spannerpb.ResultSetStats{
-			RowCount: &spannerpb.ResultSetStats_RowCountLowerBound{
-				RowCountLowerBound: s.UpdateCount,
-			},
-		},
+	if s.ResultSet != nil && s.ResultSet.Metadata != nil && s.ResultSet.Metadata.Transaction != nil {
+		rs.Metadata = &spannerpb.ResultSetMetadata{
+			Transaction: s.ResultSet.Metadata.Transaction,
+		}
+	}
+	return rs
+}
+
+// getResultSetWithTransactionSet returns a copy of the StatementResult that
+// includes the id of the transaction that was started by the statement if the
+// selector contains an inline BeginTransaction option.
+func (s StatementResult) getResultSetWithTransactionSet(selector *spannerpb.TransactionSelector, tx []byte) *StatementResult {
+	res := &StatementResult{
+		Type:         s.Type,
+		Err:          s.Err,
+		UpdateCount:  s.UpdateCount,
+		ResumeTokens: s.ResumeTokens,
+	}
+	if s.ResultSet != nil {
+		res.ResultSet = proto.Clone(s.ResultSet).(*spannerpb.ResultSet)
+	}
+	if _, ok := selector.GetSelector().(*spannerpb.TransactionSelector_Begin); ok {
+		if res.ResultSet == nil {
+			res.ResultSet = &spannerpb.ResultSet{}
+		}
+		if res.ResultSet.Metadata == nil {
+			res.ResultSet.Metadata = &spannerpb.ResultSetMetadata{}
+		}
+		res.ResultSet.Metadata.Transaction = &spannerpb.Transaction{Id: tx}
 	}
+	return res
 }
 
 // SimulatedExecutionTime represents the time the execution of a method
@@ -789,6 +824,7 @@ func (s *inMemSpannerServer) ExecuteSql(ctx context.Context, req *spannerpb.Exec
 		return nil, err
 	}
 	s.mu.Lock()
+	statementResult = statementResult.getResultSetWithTransactionSet(req.GetTransaction(), id)
 	isPartitionedDml := s.partitionedDmlTransactions[string(id)]
 	s.mu.Unlock()
 	switch statementResult.Type {
@@ -835,6 +871,7 @@ func (s *inMemSpannerServer) executeStreamingSQL(req *spannerpb.ExecuteSqlReques
 		return err
 	}
 	s.mu.Lock()
+	statementResult = statementResult.getResultSetWithTransactionSet(req.GetTransaction(), id)
 	isPartitionedDml := s.partitionedDmlTransactions[string(id)]
 	s.mu.Unlock()
 	switch statementResult.Type {
@@ -907,6 +944,9 @@ func (s *inMemSpannerServer) ExecuteBatchDml(ctx context.Context, req *spannerpb
 		if err != nil {
 			return nil, err
 		}
+		s.mu.Lock()
+		statementResult = statementResult.getResultSetWithTransactionSet(req.GetTransaction(), id)
+		s.mu.Unlock()
 		switch statementResult.Type {
 		case StatementResultError:
 			resp.Status = &status.Status{Code: int32(gstatus.Code(statementResult.Err)), Message: statementResult.Err.Error()}
@@ -951,6 +991,32 @@ func (s *inMemSpannerServer) StreamingRead(req *spannerpb.ReadRequest, stream sp
 	return s.executeStreamingSQL(sqlReq, stream)
 }
 
+// BatchWrite returns a successful response with a commit timestamp for each
+// mutation group in the request. The mutations are not applied to any data.
+func (s *inMemSpannerServer) BatchWrite(req *spannerpb.BatchWriteRequest, stream spannerpb.Spanner_BatchWriteServer) error {
+	if err := s.simulateExecutionTime(MethodBatchWrite, req); err != nil {
+		return err
+	}
+	if req.Session == "" {
+		return gstatus.Error(codes.InvalidArgument, "Missing session name")
+	}
+	session, err := s.findSession(req.Session)
+	if err != nil {
+		return err
+	}
+	s.updateSessionLastUseTime(session.Name)
+	for i := range req.MutationGroups {
+		if err := stream.Send(&spannerpb.BatchWriteResponse{
+			Indexes:         []int32{int32(i)},
+			Status:          &status.Status{Code: int32(codes.OK)},
+			CommitTimestamp: getCurrentTimestamp(),
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (s *inMemSpannerServer) BeginTransaction(ctx context.Context, req *spannerpb.BeginTransactionRequest) (*spannerpb.Transaction, error) {
 	if err := s.simulateExecutionTime(MethodBeginTransaction, req); err != nil {
 		return nil, err
@@ -79,14 +79,14 @@ type MockedSpannerInMemTestServer struct {
 // NewMockedSpannerInMemTestServer creates a MockedSpannerInMemTestServer at
 // localhost with a random port and returns client options that can be used
 // to connect to it.
-func NewMockedSpannerInMemTestServer(t *testing.T) (mockedServer *MockedSpannerInMemTestServer, opts []option.ClientOption, teardown func()) {
+func NewMockedSpannerInMemTestServer(t testing.TB) (mockedServer *MockedSpannerInMemTestServer, opts []option.ClientOption, teardown func()) {
 	return NewMockedSpannerInMemTestServerWithAddr(t, "localhost:0")
 }
 
 // NewMockedSpannerInMemTestServerWithAddr creates a MockedSpannerInMemTestServer
 // at a given listening address and returns client options that can be used
 // to connect to it.
-func NewMockedSpannerInMemTestServerWithAddr(t *testing.T, addr string) (mockedServer *MockedSpannerInMemTestServer, opts []option.ClientOption, teardown func()) {
+func NewMockedSpannerInMemTestServerWithAddr(t testing.TB, addr string) (mockedServer *MockedSpannerInMemTestServer, opts []option.ClientOption, teardown func()) {
 	mockedServer = &MockedSpannerInMemTestServer{}
 	opts = mockedServer.setupMockedServerWithAddr(t, addr)
 	return mockedServer, opts, func() {
@@ -97,10 +97,13 @@ func NewMockedSpannerInMemTestServerWithAddr(t *testing.T, addr string) (mockedS
 	}
 }
 
-func (s *MockedSpannerInMemTestServer) setupMockedServerWithAddr(t *testing.T, addr string) []option.ClientOption {
+func (s *MockedSpannerInMemTestServer) setupMockedServerWithAddr(t testing.TB, addr string) []option.ClientOption {
 	s.TestSpanner = NewInMemSpannerServer()
 	s.TestInstanceAdmin = NewInMemInstanceAdminServer()
 	s.TestDatabaseAdmin = NewInMemDatabaseAdminServer()
+	// The tests connect to this database, and DDL statements can only be
+	// applied to a database that exists.
+	s.TestDatabaseAdmin.PutDatabase("projects/p/instances/i/databases/d")
 	s.setupSelect1Result()
 	s.setupFooResults()
 	s.setupSingersResults()
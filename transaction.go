@@ -22,9 +22,11 @@ import (
 	"time"
 
 	"cloud.google.com/go/spanner"
+	"google.golang.org/api/iterator"
 	sppb "google.golang.org/genproto/googleapis/spanner/v1"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
 // contextTransaction is the combination of both read/write and read-only
@@ -32,7 +34,8 @@ import (
 type contextTransaction interface {
 	Commit() error
 	Rollback() error
-	Query(ctx context.Context, stmt spanner.Statement) rowIterator
+	Query(ctx context.Context, stmt spanner.Statement, options spanner.QueryOptions) rowIterator
+	Read(ctx context.Context, table string, keySet spanner.KeySet, columns []string, opts *spanner.ReadOptions) rowIterator
 	ExecContext(ctx context.Context, stmt spanner.Statement) (int64, error)
 
 	StartBatchDML() (driver.Result, error)
@@ -46,6 +49,25 @@ type rowIterator interface {
 	Next() (*spanner.Row, error)
 	Stop()
 	Metadata() *sppb.ResultSetMetadata
+	// ResultSetStats returns the query plan and query statistics that were
+	// returned by Spanner, or nil if Spanner did not return any. The
+	// statistics are only available after all rows have been consumed.
+	ResultSetStats() *sppb.ResultSetStats
+}
+
+// resultSetStats returns the statistics that Spanner returned for the query of
+// the given iterator, or nil if it did not return any statistics.
+func resultSetStats(it *spanner.RowIterator) *sppb.ResultSetStats {
+	if it == nil || (it.QueryPlan == nil && it.QueryStats == nil) {
+		return nil
+	}
+	stats := &sppb.ResultSetStats{QueryPlan: it.QueryPlan}
+	if it.QueryStats != nil {
+		if queryStats, err := structpb.NewStruct(it.QueryStats); err == nil {
+			stats.QueryStats = queryStats
+		}
+	}
+	return stats
 }
 
 type readOnlyRowIterator struct {
@@ -64,6 +86,34 @@ func (ri *readOnlyRowIterator) Metadata() *sppb.ResultSetMetadata {
 	return ri.RowIterator.Metadata
 }
 
+func (ri *readOnlyRowIterator) ResultSetStats() *sppb.ResultSetStats {
+	return resultSetStats(ri.RowIterator)
+}
+
+// timeoutRowIterator wraps a rowIterator for a query that was executed with a
+// statement timeout. Stopping the iterator releases the statement context, and
+// any error that is caused by the statement timeout is returned as
+// ErrStatementTimeout.
+type timeoutRowIterator struct {
+	rowIterator
+	ctx     context.Context
+	stmtCtx context.Context
+	cancel  context.CancelFunc
+}
+
+func (ri *timeoutRowIterator) Next() (*spanner.Row, error) {
+	row, err := ri.rowIterator.Next()
+	if err != nil && err != iterator.Done {
+		return nil, statementTimeoutErr(ri.ctx, ri.stmtCtx, err)
+	}
+	return row, err
+}
+
+func (ri *timeoutRowIterator) Stop() {
+	ri.rowIterator.Stop()
+	ri.cancel()
+}
+
 type readOnlyTransaction struct {
 	roTx  *spanner.ReadOnlyTransaction
 	close func()
@@ -89,8 +139,12 @@ func (tx *readOnlyTransaction) Rollback() error {
 	return nil
 }
 
-func (tx *readOnlyTransaction) Query(ctx context.Context, stmt spanner.Statement) rowIterator {
-	return &readOnlyRowIterator{tx.roTx.Query(ctx, stmt)}
+func (tx *readOnlyTransaction) Query(ctx context.Context, stmt spanner.Statement, options spanner.QueryOptions) rowIterator {
+	return &readOnlyRowIterator{tx.roTx.QueryWithOptions(ctx, stmt, options)}
+}
+
+func (tx *readOnlyTransaction) Read(ctx context.Context, table string, keySet spanner.KeySet, columns []string, opts *spanner.ReadOptions) rowIterator {
+	return &readOnlyRowIterator{tx.roTx.ReadWithOptions(ctx, table, keySet, columns, opts)}
 }
 
 func (tx *readOnlyTransaction) ExecContext(_ context.Context, stmt spanner.Statement) (int64, error) {
@@ -119,6 +173,11 @@ func (tx *readOnlyTransaction) BufferWrite([]*spanner.Mutation) error {
 // from the initial attempt.
 var ErrAbortedDueToConcurrentModification = status.Error(codes.Aborted, "Transaction was aborted due to a concurrent modification")
 
+// ErrStatementTimeout is returned when a statement is cancelled because it
+// exceeded the statement timeout of the connection. The error has the code
+// DeadlineExceeded.
+var ErrStatementTimeout = status.Error(codes.DeadlineExceeded, "Statement execution timeout occurred")
+
 // readWriteTransaction is the internal structure for go/sql read/write
 // transactions. These transactions can automatically be retried if the
 // underlying Spanner transaction is aborted. This is done by keeping track
@@ -131,12 +190,18 @@ var ErrAbortedDueToConcurrentModification = status.Error(codes.Aborted, "Transac
 type readWriteTransaction struct {
 	ctx    context.Context
 	client *spanner.Client
+	// options are the options that were used to start the transaction. The
+	// same options are used when the transaction is retried.
+	options spanner.TransactionOptions
 	// rwTx is the underlying Spanner read/write transaction. This transaction
 	// will be replaced with a new one if the initial transaction is aborted.
 	rwTx *spanner.ReadWriteStmtBasedTransaction
 	// batch is any DML batch that is active for this transaction.
 	batch *batch
 	close func(commitTs *time.Time, commitErr error)
+	// commitResponse is set to the commit response of the transaction when
+	// the transaction is committed if it is not nil.
+	commitResponse *spanner.CommitResponse
 	// retryAborts indicates whether this transaction will automatically retry
 	// the transaction if it is aborted by Spanner. The default is true.
 	retryAborts bool
@@ -222,6 +287,17 @@ func (ru *retriableBatchUpdate) retry(ctx context.Context, tx *spanner.ReadWrite
 	return nil
 }
 
+// retriableMutations implements retriableStatement for buffered mutations.
+type retriableMutations struct {
+	// ms are the mutations that were buffered in the transaction.
+	ms []*spanner.Mutation
+}
+
+// retry buffers the mutations again in the new transaction.
+func (rm *retriableMutations) retry(_ context.Context, tx *spanner.ReadWriteStmtBasedTransaction) error {
+	return tx.BufferWrite(rm.ms)
+}
+
 // runWithRetry executes a statement on a go/sql read/write transaction and
 // automatically retries the entire transaction if the statement returns an
 // Aborted error. The method will return ErrAbortedDueToConcurrentModification
@@ -246,7 +322,7 @@ func (tx *readWriteTransaction) runWithRetry(ctx context.Context, f func(ctx con
 // retry retries the entire read/write transaction on a new Spanner transaction.
 // It will return ErrAbortedDueToConcurrentModification if the retry fails.
 func (tx *readWriteTransaction) retry(ctx context.Context) (err error) {
-	tx.rwTx, err = spanner.NewReadWriteStmtBasedTransaction(ctx, tx.client)
+	tx.rwTx, err = spanner.NewReadWriteStmtBasedTransactionWithOptions(ctx, tx.client, tx.options)
 	if err != nil {
 		return err
 	}
@@ -265,20 +341,21 @@ func (tx *readWriteTransaction) retry(ctx context.Context) (err error) {
 // aborted by Spanner, the entire transaction will automatically be retried,
 // unless internal retries have been disabled.
 func (tx *readWriteTransaction) Commit() (err error) {
-	var commitTs time.Time
+	var resp spanner.CommitResponse
 	if tx.rwTx != nil {
 		if !tx.retryAborts {
-			ts, err := tx.rwTx.Commit(tx.ctx)
-			tx.close(&ts, err)
-			return err
+			resp, err = tx.rwTx.CommitWithReturnResp(tx.ctx)
+		} else {
+			err = tx.runWithRetry(tx.ctx, func(ctx context.Context) (err error) {
+				resp, err = tx.rwTx.CommitWithReturnResp(ctx)
+				return err
+			})
 		}
-
-		err = tx.runWithRetry(tx.ctx, func(ctx context.Context) (err error) {
-			commitTs, err = tx.rwTx.Commit(ctx)
-			return err
-		})
 	}
-	tx.close(&commitTs, err)
+	if err == nil && tx.commitResponse != nil {
+		*tx.commitResponse = resp
+	}
+	tx.close(&resp.CommitTs, err)
 	return err
 }
 
@@ -295,21 +372,39 @@ func (tx *readWriteTransaction) Rollback() error {
 // Query executes a query using the read/write transaction and returns a
 // rowIterator that will automatically retry the read/write transaction if the
 // transaction is aborted during the query or while iterating the returned rows.
-func (tx *readWriteTransaction) Query(ctx context.Context, stmt spanner.Statement) rowIterator {
+func (tx *readWriteTransaction) Query(ctx context.Context, stmt spanner.Statement, options spanner.QueryOptions) rowIterator {
+	return tx.execRows(ctx, func(ctx context.Context, rwTx *spanner.ReadWriteStmtBasedTransaction) *spanner.RowIterator {
+		return rwTx.QueryWithOptions(ctx, stmt, options)
+	})
+}
+
+// Read executes a read using the read/write transaction and returns a
+// rowIterator that will automatically retry the read/write transaction if the
+// transaction is aborted during the read or while iterating the returned rows.
+func (tx *readWriteTransaction) Read(ctx context.Context, table string, keySet spanner.KeySet, columns []string, opts *spanner.ReadOptions) rowIterator {
+	return tx.execRows(ctx, func(ctx context.Context, rwTx *spanner.ReadWriteStmtBasedTransaction) *spanner.RowIterator {
+		return rwTx.ReadWithOptions(ctx, table, keySet, columns, opts)
+	})
+}
+
+// execRows executes the given query or read function on the read/write
+// transaction. The function is executed again on the new transaction if the
+// transaction is retried.
+func (tx *readWriteTransaction) execRows(ctx context.Context, exec func(ctx context.Context, rwTx *spanner.ReadWriteStmtBasedTransaction) *spanner.RowIterator) rowIterator {
 	// If internal retries have been disabled, we don't need to keep track of a
 	// running checksum for all results that we have seen.
 	if !tx.retryAborts {
-		return &readOnlyRowIterator{tx.rwTx.Query(ctx, stmt)}
+		return &readOnlyRowIterator{exec(ctx, tx.rwTx)}
 	}
 
 	// If retries are enabled, we need to use a row iterator that will keep
 	// track of a running checksum of all the results that we see.
 	buffer := &bytes.Buffer{}
 	it := &checksumRowIterator{
-		RowIterator: tx.rwTx.Query(ctx, stmt),
+		RowIterator: exec(ctx, tx.rwTx),
 		ctx:         ctx,
 		tx:          tx,
-		stmt:        stmt,
+		exec:        exec,
 		buffer:      buffer,
 		enc:         gob.NewEncoder(buffer),
 	}
@@ -390,7 +485,13 @@ func (tx *readWriteTransaction) runDmlBatch(ctx context.Context) (driver.Result,
 }
 
 func (tx *readWriteTransaction) BufferWrite(ms []*spanner.Mutation) error {
-	return tx.rwTx.BufferWrite(ms)
+	if err := tx.rwTx.BufferWrite(ms); err != nil {
+		return err
+	}
+	if tx.retryAborts {
+		tx.statements = append(tx.statements, &retriableMutations{ms: ms})
+	}
+	return nil
 }
 
 // errorsEqualForRetry returns true if the two errors should be considered equal